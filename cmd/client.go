@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/benwsapp/rlgl/pkg/wsclient"
@@ -13,7 +15,7 @@ import (
 )
 
 var (
-	ErrTokenRequired    = errors.New("token is required: use --token flag or RLGL_TOKEN env var")
+	ErrTokenRequired    = errors.New("token is required: use --token flag or RLGL_TOKEN env var, or --cert and --key")
 	ErrClientIDRequired = errors.New("client-id is required: use --client-id flag or RLGL_CLIENT_ID env var")
 )
 
@@ -51,21 +53,37 @@ var clientCmd = &cobra.Command{
 		_ = viper.BindPFlag("interval", cmd.Flags().Lookup("interval"))
 		_ = viper.BindPFlag("once", cmd.Flags().Lookup("once"))
 		_ = viper.BindPFlag("token", cmd.Flags().Lookup("token"))
+		_ = viper.BindPFlag("watch", cmd.Flags().Lookup("watch"))
+		_ = viper.BindPFlag("resync", cmd.Flags().Lookup("resync"))
+		_ = viper.BindPFlag("clear-slack", cmd.Flags().Lookup("clear-slack"))
+		_ = viper.BindPFlag("ca-file", cmd.Flags().Lookup("ca-file"))
+		_ = viper.BindPFlag("cert", cmd.Flags().Lookup("cert"))
+		_ = viper.BindPFlag("key", cmd.Flags().Lookup("key"))
 
 		serverURL := viper.GetString("server")
 		clientID := viper.GetString("client-id")
 		interval := viper.GetDuration("interval")
 		once := viper.GetBool("once")
 		token := viper.GetString("token")
+		watch := viper.GetBool("watch")
+		resync := viper.GetDuration("resync")
+		clearSlack := viper.GetBool("clear-slack")
+		certFile := viper.GetString("cert")
 
 		if clientID == "" {
 			return ErrClientIDRequired
 		}
 
-		if token == "" {
+		// A client certificate can stand in for the token.
+		if token == "" && certFile == "" {
 			return ErrTokenRequired
 		}
 
+		tlsConfig, err := wsclient.LoadTLSConfig(viper.GetString("ca-file"), certFile, viper.GetString("key"))
+		if err != nil {
+			return fmt.Errorf("failed to set up TLS: %w", err)
+		}
+
 		configPath, err := InitConfig(cmd)
 		if err != nil {
 			return err
@@ -78,17 +96,44 @@ var clientCmd = &cobra.Command{
 			"config", configPath,
 			"interval", interval,
 			"once", once,
+			"watch", watch,
 		)
 
+		client := wsclient.NewClient(serverURL, clientID, token)
+		client.SetTLSConfig(tlsConfig)
+		client.SetVersion(Version)
+
 		if once {
-			return wsclient.RunOnce(serverURL, configPath, clientID, token)
+			return wsclient.PushOnce(client, configPath)
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// In watch mode file changes drive pushes and the interval is only a
+		// fallback resync.
+		if watch {
+			interval = resync
 		}
 
-		return wsclient.Run(serverURL, configPath, clientID, token, interval)
+		runner := wsclient.NewRunner(client, configPath, interval)
+
+		if watch {
+			runner.WithWatch(wsclient.DefaultWatchDebounce)
+		}
+
+		if clearSlack {
+			runner.WithClearSlack()
+		}
+
+		return runner.Run(ctx)
 	},
 }
 
-const defaultInterval = 30 * time.Second
+const (
+	defaultInterval = 30 * time.Second
+	defaultResync   = 5 * time.Minute
+)
 
 func init() {
 	clientCmd.Flags().String("server", "ws://localhost:8080/ws", "WebSocket server URL")
@@ -97,12 +142,24 @@ func init() {
 	clientCmd.Flags().Bool("once", false, "push config once and exit")
 	clientCmd.Flags().String("config", "", "path to site configuration file (defaults to rlgl.yaml)")
 	clientCmd.Flags().String("token", "", "authentication token (required)")
+	clientCmd.Flags().Bool("watch", false, "push as soon as the config file changes instead of on every interval")
+	clientCmd.Flags().Duration("resync", defaultResync, "fallback interval between pushes in watch mode")
+	clientCmd.Flags().Bool("clear-slack", false, "clear the Slack status on exit")
+	clientCmd.Flags().String("ca-file", "", "CA file to trust for a wss:// server with a private certificate")
+	clientCmd.Flags().String("cert", "", "client certificate file for mutual TLS")
+	clientCmd.Flags().String("key", "", "client private key file for mutual TLS")
 
 	_ = viper.BindEnv("server", "RLGL_REMOTE_HOST")
 	_ = viper.BindEnv("client-id", "RLGL_CLIENT_ID")
 	_ = viper.BindEnv("interval", "RLGL_CLIENT_INTERVAL")
 	_ = viper.BindEnv("once", "RLGL_CLIENT_ONCE")
 	_ = viper.BindEnv("token", "RLGL_TOKEN")
+	_ = viper.BindEnv("watch", "RLGL_CLIENT_WATCH")
+	_ = viper.BindEnv("resync", "RLGL_CLIENT_RESYNC")
+	_ = viper.BindEnv("clear-slack", "RLGL_CLIENT_CLEAR_SLACK")
+	_ = viper.BindEnv("ca-file", "RLGL_CA_FILE")
+	_ = viper.BindEnv("cert", "RLGL_CLIENT_CERT")
+	_ = viper.BindEnv("key", "RLGL_CLIENT_KEY")
 
 	RootCmd.AddCommand(clientCmd)
 }
@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/benwsapp/rlgl/pkg/auth"
 	"github.com/benwsapp/rlgl/pkg/server"
 	"github.com/benwsapp/rlgl/pkg/wsserver"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -16,30 +24,192 @@ var serveCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})))
 
-		_ = viper.BindPFlag("addr", cmd.Flags().Lookup("addr"))
-		_ = viper.BindPFlag("trusted-origins", cmd.Flags().Lookup("trusted-origins"))
-		_ = viper.BindPFlag("token", cmd.Flags().Lookup("token"))
+		bindServeFlags(cmd.Flags())
 
 		addr := viper.GetString("addr")
 		trustedOrigins := viper.GetStringSlice("trusted-origins")
 		token := viper.GetString("token")
+		storeSpec := viper.GetString("store")
+		tokenFile := viper.GetString("token-file")
+		viewerPassword := viper.GetString("viewer-password")
+		historyRetention := viper.GetDuration("history-retention")
 
-		slog.Info("starting server", "addr", addr, "trusted_origins", trustedOrigins)
+		slog.Info("starting server", "addr", addr, "trusted_origins", trustedOrigins, "store", storeSpec)
 
-		store := wsserver.GetStore()
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
 
-		return server.Run(addr, store, trustedOrigins, token)
+		opts := server.Options{
+			TrustedOrigins: trustedOrigins,
+			Token:          token,
+			TLS: server.TLSOptions{
+				CertFile:     viper.GetString("tls-cert"),
+				KeyFile:      viper.GetString("tls-key"),
+				ClientCAFile: viper.GetString("client-ca"),
+			},
+			Presence: wsserver.PresencePolicy{
+				StaleFactor: viper.GetInt("stale-factor"),
+				GreyStale:   viper.GetBool("grey-stale"),
+			},
+		}
+
+		var (
+			file *auth.TokenFile
+			err  error
+		)
+
+		if tokenFile != "" {
+			file = auth.NewTokenFile(tokenFile)
+
+			opts.Registry, err = loadRegistry(ctx, file)
+			if err != nil {
+				return err
+			}
+		}
+
+		if viewerPassword != "" {
+			opts.Viewer, err = server.NewViewerAuth(viewerPassword)
+			if err != nil {
+				return fmt.Errorf("failed to set up viewer login: %w", err)
+			}
+		}
+
+		opts.SlashCommands, err = slashCommands(
+			viper.GetString("slack-signing-secret"),
+			viper.GetStringSlice("slack-users"),
+			viper.GetDuration("slack-command-ttl"),
+		)
+		if err != nil {
+			return err
+		}
+
+		store, err := wsserver.OpenStore(storeSpec, historyRetention)
+		if err != nil {
+			return fmt.Errorf("failed to open store: %w", err)
+		}
+
+		runErr := server.Run(ctx, addr, store, opts)
+
+		return errors.Join(runErr, flush(store, file, opts.Registry))
 	},
 }
 
+// bindServeFlags lets viper read serve's flags, so each setting comes from
+// its flag, else its environment variable, else the flag's default.
+func bindServeFlags(flags *pflag.FlagSet) {
+	_ = viper.BindPFlag("addr", flags.Lookup("addr"))
+	_ = viper.BindPFlag("trusted-origins", flags.Lookup("trusted-origins"))
+	_ = viper.BindPFlag("token", flags.Lookup("token"))
+	_ = viper.BindPFlag("store", flags.Lookup("store"))
+	_ = viper.BindPFlag("token-file", flags.Lookup("token-file"))
+	_ = viper.BindPFlag("viewer-password", flags.Lookup("viewer-password"))
+	_ = viper.BindPFlag("history-retention", flags.Lookup("history-retention"))
+	_ = viper.BindPFlag("stale-factor", flags.Lookup("stale-factor"))
+	_ = viper.BindPFlag("grey-stale", flags.Lookup("grey-stale"))
+	_ = viper.BindPFlag("tls-cert", flags.Lookup("tls-cert"))
+	_ = viper.BindPFlag("tls-key", flags.Lookup("tls-key"))
+	_ = viper.BindPFlag("client-ca", flags.Lookup("client-ca"))
+	_ = viper.BindPFlag("slack-signing-secret", flags.Lookup("slack-signing-secret"))
+	_ = viper.BindPFlag("slack-users", flags.Lookup("slack-users"))
+	_ = viper.BindPFlag("slack-command-ttl", flags.Lookup("slack-command-ttl"))
+}
+
+// flush writes out what the server holds in memory once every connection is
+// done with it: the store's final snapshot and the tokens' last-used times.
+func flush(store wsserver.Store, file *auth.TokenFile, registry *auth.Registry) error {
+	var errs []error
+
+	err := store.Close()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to close store: %w", err))
+	}
+
+	if file != nil {
+		err = file.RecordLastUsed(registry.LastUsed())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to record token use: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// slashCommands sets up the Slack slash command when a signing secret is
+// given.
+func slashCommands(signingSecret string, pairs []string, ttl time.Duration) (*server.SlashCommands, error) {
+	if signingSecret == "" {
+		return nil, nil //nolint:nilnil // the endpoint is off
+	}
+
+	users, err := server.ParseSlackUsers(pairs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse --slack-users: %w", err)
+	}
+
+	commands, err := server.NewSlashCommands(signingSecret, users)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up Slack commands: %w", err)
+	}
+
+	return commands.WithTTL(ttl), nil
+}
+
+// tokenUseFlushInterval is how often last-used times are written to the token file.
+const tokenUseFlushInterval = time.Minute
+
+// loadRegistry builds the credential registry from a token file and keeps it
+// in sync until ctx is done: the file is reloaded on SIGHUP and token use is
+// written back periodically.
+func loadRegistry(ctx context.Context, file *auth.TokenFile) (*auth.Registry, error) {
+	registry := auth.NewRegistry()
+
+	err := file.LoadInto(registry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token file: %w", err)
+	}
+
+	slog.Info("loaded token file", "path", file.Path())
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	go file.Serve(ctx, registry, reload, tokenUseFlushInterval)
+
+	return registry, nil
+}
+
 func init() {
 	serveCmd.Flags().String("addr", ":8080", "address to bind the server to")
 	serveCmd.Flags().StringSlice("trusted-origins", []string{}, "comma-separated list of trusted CORS origins")
 	serveCmd.Flags().String("token", "", "authentication token (generates one if not provided)")
+	serveCmd.Flags().String("store", "memory", `where client configs are kept: "memory" or "file:<dir>"`)
+	serveCmd.Flags().String("token-file", "", "file of per-client tokens managed by rlgl token (reloaded on SIGHUP)")
+	serveCmd.Flags().String("viewer-password", "", "require this password to view the dashboard")
+	serveCmd.Flags().Duration("history-retention", wsserver.DefaultHistoryRetention, "how long to keep status history (0 disables it)")
+	serveCmd.Flags().Int("stale-factor", wsserver.DefaultStaleFactor, "heartbeats a client may miss before it is shown as stale or offline")
+	serveCmd.Flags().Bool("grey-stale", false, "grey out the light of clients that are stale or offline")
+	serveCmd.Flags().String("tls-cert", "", "TLS certificate file; serves HTTPS and WSS (reloaded when it changes)")
+	serveCmd.Flags().String("tls-key", "", "TLS private key file")
+	serveCmd.Flags().String("client-ca", "", "CA file for client certificates; a verified certificate's CN may push as that client ID")
+	serveCmd.Flags().String("slack-signing-secret", "", "Slack app signing secret; serves the /rlgl slash command at "+server.SlashCommandPath)
+	serveCmd.Flags().StringSlice("slack-users", []string{}, "comma-separated <Slack user ID>=<client ID> pairs the slash command may change")
+	serveCmd.Flags().Duration("slack-command-ttl", server.DefaultSlashCommandTTL, "how long a slash command's change outlasts the client's own pushes")
 
 	_ = viper.BindEnv("addr", "RLGL_SERVER_ADDR")
 	_ = viper.BindEnv("trusted-origins", "RLGL_TRUSTED_ORIGINS")
 	_ = viper.BindEnv("token", "RLGL_TOKEN")
+	_ = viper.BindEnv("store", "RLGL_STORE")
+	_ = viper.BindEnv("token-file", "RLGL_TOKEN_FILE")
+	_ = viper.BindEnv("viewer-password", "RLGL_VIEWER_PASSWORD")
+	_ = viper.BindEnv("history-retention", "RLGL_HISTORY_RETENTION")
+	_ = viper.BindEnv("stale-factor", "RLGL_STALE_FACTOR")
+	_ = viper.BindEnv("grey-stale", "RLGL_GREY_STALE")
+	_ = viper.BindEnv("tls-cert", "RLGL_TLS_CERT")
+	_ = viper.BindEnv("tls-key", "RLGL_TLS_KEY")
+	_ = viper.BindEnv("client-ca", "RLGL_CLIENT_CA")
+	_ = viper.BindEnv("slack-signing-secret", "RLGL_SLACK_SIGNING_SECRET")
+	_ = viper.BindEnv("slack-users", "RLGL_SLACK_USERS")
+	_ = viper.BindEnv("slack-command-ttl", "RLGL_SLACK_COMMAND_TTL")
 
 	RootCmd.AddCommand(serveCmd)
 }
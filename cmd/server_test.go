@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/server"
+	"github.com/benwsapp/rlgl/pkg/slack"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+	"github.com/spf13/viper"
+)
+
+func TestServeSlashCommandTTLDefault(t *testing.T) {
+	bindServeFlags(serveCmd.Flags())
+
+	ttl := viper.GetDuration("slack-command-ttl")
+	if ttl != server.DefaultSlashCommandTTL {
+		t.Fatalf("expected the default TTL %s, got %s", server.DefaultSlashCommandTTL, ttl)
+	}
+
+	commands, err := slashCommands("secret", []string{"U123=alice"}, ttl)
+	if err != nil {
+		t.Fatalf("failed to set up slash commands: %v", err)
+	}
+
+	pushed := embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Status: embed.StatusGreen}}
+
+	store := wsserver.NewStore()
+
+	err = store.Set("alice", pushed)
+	if err != nil {
+		t.Fatalf("failed to set config: %v", err)
+	}
+
+	body := url.Values{"command": {"/rlgl"}, "user_id": {"U123"}, "text": {"red"}}.Encode()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req := httptest.NewRequest(http.MethodPost, server.SlashCommandPath, strings.NewReader(body))
+	req.Header.Set(slack.TimestampHeader, timestamp)
+	req.Header.Set(slack.SignatureHeader, slack.Sign("secret", timestamp, []byte(body)))
+
+	runtime := wsserver.NewRuntime()
+	rec := httptest.NewRecorder()
+	commands.Handler(store, runtime).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if config := runtime.Overrides.Apply("alice", pushed); config.Contributor.State() != embed.StatusRed {
+		t.Errorf("expected the command to outlast the client's next push, got %+v", config.Contributor)
+	}
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var ErrTokenFileRequired = errors.New("token file is required: use --token-file flag or RLGL_TOKEN_FILE env var")
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage the per-client tokens the server accepts",
+	Long: `Manage the token file the server loads with --token-file.
+
+Only token hashes are stored. A token is printed once, when it is
+created or rotated. Send the server SIGHUP to pick up changes.`,
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a token bound to one or more client IDs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		file, err := tokenFile(cmd)
+		if err != nil {
+			return err
+		}
+
+		label, _ := cmd.Flags().GetString("label")
+		clientIDs, _ := cmd.Flags().GetStringSlice("client-id")
+
+		token, record, err := file.Create(label, clientIDs)
+		if err != nil {
+			return fmt.Errorf("failed to create token: %w", err)
+		}
+
+		printNewToken(cmd, token, record)
+
+		return nil
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tokens",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		file, err := tokenFile(cmd)
+		if err != nil {
+			return err
+		}
+
+		records, err := file.Load()
+		if err != nil {
+			return fmt.Errorf("failed to list tokens: %w", err)
+		}
+
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0) //nolint:mnd
+
+		_, _ = fmt.Fprintln(writer, "ID\tLABEL\tCLIENT IDS\tCREATED\tLAST USED")
+
+		for _, record := range records {
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n",
+				record.ID,
+				record.Label,
+				strings.Join(record.ClientIDs, ","),
+				formatTokenTime(record.CreatedAt),
+				formatTokenTime(record.LastUsed),
+			)
+		}
+
+		err = writer.Flush()
+		if err != nil {
+			return fmt.Errorf("failed to write token list: %w", err)
+		}
+
+		return nil
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke a token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := tokenFile(cmd)
+		if err != nil {
+			return err
+		}
+
+		err = file.Revoke(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to revoke token: %w", err)
+		}
+
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), "Revoked token", args[0])
+
+		return nil
+	},
+}
+
+var tokenRotateCmd = &cobra.Command{
+	Use:   "rotate <id>",
+	Short: "Replace a token with a new one for the same client IDs",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := tokenFile(cmd)
+		if err != nil {
+			return err
+		}
+
+		token, record, err := file.Rotate(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to rotate token: %w", err)
+		}
+
+		printNewToken(cmd, token, record)
+
+		return nil
+	},
+}
+
+func tokenFile(cmd *cobra.Command) (*auth.TokenFile, error) {
+	_ = viper.BindPFlag("token-file", cmd.Flags().Lookup("token-file"))
+
+	path := viper.GetString("token-file")
+	if path == "" {
+		return nil, ErrTokenFileRequired
+	}
+
+	return auth.NewTokenFile(path), nil
+}
+
+func printNewToken(cmd *cobra.Command, token string, record auth.TokenRecord) {
+	out := cmd.OutOrStdout()
+
+	_, _ = fmt.Fprintln(out, "ID:        ", record.ID)
+	_, _ = fmt.Fprintln(out, "Client IDs:", strings.Join(record.ClientIDs, ","))
+	_, _ = fmt.Fprintln(out, "Token:     ", token)
+	_, _ = fmt.Fprintln(out)
+	_, _ = fmt.Fprintln(out, "Save this token now - it cannot be shown again.")
+}
+
+func formatTokenTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	return t.Local().Format(time.DateTime)
+}
+
+func init() {
+	tokenCmd.PersistentFlags().String("token-file", "", "path to the server's token file")
+	_ = viper.BindEnv("token-file", "RLGL_TOKEN_FILE")
+
+	tokenCreateCmd.Flags().String("label", "", "human-readable label for the token")
+	tokenCreateCmd.Flags().StringSlice("client-id", nil, `client IDs the token may push as (repeatable, "*" for any)`)
+	_ = tokenCreateCmd.MarkFlagRequired("client-id")
+
+	tokenCmd.AddCommand(tokenCreateCmd, tokenListCmd, tokenRevokeCmd, tokenRotateCmd)
+	RootCmd.AddCommand(tokenCmd)
+}
@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AnyClientID binds a token to every client ID, like the legacy shared token.
+const AnyClientID = "*"
+
+var (
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrClientIDNotAllowed = errors.New("client id not allowed for token")
+	ErrNoClientIDs        = errors.New("at least one client id is required")
+)
+
+// Registry maps credentials to the client IDs they may push as. Only token
+// hashes are kept, and it is safe to register and revoke tokens while the
+// server is running.
+type Registry struct {
+	mu       sync.Mutex
+	entries  map[string]*registryEntry
+	onRevoke []func()
+}
+
+type registryEntry struct {
+	clientIDs []string
+	fromFile  bool
+	lastUsed  time.Time
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		entries: make(map[string]*registryEntry),
+	}
+}
+
+// HashToken returns the hex-encoded SHA-256 of token. Tokens are 32 random
+// bytes, so an unsalted hash is enough to keep them out of memory and disk.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Register binds token to clientIDs, replacing any earlier binding.
+func (r *Registry) Register(token string, clientIDs ...string) error {
+	return r.RegisterHash(HashToken(token), clientIDs...)
+}
+
+// RegisterHash binds an already hashed token to clientIDs.
+func (r *Registry) RegisterHash(hash string, clientIDs ...string) error {
+	if len(clientIDs) == 0 {
+		return fmt.Errorf("%w: %s", ErrNoClientIDs, hash)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[hash] = &registryEntry{clientIDs: slices.Clone(clientIDs)}
+
+	return nil
+}
+
+// Sync replaces every token previously loaded from a token file with records,
+// leaving tokens added with Register in place.
+func (r *Registry) Sync(records []TokenRecord) {
+	defer r.revoked()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.entries
+	r.entries = make(map[string]*registryEntry, len(previous)+len(records))
+
+	for hash, entry := range previous {
+		if !entry.fromFile {
+			r.entries[hash] = entry
+		}
+	}
+
+	for _, record := range records {
+		lastUsed := record.LastUsed
+		if entry, ok := previous[record.Hash]; ok && entry.lastUsed.After(lastUsed) {
+			lastUsed = entry.lastUsed
+		}
+
+		r.entries[record.Hash] = &registryEntry{
+			clientIDs: slices.Clone(record.ClientIDs),
+			fromFile:  true,
+			lastUsed:  lastUsed,
+		}
+	}
+}
+
+// LastUsed returns when each token hash last authenticated.
+func (r *Registry) LastUsed() map[string]time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lastUsed := make(map[string]time.Time, len(r.entries))
+
+	for hash, entry := range r.entries {
+		if !entry.lastUsed.IsZero() {
+			lastUsed[hash] = entry.lastUsed
+		}
+	}
+
+	return lastUsed
+}
+
+// Revoke removes token, reporting whether it was registered.
+func (r *Registry) Revoke(token string) bool {
+	hash := HashToken(token)
+
+	r.mu.Lock()
+
+	_, ok := r.entries[hash]
+	delete(r.entries, hash)
+
+	r.mu.Unlock()
+
+	if ok {
+		r.revoked()
+	}
+
+	return ok
+}
+
+// OnRevoke calls fn whenever tokens may have been revoked: after Revoke and
+// after every Sync.
+func (r *Registry) OnRevoke(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onRevoke = append(r.onRevoke, fn)
+}
+
+func (r *Registry) revoked() {
+	r.mu.Lock()
+	callbacks := slices.Clone(r.onRevoke)
+	r.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
+// Known reports whether token is registered. Unlike Authenticate it does not
+// count as a use.
+func (r *Registry) Known(token string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.entries[HashToken(token)]
+
+	return ok
+}
+
+// Authenticate reports whether token is registered.
+func (r *Registry) Authenticate(token string) bool {
+	return r.use(token) != nil
+}
+
+// Authorize checks that token may currently push as clientID.
+func (r *Registry) Authorize(token, clientID string) error {
+	clientIDs := r.use(token)
+	if clientIDs == nil {
+		return ErrInvalidToken
+	}
+
+	if !slices.Contains(clientIDs, AnyClientID) && !slices.Contains(clientIDs, clientID) {
+		return fmt.Errorf("%w: %s", ErrClientIDNotAllowed, clientID)
+	}
+
+	return nil
+}
+
+// use records that token was presented and returns its client IDs, or nil
+// if it is not registered.
+func (r *Registry) use(token string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[HashToken(token)]
+	if !ok {
+		return nil
+	}
+
+	entry.lastUsed = time.Now().UTC()
+
+	return entry.clientIDs
+}
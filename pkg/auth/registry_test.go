@@ -0,0 +1,129 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+)
+
+func TestRegistryAuthorize(t *testing.T) {
+	t.Parallel()
+
+	registry := auth.NewRegistry()
+
+	err := registry.Register("alice-token", "alice", "alice-desktop")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	err = registry.Register("shared-token", auth.AnyClientID)
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		clientID string
+		want     error
+	}{
+		{name: "bound client", token: "alice-token", clientID: "alice", want: nil},
+		{name: "second bound client", token: "alice-token", clientID: "alice-desktop", want: nil},
+		{name: "someone else", token: "alice-token", clientID: "bob", want: auth.ErrClientIDNotAllowed},
+		{name: "wildcard", token: "shared-token", clientID: "bob", want: nil},
+		{name: "unknown token", token: "nope", clientID: "alice", want: auth.ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := registry.Authorize(tt.token, tt.clientID)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Authorize(%q, %q) = %v, want %v", tt.token, tt.clientID, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryRevoke(t *testing.T) {
+	t.Parallel()
+
+	registry := auth.NewRegistry()
+
+	err := registry.Register("alice-token", "alice")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	if !registry.Authenticate("alice-token") {
+		t.Fatal("expected registered token to authenticate")
+	}
+
+	if !registry.Revoke("alice-token") {
+		t.Error("expected Revoke to report a registered token")
+	}
+
+	if registry.Authenticate("alice-token") {
+		t.Error("expected revoked token to be rejected")
+	}
+
+	if registry.Revoke("alice-token") {
+		t.Error("expected second Revoke to report nothing removed")
+	}
+}
+
+func TestRegistryOnRevoke(t *testing.T) {
+	t.Parallel()
+
+	registry := auth.NewRegistry()
+	_ = registry.Register("alice-token", "alice")
+
+	calls := 0
+
+	registry.OnRevoke(func() {
+		calls++
+
+		if registry.Known("alice-token") {
+			t.Error("expected the token to be gone by the time OnRevoke runs")
+		}
+	})
+
+	registry.Revoke("unknown-token")
+
+	if calls != 0 {
+		t.Errorf("expected no call when nothing was revoked, got %d", calls)
+	}
+
+	registry.Revoke("alice-token")
+
+	if calls != 1 {
+		t.Errorf("expected one call after Revoke, got %d", calls)
+	}
+}
+
+func TestRegistryRequiresClientIDs(t *testing.T) {
+	t.Parallel()
+
+	err := auth.NewRegistry().Register("token")
+	if !errors.Is(err, auth.ErrNoClientIDs) {
+		t.Errorf("expected ErrNoClientIDs, got %v", err)
+	}
+}
+
+func TestHashTokenIsStable(t *testing.T) {
+	t.Parallel()
+
+	if auth.HashToken("a") != auth.HashToken("a") {
+		t.Error("expected equal tokens to hash equally")
+	}
+
+	if auth.HashToken("a") == auth.HashToken("b") {
+		t.Error("expected different tokens to hash differently")
+	}
+
+	if auth.HashToken("rlgl_secret") == "rlgl_secret" {
+		t.Error("expected the hash to differ from the token")
+	}
+}
@@ -0,0 +1,314 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const (
+	tokenFilePerm = 0o600
+	tokenIDLength = 12
+)
+
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenRecord describes one credential in a token file. The token itself is
+// only shown when it is created or rotated; the file keeps its hash.
+type TokenRecord struct {
+	ID        string    `json:"id"`
+	Hash      string    `json:"hash"`
+	Label     string    `json:"label"`
+	ClientIDs []string  `json:"clientIds"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastUsed  time.Time `json:"lastUsed,omitzero"`
+}
+
+type tokenFileContents struct {
+	Tokens []TokenRecord `json:"tokens"`
+}
+
+// TokenFile manages the credentials the server accepts, stored as JSON at
+// path. A missing file holds no tokens. Writers hold an exclusive lock on
+// path+".lock" while they read, modify and save, so the server's last-used
+// flush and the token commands never overwrite each other.
+type TokenFile struct {
+	path string
+}
+
+func NewTokenFile(path string) *TokenFile {
+	return &TokenFile{path: path}
+}
+
+func (f *TokenFile) Path() string {
+	return f.path
+}
+
+func (f *TokenFile) Load() ([]TokenRecord, error) {
+	// #nosec G304 - Path is chosen by the operator
+	data, err := os.ReadFile(filepath.Clean(f.path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	var contents tokenFileContents
+
+	err = json.Unmarshal(data, &contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token file: %w", err)
+	}
+
+	return contents.Tokens, nil
+}
+
+// LoadInto replaces the file-backed tokens in registry with the file's.
+func (f *TokenFile) LoadInto(registry *Registry) error {
+	records, err := f.Load()
+	if err != nil {
+		return err
+	}
+
+	registry.Sync(records)
+
+	return nil
+}
+
+// Create adds a new token bound to clientIDs and returns it in the clear.
+func (f *TokenFile) Create(label string, clientIDs []string) (string, TokenRecord, error) {
+	if len(clientIDs) == 0 {
+		return "", TokenRecord{}, ErrNoClientIDs
+	}
+
+	token, record, err := newTokenRecord(label, clientIDs)
+	if err != nil {
+		return "", TokenRecord{}, err
+	}
+
+	err = f.update(func(records []TokenRecord) ([]TokenRecord, error) {
+		return append(records, record), nil
+	})
+	if err != nil {
+		return "", TokenRecord{}, err
+	}
+
+	return token, record, nil
+}
+
+// Revoke removes the token with the given ID.
+func (f *TokenFile) Revoke(id string) error {
+	return f.update(func(records []TokenRecord) ([]TokenRecord, error) {
+		index := slices.IndexFunc(records, func(record TokenRecord) bool { return record.ID == id })
+		if index < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrTokenNotFound, id)
+		}
+
+		return slices.Delete(records, index, index+1), nil
+	})
+}
+
+// Rotate replaces the token with the given ID by a new one with the same
+// label and client IDs, and returns the new token in the clear.
+func (f *TokenFile) Rotate(id string) (string, TokenRecord, error) {
+	var (
+		token  string
+		record TokenRecord
+	)
+
+	err := f.update(func(records []TokenRecord) ([]TokenRecord, error) {
+		index := slices.IndexFunc(records, func(record TokenRecord) bool { return record.ID == id })
+		if index < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrTokenNotFound, id)
+		}
+
+		var err error
+
+		token, record, err = newTokenRecord(records[index].Label, records[index].ClientIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		records[index] = record
+
+		return records, nil
+	})
+	if err != nil {
+		return "", TokenRecord{}, err
+	}
+
+	return token, record, nil
+}
+
+// RecordLastUsed merges last-used times, keyed by token hash, into the file.
+// The file is re-read under the lock so tokens created or revoked meanwhile
+// are kept, and it is only rewritten when a time actually moved forward.
+func (f *TokenFile) RecordLastUsed(lastUsed map[string]time.Time) error {
+	return f.update(func(records []TokenRecord) ([]TokenRecord, error) {
+		changed := false
+
+		for index, record := range records {
+			used, ok := lastUsed[record.Hash]
+			if ok && used.After(record.LastUsed) {
+				records[index].LastUsed = used
+				changed = true
+			}
+		}
+
+		if !changed {
+			return nil, errUnchanged
+		}
+
+		return records, nil
+	})
+}
+
+// errUnchanged lets an update skip rewriting the file.
+var errUnchanged = errors.New("token file unchanged")
+
+// update loads the file, applies modify and saves the result, all while
+// holding the file's lock.
+func (f *TokenFile) update(modify func([]TokenRecord) ([]TokenRecord, error)) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	records, err := f.Load()
+	if err != nil {
+		return err
+	}
+
+	records, err = modify(records)
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return f.save(records)
+}
+
+// lock takes an exclusive flock on path+".lock", blocking until other
+// writers, in this process or another, are done.
+func (f *TokenFile) lock() (func(), error) {
+	// #nosec G304 - Path is chosen by the operator
+	lockFile, err := os.OpenFile(filepath.Clean(f.path+".lock"), os.O_CREATE|os.O_RDWR, tokenFilePerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token file lock: %w", err)
+	}
+
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX) //nolint:gosec // File descriptors fit in an int
+	if err != nil {
+		_ = lockFile.Close()
+
+		return nil, fmt.Errorf("failed to lock token file: %w", err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN) //nolint:gosec // File descriptors fit in an int
+		_ = lockFile.Close()
+	}, nil
+}
+
+func newTokenRecord(label string, clientIDs []string) (string, TokenRecord, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return "", TokenRecord{}, err
+	}
+
+	hash := HashToken(token)
+
+	return token, TokenRecord{
+		ID:        hash[:tokenIDLength],
+		Hash:      hash,
+		Label:     label,
+		ClientIDs: slices.Clone(clientIDs),
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// save replaces the file atomically so the server never reads a partial write.
+func (f *TokenFile) save(records []TokenRecord) error {
+	data, err := json.MarshalIndent(tokenFileContents{Tokens: records}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal token file: %w", err)
+	}
+
+	dir := filepath.Dir(f.path)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create token file: %w", err)
+	}
+
+	tmpName := tmp.Name()
+
+	err = tmp.Chmod(tokenFilePerm)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(tmpName)
+
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+
+	err = os.Rename(tmpName, f.path)
+	if err != nil {
+		return fmt.Errorf("failed to replace token file: %w", err)
+	}
+
+	return nil
+}
+
+// Serve reloads the file into registry whenever reload fires, and writes
+// last-used times back every flushEvery, until ctx is done.
+func (f *TokenFile) Serve(ctx context.Context, registry *Registry, reload <-chan os.Signal, flushEvery time.Duration) {
+	flush := time.NewTicker(flushEvery)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-reload:
+			err := f.LoadInto(registry)
+			if err != nil {
+				slog.Error("failed to reload token file", "error", err, "path", f.path)
+
+				continue
+			}
+
+			slog.Info("reloaded token file", "path", f.path)
+		case <-flush.C:
+			err := f.RecordLastUsed(registry.LastUsed())
+			if err != nil {
+				slog.Error("failed to record token use", "error", err, "path", f.path)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+)
+
+func newTokenFile(t *testing.T) *auth.TokenFile {
+	t.Helper()
+
+	return auth.NewTokenFile(filepath.Join(t.TempDir(), "tokens.json"))
+}
+
+func TestTokenFileCreateStoresOnlyHashes(t *testing.T) {
+	t.Parallel()
+
+	file := newTokenFile(t)
+
+	token, record, err := file.Create("laptop", []string{"alice"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	data, err := os.ReadFile(file.Path())
+	if err != nil {
+		t.Fatalf("failed to read token file: %v", err)
+	}
+
+	if strings.Contains(string(data), token) {
+		t.Error("expected the token file not to contain the token")
+	}
+
+	info, err := os.Stat(file.Path())
+	if err != nil {
+		t.Fatalf("failed to stat token file: %v", err)
+	}
+
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("expected mode 0600, got %o", perm)
+	}
+
+	records, err := file.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if len(records) != 1 || records[0].ID != record.ID || records[0].Label != "laptop" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+
+	if records[0].Hash != auth.HashToken(token) || records[0].CreatedAt.IsZero() {
+		t.Errorf("expected hash and creation time to be recorded, got %+v", records[0])
+	}
+}
+
+func TestTokenFileCreateRequiresClientIDs(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := newTokenFile(t).Create("laptop", nil)
+	if !errors.Is(err, auth.ErrNoClientIDs) {
+		t.Errorf("expected ErrNoClientIDs, got %v", err)
+	}
+}
+
+func TestTokenFileRevokeAndRotate(t *testing.T) {
+	t.Parallel()
+
+	file := newTokenFile(t)
+
+	aliceToken, alice, err := file.Create("alice", []string{"alice"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	bobToken, bob, err := file.Create("bob", []string{"bob"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	rotatedToken, rotated, err := file.Rotate(alice.ID)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+
+	if rotated.Label != "alice" || rotated.ClientIDs[0] != "alice" || rotated.ID == alice.ID {
+		t.Errorf("expected a new token for the same client, got %+v", rotated)
+	}
+
+	err = file.Revoke(bob.ID)
+	if err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+
+	registry := auth.NewRegistry()
+
+	err = file.LoadInto(registry)
+	if err != nil {
+		t.Fatalf("LoadInto failed: %v", err)
+	}
+
+	if registry.Authenticate(aliceToken) || registry.Authenticate(bobToken) {
+		t.Error("expected rotated and revoked tokens to be rejected")
+	}
+
+	if err := registry.Authorize(rotatedToken, "alice"); err != nil {
+		t.Errorf("expected rotated token to be accepted, got %v", err)
+	}
+}
+
+func TestTokenFileUnknownID(t *testing.T) {
+	t.Parallel()
+
+	file := newTokenFile(t)
+
+	if err := file.Revoke("missing"); !errors.Is(err, auth.ErrTokenNotFound) {
+		t.Errorf("expected ErrTokenNotFound from Revoke, got %v", err)
+	}
+
+	if _, _, err := file.Rotate("missing"); !errors.Is(err, auth.ErrTokenNotFound) {
+		t.Errorf("expected ErrTokenNotFound from Rotate, got %v", err)
+	}
+}
+
+func TestTokenFileRecordLastUsed(t *testing.T) {
+	t.Parallel()
+
+	file := newTokenFile(t)
+
+	token, _, err := file.Create("laptop", []string{"alice"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	registry := auth.NewRegistry()
+
+	err = file.LoadInto(registry)
+	if err != nil {
+		t.Fatalf("LoadInto failed: %v", err)
+	}
+
+	registry.Authenticate(token)
+
+	err = file.RecordLastUsed(registry.LastUsed())
+	if err != nil {
+		t.Fatalf("RecordLastUsed failed: %v", err)
+	}
+
+	records, err := file.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if records[0].LastUsed.IsZero() {
+		t.Error("expected last-used time to be recorded")
+	}
+}
+
+func TestTokenFileConcurrentWritersKeepEveryChange(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	revoked, _, err := auth.NewTokenFile(path).Create("old", []string{"alice"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	const writers = 8
+
+	var wg sync.WaitGroup
+
+	for range writers {
+		wg.Go(func() {
+			_, _, err := auth.NewTokenFile(path).Create("laptop", []string{"alice"})
+			if err != nil {
+				t.Errorf("Create failed: %v", err)
+			}
+		})
+
+		wg.Go(func() {
+			err := auth.NewTokenFile(path).RecordLastUsed(map[string]time.Time{auth.HashToken(revoked): time.Now()})
+			if err != nil {
+				t.Errorf("RecordLastUsed failed: %v", err)
+			}
+		})
+	}
+
+	wg.Go(func() {
+		err := auth.NewTokenFile(path).Revoke(auth.HashToken(revoked)[:12])
+		if err != nil {
+			t.Errorf("Revoke failed: %v", err)
+		}
+	})
+
+	wg.Wait()
+
+	records, err := auth.NewTokenFile(path).Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if len(records) != writers {
+		t.Fatalf("expected %d tokens, got %d", writers, len(records))
+	}
+
+	for _, record := range records {
+		if record.Hash == auth.HashToken(revoked) {
+			t.Error("expected the revoked token to stay revoked")
+		}
+	}
+}
+
+func TestRegistrySyncKeepsRegisteredTokens(t *testing.T) {
+	t.Parallel()
+
+	file := newTokenFile(t)
+	registry := auth.NewRegistry()
+
+	err := registry.Register("shared", auth.AnyClientID)
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	token, record, err := file.Create("laptop", []string{"alice"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	err = file.LoadInto(registry)
+	if err != nil {
+		t.Fatalf("LoadInto failed: %v", err)
+	}
+
+	err = file.Revoke(record.ID)
+	if err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+
+	err = file.LoadInto(registry)
+	if err != nil {
+		t.Fatalf("LoadInto failed: %v", err)
+	}
+
+	if registry.Authenticate(token) {
+		t.Error("expected token removed from the file to be dropped")
+	}
+
+	if !registry.Authenticate("shared") {
+		t.Error("expected the registered shared token to survive a reload")
+	}
+}
+
+func TestTokenFileServeReloadsOnSignal(t *testing.T) {
+	t.Parallel()
+
+	file := newTokenFile(t)
+	registry := auth.NewRegistry()
+	reload := make(chan os.Signal, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go file.Serve(ctx, registry, reload, time.Hour)
+
+	token, _, err := file.Create("laptop", []string{"alice"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	reload <- syscall.SIGHUP
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !registry.Authenticate(token) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected token to be loaded after reload")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
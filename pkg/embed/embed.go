@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sync"
@@ -17,15 +18,77 @@ var (
 	//go:embed templates/index.html
 	indexTemplateSource string
 
-	compileOnce sync.Once
-	compiled    *template.Template
-	errCompile  error
+	//go:embed templates/team.html
+	teamTemplateSource string
+
+	//go:embed templates/notfound.html
+	notFoundTemplateSource string
+
+	//go:embed templates/login.html
+	loginTemplateSource string
+
+	templateFuncs = template.FuncMap{
+		"pathEscape": url.PathEscape,
+	}
+
+	indexTemplate    = &cachedTemplate{name: "index", source: &indexTemplateSource}
+	teamTemplate     = &cachedTemplate{name: "team", source: &teamTemplateSource}
+	notFoundTemplate = &cachedTemplate{name: "notfound", source: &notFoundTemplateSource}
+	loginTemplate    = &cachedTemplate{name: "login", source: &loginTemplateSource}
 )
 
+// cachedTemplate compiles an embedded template once and caches the result.
+type cachedTemplate struct {
+	name   string
+	source *string
+
+	once     sync.Once
+	compiled *template.Template
+	err      error
+}
+
+func (c *cachedTemplate) get() (*template.Template, error) {
+	c.once.Do(func() {
+		c.compiled, c.err = template.New(c.name).Funcs(templateFuncs).Parse(*c.source)
+	})
+
+	if c.err != nil {
+		return nil, fmt.Errorf("failed to compile %s template: %w", c.name, c.err)
+	}
+
+	return c.compiled, nil
+}
+
+// IndexPage is the data rendered by the single-user index template. The
+// timeline is only shown when HistoryURL is set, and the nudge button only
+// when CommandsURL is.
+type IndexPage struct {
+	PublicSiteConfig
+
+	ConfigURL   string
+	EventsURL   string
+	HistoryURL  string
+	CommandsURL string
+}
+
+// NotFoundPage is the data rendered by the 404 template.
+type NotFoundPage struct {
+	Title   string
+	Message string
+}
+
+// LoginPage is the data rendered by the viewer login template.
+type LoginPage struct {
+	Title string
+	Error string
+	Next  string
+}
+
 type Contributor struct {
-	Active bool     `json:"active" yaml:"active"`
-	Focus  string   `json:"focus"  yaml:"focus"`
-	Queue  []string `json:"queue"  yaml:"queue"`
+	Status Status   `json:"status,omitempty" yaml:"status"`
+	Active bool     `json:"active"           yaml:"active"`
+	Focus  string   `json:"focus"            yaml:"focus"`
+	Queue  []string `json:"queue"            yaml:"queue"`
 }
 
 type SlackConfig struct {
@@ -34,6 +97,20 @@ type SlackConfig struct {
 	StatusEmojiActive   string `json:"status_emoji_active"   yaml:"status_emoji_active"`   //nolint:tagliatelle
 	StatusEmojiInactive string `json:"status_emoji_inactive" yaml:"status_emoji_inactive"` //nolint:tagliatelle
 	TTLSeconds          int    `json:"ttl_seconds"           yaml:"ttl_seconds"`           //nolint:tagliatelle
+
+	// StatusEmojis picks the emoji per status. StatusEmojiActive and
+	// StatusEmojiInactive still apply to green and red when it is unset.
+	StatusEmojis map[Status]string `json:"status_emojis,omitempty" yaml:"status_emojis"` //nolint:tagliatelle
+
+	// SnoozeOnRed turns on Do Not Disturb while the light is red: until the
+	// focus block or override that made it red ends, or else for
+	// SnoozeMinutes (the status TTL when unset). EndSnoozeOnGreen turns it
+	// off when the light goes green. SetPresence shows the user as away in
+	// Slack while the light is red or away, and lets Slack decide otherwise.
+	SnoozeOnRed      bool `json:"snooze_on_red,omitempty"       yaml:"snooze_on_red"`       //nolint:tagliatelle
+	SnoozeMinutes    int  `json:"snooze_minutes,omitempty"      yaml:"snooze_minutes"`      //nolint:tagliatelle
+	EndSnoozeOnGreen bool `json:"end_snooze_on_green,omitempty" yaml:"end_snooze_on_green"` //nolint:tagliatelle
+	SetPresence      bool `json:"set_presence,omitempty"        yaml:"set_presence"`        //nolint:tagliatelle
 }
 
 type SiteConfig struct {
@@ -42,19 +119,60 @@ type SiteConfig struct {
 	User        string      `json:"user"        yaml:"user"`
 	Contributor Contributor `json:"contributor" yaml:"contributor"`
 	Slack       SlackConfig `json:"slack"       yaml:"slack"`
+
+	Statuses map[Status]StatusStyle `json:"statuses,omitempty" yaml:"statuses"`
+	Schedule *Schedule              `json:"schedule,omitempty" yaml:"schedule"`
+	Override *Override              `json:"override,omitempty" yaml:"override"`
+}
+
+// PublicSiteConfig is the part of a SiteConfig that is safe to show viewers.
+// It has no Slack settings, which carry the user's token; read endpoints must
+// only ever serve this type.
+type PublicSiteConfig struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	User        string      `json:"user"`
+	Contributor Contributor `json:"contributor"`
+
+	Statuses map[Status]StatusStyle `json:"statuses"`
+}
+
+// Public returns the view of the config that may leave the server. The
+// contributor always carries both status and active, and every status has
+// its label and color filled in.
+func (c SiteConfig) Public() PublicSiteConfig {
+	return PublicSiteConfig{
+		Name:        c.Name,
+		Description: c.Description,
+		User:        c.User,
+		Contributor: c.Contributor.normalized(),
+		Statuses:    c.StatusStyles(),
+	}
+}
+
+// Style returns how the contributor's current status is shown.
+func (c PublicSiteConfig) Style() StatusStyle {
+	return c.Statuses[c.Contributor.State()]
 }
 
 // GetTemplate returns the compiled index template, using sync.Once for caching.
 func GetTemplate() (*template.Template, error) {
-	compileOnce.Do(func() {
-		compiled, errCompile = template.New("index").Parse(indexTemplateSource)
-	})
+	return indexTemplate.get()
+}
 
-	if errCompile != nil {
-		return nil, fmt.Errorf("failed to compile template: %w", errCompile)
-	}
+// GetTeamTemplate returns the compiled team board template, using sync.Once for caching.
+func GetTeamTemplate() (*template.Template, error) {
+	return teamTemplate.get()
+}
+
+// GetNotFoundTemplate returns the compiled 404 template, using sync.Once for caching.
+func GetNotFoundTemplate() (*template.Template, error) {
+	return notFoundTemplate.get()
+}
 
-	return compiled, nil
+// GetLoginTemplate returns the compiled viewer login template, using sync.Once for caching.
+func GetLoginTemplate() (*template.Template, error) {
+	return loginTemplate.get()
 }
 
 func LoadSiteConfig(path string) (SiteConfig, error) {
@@ -73,6 +191,13 @@ func LoadSiteConfig(path string) (SiteConfig, error) {
 		return SiteConfig{}, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	err = cfg.Validate()
+	if err != nil {
+		return SiteConfig{}, fmt.Errorf("invalid config: %w", err)
+	}
+
+	cfg.Contributor = cfg.Contributor.normalized()
+
 	return cfg, nil
 }
 
@@ -89,7 +214,7 @@ func Index(configPath string) ([]byte, error) {
 
 	var buf bytes.Buffer
 
-	err = tmpl.Execute(&buf, cfg)
+	err = tmpl.Execute(&buf, IndexPage{PublicSiteConfig: cfg.Public(), ConfigURL: "/config", EventsURL: "/events"})
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute template: %w", err)
 	}
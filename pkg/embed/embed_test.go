@@ -1,8 +1,10 @@
 package embed_test
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/benwsapp/rlgl/pkg/embed"
@@ -236,3 +238,87 @@ func TestContributorStruct(t *testing.T) {
 		t.Errorf("expected 3 items, got %d", len(contrib.Queue))
 	}
 }
+
+func TestGetTeamTemplate(t *testing.T) {
+	t.Parallel()
+
+	tmpl1, err := embed.GetTeamTemplate()
+	if err != nil {
+		t.Fatalf("expected no error on first call, got %v", err)
+	}
+
+	tmpl2, err := embed.GetTeamTemplate()
+	if err != nil {
+		t.Fatalf("expected no error on second call, got %v", err)
+	}
+
+	if tmpl1 != tmpl2 {
+		t.Error("expected same template instance from cache")
+	}
+}
+
+func TestGetNotFoundTemplate(t *testing.T) {
+	t.Parallel()
+
+	tmpl, err := embed.GetNotFoundTemplate()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var buf strings.Builder
+
+	err = tmpl.Execute(&buf, embed.NotFoundPage{Title: "Not Found", Message: "missing <client>"})
+	if err != nil {
+		t.Fatalf("failed to execute template: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "missing &lt;client&gt;") {
+		t.Error("expected escaped message in 404 page")
+	}
+}
+
+func TestGetLoginTemplate(t *testing.T) {
+	t.Parallel()
+
+	tmpl, err := embed.GetLoginTemplate()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var buf strings.Builder
+
+	err = tmpl.Execute(&buf, embed.LoginPage{Title: "Sign In", Error: "Wrong password.", Next: "/u/alice"})
+	if err != nil {
+		t.Fatalf("failed to execute template: %v", err)
+	}
+
+	for _, want := range []string{"Wrong password.", `value="/u/alice"`, `name="password"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected login page to contain %q", want)
+		}
+	}
+}
+
+func TestSiteConfigPublicDropsSlackSettings(t *testing.T) {
+	t.Parallel()
+
+	cfg := embed.SiteConfig{
+		Name:        "Site",
+		User:        "alice",
+		Contributor: embed.Contributor{Active: true, Focus: "review"},
+		Slack:       embed.SlackConfig{Enabled: true, UserToken: "xoxp-secret"},
+	}
+
+	payload, err := json.Marshal(cfg.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal public config: %v", err)
+	}
+
+	if strings.Contains(string(payload), "xoxp-") || strings.Contains(string(payload), "slack") {
+		t.Errorf("expected no Slack settings, got %s", payload)
+	}
+
+	if public := cfg.Public(); public.Name != "Site" || !public.Contributor.Active {
+		t.Errorf("expected public fields to be kept, got %+v", public)
+	}
+}
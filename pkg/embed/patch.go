@@ -0,0 +1,106 @@
+package embed
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidPatch = errors.New("invalid merge patch")
+
+// MergePatch returns the config with an RFC 7396 JSON merge patch applied:
+// objects in the patch are merged field by field, null removes a field and
+// anything else, arrays included, replaces it. Fields the config does not
+// have are rejected, so a misspelt key fails instead of being ignored. The
+// result is not validated.
+//
+// A patch that sets contributor.active without a status clears the stored
+// status, as the status would otherwise win over the flag being flipped.
+func (c SiteConfig) MergePatch(patch []byte) (SiteConfig, error) {
+	var patchValue any
+
+	err := json.Unmarshal(patch, &patchValue)
+	if err != nil {
+		return SiteConfig{}, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+
+	patchObject, ok := patchValue.(map[string]any)
+	if !ok {
+		return SiteConfig{}, fmt.Errorf("%w: patch must be a JSON object", ErrInvalidPatch)
+	}
+
+	current, err := json.Marshal(c)
+	if err != nil {
+		return SiteConfig{}, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	var target map[string]any
+
+	err = json.Unmarshal(current, &target)
+	if err != nil {
+		return SiteConfig{}, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	contributor, ok := target["contributor"].(map[string]any)
+	if ok && flipsActive(patchObject) {
+		delete(contributor, "status")
+	}
+
+	merged, err := json.Marshal(mergeJSON(target, patchObject))
+	if err != nil {
+		return SiteConfig{}, fmt.Errorf("failed to marshal patched config: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+
+	var patched SiteConfig
+
+	err = decoder.Decode(&patched)
+	if err != nil {
+		return SiteConfig{}, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+
+	return patched, nil
+}
+
+// mergeJSON applies patch to target as RFC 7396 describes. Both are decoded
+// JSON; target may be modified.
+func mergeJSON(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any, len(patchObject))
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+
+			continue
+		}
+
+		targetObject[key] = mergeJSON(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+// flipsActive reports whether patch sets contributor.active but leaves
+// contributor.status alone.
+func flipsActive(patch map[string]any) bool {
+	contributor, ok := patch["contributor"].(map[string]any)
+	if !ok {
+		return false
+	}
+
+	_, setsActive := contributor["active"]
+	_, setsStatus := contributor["status"]
+
+	return setsActive && !setsStatus
+}
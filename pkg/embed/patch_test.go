@@ -0,0 +1,74 @@
+package embed_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+)
+
+func TestMergePatch(t *testing.T) {
+	t.Parallel()
+
+	config := embed.SiteConfig{
+		Name:        "Alice",
+		Description: "Backend",
+		Contributor: embed.Contributor{Status: embed.StatusGreen, Focus: "reviews", Queue: []string{"a"}},
+		Slack:       embed.SlackConfig{Enabled: true, UserToken: "xoxp-secret"},
+	}
+
+	patched, err := config.MergePatch([]byte(`{"description":null,"contributor":{"focus":"deploy","queue":["a","b"]}}`))
+	if err != nil {
+		t.Fatalf("failed to apply patch: %v", err)
+	}
+
+	if patched.Name != "Alice" || patched.Description != "" || patched.Contributor.Focus != "deploy" {
+		t.Errorf("expected name kept, description removed and focus replaced, got %+v", patched)
+	}
+
+	if !slices.Equal(patched.Contributor.Queue, []string{"a", "b"}) || patched.Contributor.State() != embed.StatusGreen {
+		t.Errorf("expected the queue replaced and the status kept, got %+v", patched.Contributor)
+	}
+
+	if patched.Slack.UserToken != "xoxp-secret" {
+		t.Error("expected untouched Slack settings to be kept")
+	}
+
+	if config.Contributor.Focus != "reviews" {
+		t.Error("expected the original config to be left alone")
+	}
+}
+
+func TestMergePatchFlipsActive(t *testing.T) {
+	t.Parallel()
+
+	config := embed.SiteConfig{Contributor: embed.Contributor{Status: embed.StatusGreen, Active: true}}
+
+	patched, err := config.MergePatch([]byte(`{"contributor":{"active":false}}`))
+	if err != nil {
+		t.Fatalf("failed to apply patch: %v", err)
+	}
+
+	if patched.Contributor.State() != embed.StatusRed {
+		t.Errorf("expected flipping active to turn the light red, got %s", patched.Contributor.State())
+	}
+}
+
+func TestMergePatchRejectsInvalidPatches(t *testing.T) {
+	t.Parallel()
+
+	for _, patch := range []string{
+		``,
+		`{"name":`,
+		`["name"]`,
+		`null`,
+		`{"nmae":"typo"}`,
+		`{"contributor":{"status":5}}`,
+	} {
+		_, err := embed.SiteConfig{}.MergePatch([]byte(patch))
+		if !errors.Is(err, embed.ErrInvalidPatch) {
+			t.Errorf("expected ErrInvalidPatch for %q, got %v", patch, err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package embed
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	// The release image is built FROM scratch, so schedules need the
+	// timezone database compiled in.
+	_ "time/tzdata"
+)
+
+const (
+	minutesPerHour = 60
+	minutesPerDay  = 24 * minutesPerHour
+)
+
+var (
+	ErrInvalidWeekday   = errors.New("invalid weekday")
+	ErrInvalidTimeOfDay = errors.New("invalid time of day")
+	ErrEmptyWindow      = errors.New("window starts and ends at the same time")
+	ErrUnknownTimezone  = errors.New("unknown timezone")
+)
+
+// Weekday is a day of the week, written as "mon" to "sun".
+type Weekday time.Weekday
+
+// UnmarshalText accepts a weekday name or its three-letter abbreviation.
+func (d *Weekday) UnmarshalText(text []byte) error {
+	name := strings.ToLower(string(text))
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			*d = Weekday(day)
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrInvalidWeekday, text)
+}
+
+func (d Weekday) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(time.Weekday(d).String()[:3])), nil
+}
+
+// TimeOfDay is a wall-clock time in minutes since midnight, written as
+// "HH:MM". "24:00" is allowed so a window can end at midnight.
+type TimeOfDay int
+
+func (t *TimeOfDay) UnmarshalText(text []byte) error {
+	hours, minutes, ok := strings.Cut(string(text), ":")
+	if !ok {
+		return fmt.Errorf("%w: %q (want HH:MM)", ErrInvalidTimeOfDay, text)
+	}
+
+	hour, hourOK := parseTwoDigits(hours)
+	minute, minuteOK := parseTwoDigits(minutes)
+
+	value := hour*minutesPerHour + minute
+	if !hourOK || !minuteOK || minute >= minutesPerHour || value > minutesPerDay {
+		return fmt.Errorf("%w: %q (want HH:MM)", ErrInvalidTimeOfDay, text)
+	}
+
+	*t = TimeOfDay(value)
+
+	return nil
+}
+
+func (t TimeOfDay) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "%02d:%02d", int(t)/minutesPerHour, int(t)%minutesPerHour), nil
+}
+
+// Window is a daily span of time on some days of the week; no days means
+// every day. A window that ends before it starts runs past midnight and
+// belongs to the day it starts on.
+type Window struct {
+	Days   []Weekday `json:"days,omitempty"   yaml:"days"`
+	Start  TimeOfDay `json:"start"            yaml:"start"`
+	End    TimeOfDay `json:"end"              yaml:"end"`
+	Status Status    `json:"status,omitempty" yaml:"status"`
+}
+
+// Schedule changes a contributor's light automatically. Outside working
+// hours the light is AfterHours (red by default), at lunch it is the lunch
+// window's status (away by default) and in a focus block it is the block's
+// status (red by default). The rest of the time the contributor's own status
+// shows. The status of the working hours window itself is not used.
+type Schedule struct {
+	Timezone     string   `json:"timezone,omitempty"     yaml:"timezone"`
+	WorkingHours *Window  `json:"workingHours,omitempty" yaml:"working_hours"` //nolint:tagliatelle
+	AfterHours   Status   `json:"afterHours,omitempty"   yaml:"after_hours"`   //nolint:tagliatelle
+	Lunch        *Window  `json:"lunch,omitempty"        yaml:"lunch"`
+	FocusBlocks  []Window `json:"focusBlocks,omitempty"  yaml:"focus_blocks"` //nolint:tagliatelle
+}
+
+// Override sets the light by hand, ahead of any schedule, until it expires.
+// An override without Until lasts until it is removed from the config.
+type Override struct {
+	Status Status    `json:"status"          yaml:"status"`
+	Until  time.Time `json:"until,omitzero"  yaml:"until"`
+}
+
+// Location returns the schedule's timezone, or the local one if unset.
+func (s Schedule) Location() *time.Location {
+	// LoadLocation("") means UTC, not the machine's zone.
+	if s.Timezone == "" {
+		return time.Local
+	}
+
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Local
+	}
+
+	return location
+}
+
+func (s Schedule) validate() error {
+	_, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrUnknownTimezone, s.Timezone)
+	}
+
+	err = validateStatus(s.AfterHours)
+	if err != nil {
+		return err
+	}
+
+	windows := slices.Clone(s.FocusBlocks)
+
+	if s.WorkingHours != nil {
+		windows = append(windows, *s.WorkingHours)
+	}
+
+	if s.Lunch != nil {
+		windows = append(windows, *s.Lunch)
+	}
+
+	for _, window := range windows {
+		err = window.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseTwoDigits(text string) (int, bool) {
+	if len(text) != 2 || text[0] < '0' || text[0] > '9' || text[1] < '0' || text[1] > '9' {
+		return 0, false
+	}
+
+	return int(text[0]-'0')*10 + int(text[1]-'0'), true //nolint:mnd
+}
+
+func (w Window) validate() error {
+	if w.Start == w.End {
+		return ErrEmptyWindow
+	}
+
+	return validateStatus(w.Status)
+}
+
+// validateStatus accepts a known status, or none for the default.
+func validateStatus(status Status) error {
+	if status != "" && !status.Valid() {
+		return fmt.Errorf("%w: %q", ErrUnknownStatus, status)
+	}
+
+	return nil
+}
+
+func (o Override) validate() error {
+	if !o.Status.Valid() {
+		return fmt.Errorf("%w in override: %q", ErrUnknownStatus, o.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package embed_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+)
+
+func TestLoadSiteConfigSchedule(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := loadConfig(t, `contributor:
+  status: green
+schedule:
+  timezone: Europe/London
+  working_hours:
+    days: [mon, tue, Wednesday]
+    start: "09:00"
+    end: "17:30"
+  after_hours: away
+  lunch:
+    start: "12:00"
+    end: "13:00"
+  focus_blocks:
+    - start: "22:00"
+      end: "24:00"
+      status: yellow
+override:
+  status: red
+  until: 2026-10-16T18:00:00Z
+`)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	hours := cfg.Schedule.WorkingHours
+	if len(hours.Days) != 3 || hours.Days[2] != embed.Weekday(time.Wednesday) {
+		t.Errorf("unexpected days: %v", hours.Days)
+	}
+
+	if hours.Start != 9*60 || hours.End != 17*60+30 || cfg.Schedule.FocusBlocks[0].End != 24*60 {
+		t.Errorf("unexpected times: %+v", cfg.Schedule)
+	}
+
+	if cfg.Schedule.Location().String() != "Europe/London" {
+		t.Errorf("unexpected location: %s", cfg.Schedule.Location())
+	}
+
+	if !cfg.Override.Until.Equal(time.Date(2026, time.October, 16, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected override: %+v", cfg.Override)
+	}
+}
+
+func TestScheduleLocationDefaultsToLocal(t *testing.T) {
+	t.Parallel()
+
+	if location := (embed.Schedule{}).Location(); location != time.Local {
+		t.Errorf("expected the local timezone, got %s", location)
+	}
+}
+
+func TestLoadSiteConfigRejectsBadSchedules(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		content  string
+		expected error
+	}{
+		{"schedule:\n  timezone: Mars/Olympus\n", embed.ErrUnknownTimezone},
+		{"schedule:\n  lunch: {start: \"12:00\", end: \"12:00\"}\n", embed.ErrEmptyWindow},
+		{"schedule:\n  lunch: {start: \"12:60\", end: \"13:00\"}\n", embed.ErrInvalidTimeOfDay},
+		{"schedule:\n  lunch: {start: \"9:00\", end: \"13:00\"}\n", embed.ErrInvalidTimeOfDay},
+		{"schedule:\n  lunch: {days: [someday], start: \"12:00\", end: \"13:00\"}\n", embed.ErrInvalidWeekday},
+		{"schedule:\n  after_hours: purple\n", embed.ErrUnknownStatus},
+		{"override:\n  until: 2026-10-16T18:00:00Z\n", embed.ErrUnknownStatus},
+	}
+
+	for _, tt := range tests {
+		_, err := loadConfig(t, tt.content)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.content, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package embed
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Status is the light a contributor shows.
+type Status string
+
+const (
+	// StatusGreen means available: go ahead and interrupt.
+	StatusGreen Status = "green"
+	// StatusYellow means heads-down but interruptible if it matters.
+	StatusYellow Status = "yellow"
+	// StatusRed means busy: do not interrupt.
+	StatusRed Status = "red"
+	// StatusAway means away or offline.
+	StatusAway Status = "away"
+)
+
+var (
+	ErrUnknownStatus = errors.New("unknown status")
+	ErrInvalidColor  = errors.New("invalid status color")
+)
+
+// Statuses lists every status, from most to least available.
+var Statuses = []Status{StatusGreen, StatusYellow, StatusRed, StatusAway}
+
+// colorPattern accepts hex colors and CSS color keywords. Anything richer
+// could break out of the style attribute it is rendered into.
+var colorPattern = regexp.MustCompile(`^(#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})|[a-zA-Z]+)$`)
+
+var defaultStatusLabels = map[Status]string{
+	StatusGreen:  "Green light",
+	StatusYellow: "Yellow light",
+	StatusRed:    "Red light",
+	StatusAway:   "Away",
+}
+
+// StatusStyle is how a status is shown on the dashboard. An empty Color
+// keeps the dashboard's own color for that status.
+type StatusStyle struct {
+	Label string `json:"label"           yaml:"label"`
+	Color string `json:"color,omitempty" yaml:"color"`
+}
+
+// Valid reports whether s is one of the known statuses.
+func (s Status) Valid() bool {
+	_, ok := defaultStatusLabels[s]
+
+	return ok
+}
+
+// Rank orders statuses from most (0) to least available.
+func (s Status) Rank() int {
+	for rank, status := range Statuses {
+		if status == s {
+			return rank
+		}
+	}
+
+	return len(Statuses)
+}
+
+// State returns the contributor's status. Configs written before statuses
+// existed only set Active, which maps to green or red.
+func (c Contributor) State() Status {
+	if c.Status != "" {
+		return c.Status
+	}
+
+	if c.Active {
+		return StatusGreen
+	}
+
+	return StatusRed
+}
+
+// WithStatus returns the contributor showing status.
+func (c Contributor) WithStatus(status Status) Contributor {
+	c.Status = status
+
+	return c.normalized()
+}
+
+// normalized sets both Status and Active, so readers that only know about
+// Active still see a sensible light. Status wins when both are set.
+func (c Contributor) normalized() Contributor {
+	c.Status = c.State()
+	c.Active = c.Status == StatusGreen
+
+	return c
+}
+
+// StatusStyles returns the style of every status, with the configured labels
+// and colors laid over the defaults.
+func (c SiteConfig) StatusStyles() map[Status]StatusStyle {
+	styles := make(map[Status]StatusStyle, len(Statuses))
+
+	for _, status := range Statuses {
+		style := c.Statuses[status]
+		if style.Label == "" {
+			style.Label = defaultStatusLabels[status]
+		}
+
+		styles[status] = style
+	}
+
+	return styles
+}
+
+// Validate rejects unknown statuses, colors that are not safe to render and
+// schedules that cannot be followed.
+func (c SiteConfig) Validate() error {
+	if !c.Contributor.State().Valid() {
+		return fmt.Errorf("%w: %q", ErrUnknownStatus, c.Contributor.Status)
+	}
+
+	err := validateStyles(c.Statuses)
+	if err != nil {
+		return err
+	}
+
+	if c.Schedule != nil {
+		err = c.Schedule.validate()
+		if err != nil {
+			return fmt.Errorf("invalid schedule: %w", err)
+		}
+	}
+
+	if c.Override != nil {
+		return c.Override.validate()
+	}
+
+	return nil
+}
+
+func validateStyles(styles map[Status]StatusStyle) error {
+	for status, style := range styles {
+		if !status.Valid() {
+			return fmt.Errorf("%w: %q", ErrUnknownStatus, status)
+		}
+
+		if style.Color != "" && !colorPattern.MatchString(style.Color) {
+			return fmt.Errorf("%w for %s: %q", ErrInvalidColor, status, style.Color)
+		}
+	}
+
+	return nil
+}
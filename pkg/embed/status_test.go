@@ -0,0 +1,125 @@
+package embed_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+)
+
+func loadConfig(t *testing.T, content string) (embed.SiteConfig, error) {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "site.yaml")
+
+	err := os.WriteFile(configPath, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	return embed.LoadSiteConfig(configPath)
+}
+
+func TestContributorStateFallsBackToActive(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		contributor embed.Contributor
+		expected    embed.Status
+	}{
+		{embed.Contributor{Active: true}, embed.StatusGreen},
+		{embed.Contributor{Active: false}, embed.StatusRed},
+		{embed.Contributor{Status: embed.StatusYellow}, embed.StatusYellow},
+		{embed.Contributor{Status: embed.StatusAway, Active: true}, embed.StatusAway},
+	}
+
+	for _, tt := range tests {
+		if got := tt.contributor.State(); got != tt.expected {
+			t.Errorf("%+v: expected %s, got %s", tt.contributor, tt.expected, got)
+		}
+	}
+}
+
+func TestLoadSiteConfigLegacyActive(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := loadConfig(t, "contributor:\n  active: true\n")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if cfg.Contributor.Status != embed.StatusGreen || !cfg.Contributor.Active {
+		t.Errorf("expected active: true to load as green, got %+v", cfg.Contributor)
+	}
+}
+
+func TestLoadSiteConfigStatus(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := loadConfig(t, `contributor:
+  status: yellow
+statuses:
+  yellow:
+    label: "Heads down"
+    color: "#f59e0b"
+`)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if cfg.Contributor.Status != embed.StatusYellow || cfg.Contributor.Active {
+		t.Errorf("expected yellow and not active, got %+v", cfg.Contributor)
+	}
+
+	style := cfg.Public().Style()
+	if style.Label != "Heads down" || style.Color != "#f59e0b" {
+		t.Errorf("expected configured style, got %+v", style)
+	}
+}
+
+func TestLoadSiteConfigRejectsBadStatuses(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		content  string
+		expected error
+	}{
+		{"contributor:\n  status: purple\n", embed.ErrUnknownStatus},
+		{"statuses:\n  purple:\n    label: Purple\n", embed.ErrUnknownStatus},
+		{"statuses:\n  red:\n    color: \"red; background: url(x)\"\n", embed.ErrInvalidColor},
+	}
+
+	for _, tt := range tests {
+		_, err := loadConfig(t, tt.content)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.content, tt.expected, err)
+		}
+	}
+}
+
+func TestPublicFillsStatusStyles(t *testing.T) {
+	t.Parallel()
+
+	cfg := embed.SiteConfig{
+		Contributor: embed.Contributor{Active: true},
+		Statuses:    map[embed.Status]embed.StatusStyle{embed.StatusAway: {Color: "gray"}},
+	}
+
+	public := cfg.Public()
+
+	if public.Contributor.Status != embed.StatusGreen {
+		t.Errorf("expected public status green, got %s", public.Contributor.Status)
+	}
+
+	for _, status := range embed.Statuses {
+		if public.Statuses[status].Label == "" {
+			t.Errorf("expected a default label for %s", status)
+		}
+	}
+
+	if away := public.Statuses[embed.StatusAway]; away.Label != "Away" || away.Color != "gray" {
+		t.Errorf("expected default label with configured color, got %+v", away)
+	}
+}
@@ -0,0 +1,342 @@
+// Package metrics is a small implementation of the Prometheus text exposition
+// format: counters, gauges and histograms with labels, and a handler that
+// serves them. It covers what the server needs without pulling in the
+// Prometheus client library.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text format version served by Handler.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector is a metric family that can write itself in the text format.
+type Collector interface {
+	Write(buf *bytes.Buffer)
+}
+
+// Registry is a set of collectors served together.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// Default is the registry the New* constructors register with.
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// Write writes every collector, followed by extra.
+func (r *Registry) Write(buf *bytes.Buffer, extra ...Collector) {
+	r.mu.Lock()
+	collectors := append(slices.Clone(r.collectors), extra...)
+	r.mu.Unlock()
+
+	for _, collector := range collectors {
+		collector.Write(buf)
+	}
+}
+
+// Handler serves the registry, plus extra collectors that only make sense
+// per handler, such as ones reading from a particular store.
+func (r *Registry) Handler(extra ...Collector) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, _ *http.Request) {
+		var buf bytes.Buffer
+
+		r.Write(&buf, extra...)
+
+		responseWriter.Header().Set("Content-Type", ContentType)
+
+		_, err := responseWriter.Write(buf.Bytes())
+		if err != nil {
+			slog.Error("failed writing metrics", "error", err)
+		}
+	}
+}
+
+// family is the name, help and label names shared by a metric's series.
+type family struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+}
+
+func (f family) writeHeader(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+}
+
+// writeSample writes one line; extra is an additional label such as le.
+func (f family) writeSample(buf *bytes.Buffer, suffix string, labelValues []string, extra string, value float64) {
+	buf.WriteString(f.name)
+	buf.WriteString(suffix)
+
+	pairs := make([]string, 0, len(labelValues)+1)
+	for i, labelValue := range labelValues {
+		pairs = append(pairs, f.labelNames[i]+`="`+escapeLabelValue(labelValue)+`"`)
+	}
+
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+
+	if len(pairs) > 0 {
+		buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+
+	buf.WriteString(" " + formatValue(value) + "\n")
+}
+
+// seriesKey joins label values into a map key. The separator cannot appear
+// in valid UTF-8 label values.
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+// series is one combination of label values and its value.
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+// valueVec holds one float per combination of label values.
+type valueVec struct {
+	family
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newValueVec(kind, name, help string, labelNames []string) *valueVec {
+	return &valueVec{
+		family: family{name: name, help: help, kind: kind, labelNames: labelNames},
+		series: make(map[string]*series),
+	}
+}
+
+func (v *valueVec) update(labelValues []string, change func(value float64) float64) {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labelNames), len(labelValues)))
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key := seriesKey(labelValues)
+
+	entry, ok := v.series[key]
+	if !ok {
+		entry = &series{labelValues: slices.Clone(labelValues)}
+		v.series[key] = entry
+	}
+
+	entry.value = change(entry.value)
+}
+
+func (v *valueVec) add(delta float64, labelValues []string) {
+	v.update(labelValues, func(value float64) float64 { return value + delta })
+}
+
+func (v *valueVec) Write(buf *bytes.Buffer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.writeHeader(buf)
+
+	// A metric without labels is always shown, even before its first update.
+	if len(v.labelNames) == 0 && len(v.series) == 0 {
+		v.writeSample(buf, "", nil, "", 0)
+
+		return
+	}
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		v.writeSample(buf, "", v.series[key].labelValues, "", v.series[key].value)
+	}
+}
+
+// CounterVec is a counter per combination of label values. Without label
+// names it is a single counter.
+type CounterVec struct {
+	*valueVec
+}
+
+// NewCounterVec returns a counter registered with Default.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	counter := &CounterVec{newValueVec("counter", name, help, labelNames)}
+	Default.Register(counter)
+
+	return counter
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// GaugeVec is a gauge per combination of label values. Without label names
+// it is a single gauge.
+type GaugeVec struct {
+	*valueVec
+}
+
+// NewGaugeVec returns a gauge registered with Default.
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	gauge := &GaugeVec{newValueVec("gauge", name, help, labelNames)}
+	Default.Register(gauge)
+
+	return gauge
+}
+
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.add(1, labelValues)
+}
+
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.add(-1, labelValues)
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 { return value })
+}
+
+// Sample is one series of a GaugeFunc.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// GaugeFunc is a gauge whose series are computed on every scrape.
+type GaugeFunc struct {
+	family
+
+	collect func() []Sample
+}
+
+// NewGaugeFunc returns a gauge computed by collect. It is not registered, as
+// collect usually reads from something only its caller has.
+func NewGaugeFunc(name, help string, labelNames []string, collect func() []Sample) *GaugeFunc {
+	return &GaugeFunc{
+		family:  family{name: name, help: help, kind: "gauge", labelNames: labelNames},
+		collect: collect,
+	}
+}
+
+func (g *GaugeFunc) Write(buf *bytes.Buffer) {
+	samples := g.collect()
+	slices.SortFunc(samples, func(a, b Sample) int {
+		return slices.Compare(a.LabelValues, b.LabelValues)
+	})
+
+	g.writeHeader(buf)
+
+	for _, sample := range samples {
+		g.writeSample(buf, "", sample.LabelValues, "", sample.Value)
+	}
+}
+
+// DefaultBuckets suit latencies of calls to other services, in seconds.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	family
+
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram returns a histogram registered with Default. buckets are the
+// upper bounds, in increasing order; +Inf is implied.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	histogram := &Histogram{
+		family:  family{name: name, help: help, kind: "histogram"},
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+	Default.Register(histogram)
+
+	return histogram
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += value
+	h.count++
+}
+
+func (h *Histogram) Write(buf *bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(buf)
+
+	for i, bound := range h.buckets {
+		h.writeSample(buf, "_bucket", nil, `le="`+formatValue(bound)+`"`, float64(h.counts[i]))
+	}
+
+	h.writeSample(buf, "_bucket", nil, `le="+Inf"`, float64(h.count))
+	h.writeSample(buf, "_sum", nil, "", h.sum)
+	h.writeSample(buf, "_count", nil, "", float64(h.count))
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
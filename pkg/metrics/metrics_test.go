@@ -0,0 +1,115 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benwsapp/rlgl/pkg/metrics"
+)
+
+func write(collector metrics.Collector) string {
+	var buf bytes.Buffer
+
+	collector.Write(&buf)
+
+	return buf.String()
+}
+
+func TestCounterVecWritesSortedSeries(t *testing.T) {
+	t.Parallel()
+
+	counter := metrics.NewCounterVec("test_requests_total", "Requests, by path.\nSecond line.", "path")
+	counter.Inc("/b")
+	counter.Inc("/a")
+	counter.Inc("/a")
+	counter.Inc(`say "hi"\`)
+
+	want := `# HELP test_requests_total Requests, by path.\nSecond line.
+# TYPE test_requests_total counter
+test_requests_total{path="/a"} 2
+test_requests_total{path="/b"} 1
+test_requests_total{path="say \"hi\"\\"} 1
+`
+	if got := write(counter); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGaugeVecWithoutLabelsStartsAtZero(t *testing.T) {
+	t.Parallel()
+
+	gauge := metrics.NewGaugeVec("test_open_streams", "Open streams.")
+
+	if got := write(gauge); !strings.HasSuffix(got, "\ntest_open_streams 0\n") {
+		t.Errorf("expected an unset gauge to read 0, got:\n%s", got)
+	}
+
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+
+	if got := write(gauge); !strings.HasSuffix(got, "\ntest_open_streams 1\n") {
+		t.Errorf("expected the gauge to read 1, got:\n%s", got)
+	}
+
+	gauge.Set(2.5)
+
+	if got := write(gauge); !strings.HasSuffix(got, "\ntest_open_streams 2.5\n") {
+		t.Errorf("expected the gauge to read 2.5, got:\n%s", got)
+	}
+}
+
+func TestHistogramWritesCumulativeBuckets(t *testing.T) {
+	t.Parallel()
+
+	histogram := metrics.NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(3)
+
+	want := `# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 3.55
+test_latency_seconds_count 3
+`
+	if got := write(histogram); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistryHandlerServesExtraCollectors(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	registry.Register(metrics.NewCounterVec("test_registered_total", "Registered."))
+
+	ages := metrics.NewGaugeFunc("test_age_seconds", "Age.", []string{"client_id"}, func() []metrics.Sample {
+		return []metrics.Sample{
+			{LabelValues: []string{"bob"}, Value: 2},
+			{LabelValues: []string{"alice"}, Value: 1},
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	registry.Handler(ages).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got := rec.Header().Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("expected Content-Type %q, got %q", metrics.ContentType, got)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"test_registered_total 0\n",
+		"test_age_seconds{client_id=\"alice\"} 1\ntest_age_seconds{client_id=\"bob\"} 2\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected body to contain %q, got:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package protocol defines the messages clients and the server exchange over
+// the /ws WebSocket, and the hello/welcome handshake that lets each side know
+// what the other understands.
+//
+// A client opens with a hello carrying the newest protocol version it speaks,
+// its own version and its capabilities. The server answers with a welcome
+// carrying the version both will speak and the capabilities they share, or
+// with an error when the client is too old. Clients from before the
+// handshake skip it and are treated as speaking version 0.
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+)
+
+// MessageType says what a message is for.
+type MessageType string
+
+const (
+	// TypeHello opens the handshake, from the client.
+	TypeHello MessageType = "hello"
+	// TypeWelcome accepts a hello, from the server.
+	TypeWelcome MessageType = "welcome"
+	// TypePush replaces the client's config.
+	TypePush MessageType = "push"
+	// TypePatch changes part of the client's config with a merge patch.
+	TypePatch MessageType = "patch"
+	// TypePing asks for a pong, to keep the connection and presence alive.
+	TypePing MessageType = "ping"
+	// TypePong answers a ping.
+	TypePong MessageType = "pong"
+	// TypeAck confirms a push or patch was stored.
+	TypeAck MessageType = "ack"
+	// TypeError rejects a message; Error says why.
+	TypeError MessageType = "error"
+	// TypeCommand is sent by the server unprompted; Command says what it
+	// asks for. Only clients that agreed to CapabilityCommands get them.
+	TypeCommand MessageType = "command"
+)
+
+// Command is what a command message asks of the client.
+type Command string
+
+const (
+	// CommandResync asks the client to push its config again now.
+	CommandResync Command = "resync"
+	// CommandNudge tells the client someone wants its attention; Text may
+	// say who or why.
+	CommandNudge Command = "nudge"
+	// CommandShutdown warns that the server is going away and the
+	// connection is about to close.
+	CommandShutdown Command = "shutdown"
+	// CommandTokenRotated tells the client its token has been rotated or
+	// revoked and the connection is about to close.
+	CommandTokenRotated Command = "token_rotated"
+)
+
+const (
+	// Version is the newest protocol version this build speaks.
+	Version = 1
+	// MinVersion is the oldest protocol version this build accepts from a
+	// peer that takes part in the handshake.
+	MinVersion = 1
+)
+
+// Capability is an optional feature a side supports.
+type Capability string
+
+const (
+	// CapabilityPatch is support for patch messages.
+	CapabilityPatch Capability = "patch"
+	// CapabilityHeartbeat is support for the Interval field, which tells the
+	// server how long a client may go quiet.
+	CapabilityHeartbeat Capability = "heartbeat"
+	// CapabilityCommands is support for command messages from the server.
+	CapabilityCommands Capability = "commands"
+)
+
+// Capabilities lists everything this build supports.
+var Capabilities = []Capability{CapabilityPatch, CapabilityHeartbeat, CapabilityCommands}
+
+// UnknownTypeError is the error text sent in reply to a message type the
+// server does not know. Servers from before the handshake reply to a hello
+// with it.
+const UnknownTypeError = "unknown message type"
+
+var ErrIncompatibleVersion = errors.New("incompatible protocol version")
+
+type Message struct {
+	Type     MessageType       `json:"type"`
+	ClientID string            `json:"clientId"`
+	Config   *embed.SiteConfig `json:"config,omitempty"`
+	Error    string            `json:"error,omitempty"`
+
+	// Interval is the longest the client goes between messages, in seconds.
+	// The server marks it stale after it misses a few.
+	Interval int `json:"interval,omitempty"`
+
+	// Patch is an RFC 7396 JSON merge patch applied to the stored config by
+	// a patch message.
+	Patch json.RawMessage `json:"patch,omitempty"`
+
+	// Command and Text are only set on command messages. Text is a note for
+	// the user, such as who sent a nudge.
+	Command Command `json:"command,omitempty"`
+	Text    string  `json:"text,omitempty"`
+
+	// ProtocolVersion, ClientVersion and Capabilities are only set on hello
+	// and welcome messages.
+	ProtocolVersion int          `json:"protocolVersion,omitempty"`
+	ClientVersion   string       `json:"clientVersion,omitempty"`
+	Capabilities    []Capability `json:"capabilities,omitempty"`
+}
+
+// NewCommand returns a command message for clientID.
+func NewCommand(clientID string, command Command, text string) Message {
+	return Message{Type: TypeCommand, ClientID: clientID, Command: command, Text: text}
+}
+
+// Hello returns the message a client opens the handshake with. clientVersion
+// is the rlgl release it was built from.
+func Hello(clientID, clientVersion string) Message {
+	return Message{
+		Type:            TypeHello,
+		ClientID:        clientID,
+		ProtocolVersion: Version,
+		ClientVersion:   clientVersion,
+		Capabilities:    Capabilities,
+	}
+}
+
+// Welcome answers a hello with the protocol version both sides speak, the
+// older of the two, and the capabilities they share. A client older than
+// MinVersion is refused with ErrIncompatibleVersion.
+func Welcome(hello Message) (Message, error) {
+	if hello.ProtocolVersion < MinVersion {
+		return Message{}, fmt.Errorf(
+			"%w: client speaks version %d, server needs at least %d; upgrade the client",
+			ErrIncompatibleVersion, hello.ProtocolVersion, MinVersion,
+		)
+	}
+
+	return Message{
+		Type:            TypeWelcome,
+		ClientID:        hello.ClientID,
+		ProtocolVersion: min(hello.ProtocolVersion, Version),
+		Capabilities:    Shared(hello.Capabilities),
+	}, nil
+}
+
+// CheckWelcome checks the server's welcome on the client's side, refusing a
+// server older than MinVersion.
+func CheckWelcome(welcome Message) error {
+	if welcome.ProtocolVersion < MinVersion {
+		return fmt.Errorf(
+			"%w: server speaks version %d, client needs at least %d; upgrade the server",
+			ErrIncompatibleVersion, welcome.ProtocolVersion, MinVersion,
+		)
+	}
+
+	return nil
+}
+
+// Shared returns the capabilities in peer that this build also supports.
+func Shared(peer []Capability) []Capability {
+	shared := make([]Capability, 0, len(peer))
+
+	for _, capability := range Capabilities {
+		if slices.Contains(peer, capability) {
+			shared = append(shared, capability)
+		}
+	}
+
+	return shared
+}
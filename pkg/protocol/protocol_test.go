@@ -0,0 +1,49 @@
+package protocol_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/benwsapp/rlgl/pkg/protocol"
+)
+
+func TestWelcomeNegotiates(t *testing.T) {
+	t.Parallel()
+
+	hello := protocol.Hello("alice", "v1.2.3")
+	hello.ProtocolVersion = protocol.Version + 1
+	hello.Capabilities = []protocol.Capability{"teleport", protocol.CapabilityPatch}
+
+	welcome, err := protocol.Welcome(hello)
+	if err != nil {
+		t.Fatalf("expected a newer client to be welcomed, got %v", err)
+	}
+
+	if welcome.Type != protocol.TypeWelcome || welcome.ProtocolVersion != protocol.Version {
+		t.Errorf("expected a welcome at the server's version, got %+v", welcome)
+	}
+
+	if !slices.Equal(welcome.Capabilities, []protocol.Capability{protocol.CapabilityPatch}) {
+		t.Errorf("expected only the shared capabilities, got %v", welcome.Capabilities)
+	}
+
+	err = protocol.CheckWelcome(welcome)
+	if err != nil {
+		t.Errorf("expected the welcome to be accepted, got %v", err)
+	}
+}
+
+func TestWelcomeRefusesOldClients(t *testing.T) {
+	t.Parallel()
+
+	_, err := protocol.Welcome(protocol.Message{Type: protocol.TypeHello, ClientID: "alice"})
+	if !errors.Is(err, protocol.ErrIncompatibleVersion) {
+		t.Errorf("expected ErrIncompatibleVersion for a hello without a version, got %v", err)
+	}
+
+	err = protocol.CheckWelcome(protocol.Message{Type: protocol.TypeWelcome})
+	if !errors.Is(err, protocol.ErrIncompatibleVersion) {
+		t.Errorf("expected ErrIncompatibleVersion for a welcome without a version, got %v", err)
+	}
+}
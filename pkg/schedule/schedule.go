@@ -0,0 +1,141 @@
+// Package schedule works out which light a contributor should show from the
+// schedule and override in their config.
+package schedule
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+)
+
+const minutesPerHour = 60
+
+// Reason says why the scheduler chose a status.
+type Reason string
+
+const (
+	ReasonManual     Reason = "manual"
+	ReasonOverride   Reason = "override"
+	ReasonAfterHours Reason = "after hours"
+	ReasonLunch      Reason = "lunch"
+	ReasonFocusBlock Reason = "focus block"
+)
+
+// Scheduler derives the effective status of a config at the current time.
+type Scheduler struct {
+	clock Clock
+}
+
+func New(clock Clock) *Scheduler {
+	return &Scheduler{clock: clock}
+}
+
+// Status returns the status cfg calls for right now, and why. An unexpired
+// override wins; then the schedule; then the contributor's own status.
+func (s *Scheduler) Status(cfg embed.SiteConfig) (embed.Status, Reason) {
+	status, reason, _ := s.status(cfg)
+
+	return status, reason
+}
+
+// Until returns when the status Status picks for cfg ends by itself: the end
+// of the override, lunch or focus block. It is zero when the status only
+// changes with the config, and after hours.
+func (s *Scheduler) Until(cfg embed.SiteConfig) time.Time {
+	_, _, until := s.status(cfg)
+
+	return until
+}
+
+func (s *Scheduler) status(cfg embed.SiteConfig) (embed.Status, Reason, time.Time) {
+	now := s.clock.Now()
+
+	if cfg.Override != nil && (cfg.Override.Until.IsZero() || now.Before(cfg.Override.Until)) {
+		return cfg.Override.Status, ReasonOverride, cfg.Override.Until
+	}
+
+	if cfg.Schedule == nil {
+		return cfg.Contributor.State(), ReasonManual, time.Time{}
+	}
+
+	return evaluate(*cfg.Schedule, cfg.Contributor.State(), now.In(cfg.Schedule.Location()))
+}
+
+// Apply returns cfg with the contributor showing the status it calls for.
+func (s *Scheduler) Apply(cfg embed.SiteConfig) (embed.SiteConfig, Reason) {
+	status, reason := s.Status(cfg)
+	cfg.Contributor = cfg.Contributor.WithStatus(status)
+
+	return cfg, reason
+}
+
+func evaluate(schedule embed.Schedule, base embed.Status, now time.Time) (embed.Status, Reason, time.Time) {
+	if schedule.WorkingHours != nil && !contains(*schedule.WorkingHours, now) {
+		return cmp.Or(schedule.AfterHours, embed.StatusRed), ReasonAfterHours, time.Time{}
+	}
+
+	if schedule.Lunch != nil && contains(*schedule.Lunch, now) {
+		return cmp.Or(schedule.Lunch.Status, embed.StatusAway), ReasonLunch, windowEnd(schedule, *schedule.Lunch, now)
+	}
+
+	for _, block := range schedule.FocusBlocks {
+		if contains(block, now) {
+			return cmp.Or(block.Status, embed.StatusRed), ReasonFocusBlock, windowEnd(schedule, block, now)
+		}
+	}
+
+	return base, ReasonManual, time.Time{}
+}
+
+// windowEnd returns when window, which contains now, ends, or working hours
+// do if they end first.
+func windowEnd(schedule embed.Schedule, window embed.Window, now time.Time) time.Time {
+	until := end(window, now)
+
+	if schedule.WorkingHours != nil {
+		until = minTime(until, end(*schedule.WorkingHours, now))
+	}
+
+	return until
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+
+	return a
+}
+
+// end returns when window, which contains now, ends.
+func end(window embed.Window, now time.Time) time.Time {
+	day := now.Day()
+
+	minute := embed.TimeOfDay(now.Hour()*minutesPerHour + now.Minute())
+	if window.Start > window.End && minute >= window.Start {
+		day++
+	}
+
+	return time.Date(now.Year(), now.Month(), day, 0, int(window.End), 0, 0, now.Location())
+}
+
+// contains reports whether now falls in window, taking windows that run
+// past midnight as belonging to the day they start on.
+func contains(window embed.Window, now time.Time) bool {
+	minute := embed.TimeOfDay(now.Hour()*minutesPerHour + now.Minute())
+	today := embed.Weekday(now.Weekday())
+
+	if window.Start < window.End {
+		return onDay(window, today) && minute >= window.Start && minute < window.End
+	}
+
+	yesterday := (today + 6) % 7 //nolint:mnd
+
+	return (onDay(window, today) && minute >= window.Start) || (onDay(window, yesterday) && minute < window.End)
+}
+
+func onDay(window embed.Window, day embed.Weekday) bool {
+	return len(window.Days) == 0 || slices.Contains(window.Days, day)
+}
@@ -0,0 +1,198 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/schedule"
+)
+
+func weekdays() []embed.Weekday {
+	return []embed.Weekday{
+		embed.Weekday(time.Monday),
+		embed.Weekday(time.Tuesday),
+		embed.Weekday(time.Wednesday),
+		embed.Weekday(time.Thursday),
+		embed.Weekday(time.Friday),
+	}
+}
+
+func hhmm(hour, minute int) embed.TimeOfDay {
+	return embed.TimeOfDay(hour*60 + minute)
+}
+
+func workdayConfig() embed.SiteConfig {
+	return embed.SiteConfig{
+		Contributor: embed.Contributor{Status: embed.StatusGreen},
+		Schedule: &embed.Schedule{
+			Timezone:     "America/New_York",
+			WorkingHours: &embed.Window{Days: weekdays(), Start: hhmm(9, 0), End: hhmm(17, 0)},
+			Lunch:        &embed.Window{Start: hhmm(12, 0), End: hhmm(13, 0)},
+			FocusBlocks: []embed.Window{
+				{Days: []embed.Weekday{embed.Weekday(time.Tuesday)}, Start: hhmm(14, 0), End: hhmm(16, 0), Status: embed.StatusYellow},
+			},
+		},
+	}
+}
+
+func TestSchedulerFollowsTheWorkday(t *testing.T) {
+	t.Parallel()
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+
+	// Tuesday 6 October 2026, New York time.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, newYork)
+	}
+
+	tests := []struct {
+		now    time.Time
+		status embed.Status
+		reason schedule.Reason
+	}{
+		{at(6, 8, 59), embed.StatusRed, schedule.ReasonAfterHours},
+		{at(6, 9, 0), embed.StatusGreen, schedule.ReasonManual},
+		{at(6, 12, 30), embed.StatusAway, schedule.ReasonLunch},
+		{at(6, 14, 0), embed.StatusYellow, schedule.ReasonFocusBlock},
+		{at(7, 14, 0), embed.StatusGreen, schedule.ReasonManual},
+		{at(6, 17, 0), embed.StatusRed, schedule.ReasonAfterHours},
+		{at(10, 11, 0), embed.StatusRed, schedule.ReasonAfterHours},
+		{at(6, 13, 0).UTC(), embed.StatusGreen, schedule.ReasonManual},
+	}
+
+	clock := schedule.NewFakeClock(time.Time{})
+	scheduler := schedule.New(clock)
+	cfg := workdayConfig()
+
+	for _, tt := range tests {
+		clock.Set(tt.now)
+
+		status, reason := scheduler.Status(cfg)
+		if status != tt.status || reason != tt.reason {
+			t.Errorf("%s: expected %s (%s), got %s (%s)", tt.now, tt.status, tt.reason, status, reason)
+		}
+	}
+}
+
+func TestSchedulerWindowPastMidnight(t *testing.T) {
+	t.Parallel()
+
+	cfg := embed.SiteConfig{
+		Contributor: embed.Contributor{Status: embed.StatusGreen},
+		Schedule: &embed.Schedule{
+			Timezone: "UTC",
+			FocusBlocks: []embed.Window{
+				{Days: []embed.Weekday{embed.Weekday(time.Friday)}, Start: hhmm(22, 0), End: hhmm(2, 0)},
+			},
+		},
+	}
+
+	clock := schedule.NewFakeClock(time.Date(2026, time.October, 9, 23, 0, 0, 0, time.UTC))
+	scheduler := schedule.New(clock)
+
+	if status, _ := scheduler.Status(cfg); status != embed.StatusRed {
+		t.Errorf("expected red late on Friday, got %s", status)
+	}
+
+	if until := scheduler.Until(cfg); !until.Equal(time.Date(2026, time.October, 10, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the block to end on Saturday morning, got %s", until)
+	}
+
+	clock.Advance(2 * time.Hour)
+
+	if status, _ := scheduler.Status(cfg); status != embed.StatusRed {
+		t.Errorf("expected red just after midnight on Saturday, got %s", status)
+	}
+
+	clock.Advance(2 * time.Hour)
+
+	if status, _ := scheduler.Status(cfg); status != embed.StatusGreen {
+		t.Errorf("expected the block to be over, got %s", status)
+	}
+}
+
+func TestSchedulerOverrideWinsUntilExpiry(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.October, 6, 23, 0, 0, 0, time.UTC)
+
+	cfg := workdayConfig()
+	cfg.Override = &embed.Override{Status: embed.StatusGreen, Until: now.Add(time.Hour)}
+
+	clock := schedule.NewFakeClock(now)
+	scheduler := schedule.New(clock)
+
+	applied, reason := scheduler.Apply(cfg)
+	if applied.Contributor.Status != embed.StatusGreen || !applied.Contributor.Active || reason != schedule.ReasonOverride {
+		t.Errorf("expected override to win, got %+v (%s)", applied.Contributor, reason)
+	}
+
+	clock.Advance(time.Hour)
+
+	applied, reason = scheduler.Apply(cfg)
+	if applied.Contributor.Status != embed.StatusRed || applied.Contributor.Active || reason != schedule.ReasonAfterHours {
+		t.Errorf("expected the schedule after the override expired, got %+v (%s)", applied.Contributor, reason)
+	}
+}
+
+func TestSchedulerWithoutScheduleKeepsStatus(t *testing.T) {
+	t.Parallel()
+
+	scheduler := schedule.New(schedule.SystemClock{})
+
+	status, reason := scheduler.Status(embed.SiteConfig{Contributor: embed.Contributor{Active: true}})
+	if status != embed.StatusGreen || reason != schedule.ReasonManual {
+		t.Errorf("expected the contributor's own status, got %s (%s)", status, reason)
+	}
+}
+
+func TestSchedulerUntil(t *testing.T) {
+	t.Parallel()
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, newYork)
+	}
+
+	// The evening block runs past the end of working hours, which end it.
+	cfg := workdayConfig()
+	cfg.Schedule.FocusBlocks = append(cfg.Schedule.FocusBlocks, embed.Window{Start: hhmm(16, 30), End: hhmm(1, 0)})
+
+	tests := []struct {
+		now   time.Time
+		until time.Time
+	}{
+		{at(6, 12, 30), at(6, 13, 0)},
+		{at(6, 14, 59), at(6, 16, 0)},
+		{at(6, 16, 45), at(6, 17, 0)},
+		{at(6, 10, 0), time.Time{}},
+		{at(6, 8, 0), time.Time{}},
+	}
+
+	clock := schedule.NewFakeClock(time.Time{})
+	scheduler := schedule.New(clock)
+
+	for _, tt := range tests {
+		clock.Set(tt.now)
+
+		if until := scheduler.Until(cfg); !until.Equal(tt.until) {
+			t.Errorf("%s: expected the status to last until %s, got %s", tt.now, tt.until, until)
+		}
+	}
+
+	override := at(6, 10, 20)
+	cfg.Override = &embed.Override{Status: embed.StatusRed, Until: override}
+	clock.Set(at(6, 10, 0))
+
+	if until := scheduler.Until(cfg); !until.Equal(override) {
+		t.Errorf("expected an override to last until it expires, got %s", until)
+	}
+}
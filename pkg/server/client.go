@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+const clientIDPathValue = wsserver.ClientIDPathValue
+
+var ErrClientNotFound = errors.New("client not found")
+
+// ClientPath returns the per-client page URL for clientID.
+func ClientPath(clientID string) string {
+	return "/u/" + url.PathEscape(clientID)
+}
+
+// ClientCommandsPath returns the command API URL for clientID.
+func ClientCommandsPath(clientID string) string {
+	return "/api/v1/clients/" + url.PathEscape(clientID) + "/commands"
+}
+
+// ClientIndexHandler renders a single client's status page at /u/{clientID}.
+func ClientIndexHandler(store wsserver.Store) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, req *http.Request) {
+		slog.Info("request received", "method", req.Method, "path", req.URL.Path, "remote_addr", req.RemoteAddr)
+
+		clientID := req.PathValue(clientIDPathValue)
+
+		cfg, ok := store.Get(clientID)
+		if !ok {
+			NotFound(responseWriter, "No one has checked in as "+clientID+".")
+
+			return
+		}
+
+		base := ClientPath(clientID)
+
+		content, err := renderIndex(embed.IndexPage{
+			PublicSiteConfig: cfg.Public(),
+			ConfigURL:        base + "/config",
+			EventsURL:        base + "/events",
+			HistoryURL:       ClientHistoryPath(clientID),
+			CommandsURL:      ClientCommandsPath(clientID),
+		})
+		if err != nil {
+			slog.Error("failed rendering template", "error", err)
+			http.Error(responseWriter, "internal server error", http.StatusInternalServerError)
+
+			return
+		}
+
+		_, writeErr := responseWriter.Write(content)
+		if writeErr != nil {
+			slog.Error("failed writing response", "error", writeErr)
+		}
+	}
+}
+
+// ClientConfigHandler returns a single client's config as JSON.
+func ClientConfigHandler(store wsserver.Store, runtime *wsserver.Runtime) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, req *http.Request) {
+		cfg, ok := store.Get(req.PathValue(clientIDPathValue))
+		if !ok {
+			http.Error(responseWriter, "client not found", http.StatusNotFound)
+
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.Header().Set("Cache-Control", "no-store")
+
+		err := json.NewEncoder(responseWriter).Encode(wsserver.PublicStatus(runtime, req.PathValue(clientIDPathValue), cfg))
+		if err != nil {
+			slog.Error("failed encoding config", "error", err)
+		}
+	}
+}
+
+// ClientEventsHandler streams a single client's config as Server-Sent Events.
+func ClientEventsHandler(store wsserver.Store, runtime *wsserver.Runtime) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, req *http.Request) {
+		clientID := req.PathValue(clientIDPathValue)
+
+		_, ok := store.Get(clientID)
+		if !ok {
+			http.Error(responseWriter, "client not found", http.StatusNotFound)
+
+			return
+		}
+
+		flusher, ok := responseWriter.(http.Flusher)
+		if !ok {
+			http.Error(responseWriter, "streaming unsupported", http.StatusInternalServerError)
+
+			return
+		}
+
+		SetupSSEHeaders(responseWriter)
+		disableWriteDeadline(responseWriter)
+		StreamClientEvents(req.Context(), responseWriter, flusher, store, runtime, clientID, req.Header.Get("Last-Event-ID"))
+	}
+}
+
+// StreamClientEvents sends one client's config whenever it changes until
+// context is done or the client disappears.
+func StreamClientEvents(
+	ctx context.Context,
+	responseWriter http.ResponseWriter,
+	flusher http.Flusher,
+	store wsserver.Store,
+	runtime *wsserver.Runtime,
+	clientID string,
+	lastEventID string,
+) {
+	streamStoreEvents(ctx, responseWriter, flusher, store, runtime, lastEventID, func() ([]byte, error) {
+		return marshalClient(store, runtime, clientID)
+	})
+}
+
+// SendClientEventData sends a single Server-Sent Event with one client's config.
+func SendClientEventData(
+	responseWriter http.ResponseWriter,
+	flusher http.Flusher,
+	store wsserver.Store,
+	runtime *wsserver.Runtime,
+	clientID string,
+) error {
+	payload, err := marshalClient(store, runtime, clientID)
+	if err != nil {
+		return err
+	}
+
+	return WriteEvent(responseWriter, flusher, eventSeq(store, runtime), payload)
+}
+
+func marshalClient(store wsserver.Store, runtime *wsserver.Runtime, clientID string) ([]byte, error) {
+	cfg, ok := store.Get(clientID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+
+	payload, err := json.Marshal(wsserver.PublicStatus(runtime, clientID, cfg))
+	if err != nil {
+		slog.Error("failed marshaling event payload", "error", err)
+
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	return payload, nil
+}
+
+// NotFound renders the embedded 404 page with the given message.
+func NotFound(responseWriter http.ResponseWriter, message string) {
+	tmpl, err := embed.GetNotFoundTemplate()
+	if err != nil {
+		slog.Error("failed to get template", "error", err)
+		http.Error(responseWriter, "not found", http.StatusNotFound)
+
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	responseWriter.WriteHeader(http.StatusNotFound)
+
+	err = tmpl.Execute(responseWriter, embed.NotFoundPage{Title: "Not Found", Message: message})
+	if err != nil {
+		slog.Error("failed rendering template", "error", err)
+	}
+}
+
+func renderIndex(page embed.IndexPage) ([]byte, error) {
+	tmpl, err := embed.GetTemplate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+
+	var buf []byte
+
+	err = tmpl.Execute(&bytesWriter{buf: &buf}, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,147 @@
+package server_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/server"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+func newClientRequest(target, clientID string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.SetPathValue("clientID", clientID)
+
+	return req
+}
+
+func TestClientPath(t *testing.T) {
+	t.Parallel()
+
+	if got := server.ClientPath("alice"); got != "/u/alice" {
+		t.Errorf("expected /u/alice, got %s", got)
+	}
+
+	if got := server.ClientPath("a b/c"); got != "/u/a%20b%2Fc" {
+		t.Errorf("expected escaped path, got %s", got)
+	}
+}
+
+func TestClientIndexHandler(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", embed.SiteConfig{Name: "Alice's Status", User: "alice"})
+
+	rec := httptest.NewRecorder()
+	server.ClientIndexHandler(store).ServeHTTP(rec, newClientRequest("/u/alice", "alice"))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+
+	for _, want := range []string{"Alice&#39;s Status", `"/u/alice/config"`, `"/u/alice/events"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected body to contain %q", want)
+		}
+	}
+}
+
+func TestClientIndexHandlerUnknownClient(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+
+	rec := httptest.NewRecorder()
+	server.ClientIndexHandler(store).ServeHTTP(rec, newClientRequest("/u/nobody", "nobody"))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Errorf("expected HTML 404 page, got %s", contentType)
+	}
+
+	if !strings.Contains(rec.Body.String(), "No one has checked in as nobody.") {
+		t.Error("expected 404 page to name the unknown client")
+	}
+}
+
+func TestClientConfigHandler(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", embed.SiteConfig{Name: "Alice", User: "alice"})
+	setConfig(t, store, "bob", embed.SiteConfig{Name: "Bob", User: "bob"})
+
+	rec := httptest.NewRecorder()
+	server.ClientConfigHandler(store, wsserver.NewRuntime()).ServeHTTP(rec, newClientRequest("/u/bob/config", "bob"))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var cfg embed.SiteConfig
+
+	err := json.NewDecoder(rec.Body).Decode(&cfg)
+	if err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+
+	if cfg.Name != "Bob" {
+		t.Errorf("expected Bob's config, got %s", cfg.Name)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ClientConfigHandler(store, wsserver.NewRuntime()).ServeHTTP(rec, newClientRequest("/u/carol/config", "carol"))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown client, got %d", rec.Code)
+	}
+}
+
+func TestClientEventsHandlerUnknownClient(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+
+	rec := httptest.NewRecorder()
+	server.ClientEventsHandler(store, wsserver.NewRuntime()).ServeHTTP(rec, newClientRequest("/u/nobody/events", "nobody"))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestSendClientEventData(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", embed.SiteConfig{Name: "Alice"})
+
+	rec := httptest.NewRecorder()
+
+	err := server.SendClientEventData(rec, rec, store, wsserver.NewRuntime(), "alice")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	wantID := "id: " + strconv.FormatUint(store.Seq(), 10) + "\ndata: "
+	if !strings.HasPrefix(rec.Body.String(), wantID) || !strings.Contains(rec.Body.String(), "Alice") {
+		t.Errorf("unexpected event body: %s", rec.Body.String())
+	}
+
+	err = server.SendClientEventData(rec, rec, store, wsserver.NewRuntime(), "nobody")
+	if !errors.Is(err, server.ErrClientNotFound) {
+		t.Errorf("expected ErrClientNotFound, got %v", err)
+	}
+}
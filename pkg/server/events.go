@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/metrics"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+// heartbeatInterval keeps idle event streams from being closed by proxies.
+const heartbeatInterval = 15 * time.Second
+
+var sseViewers = metrics.NewGaugeVec("rlgl_sse_viewers", "Open Server-Sent Event streams.")
+
+// renderFunc produces the payload an event stream sends to its viewers.
+type renderFunc func() ([]byte, error)
+
+// WriteEvent sends a single Server-Sent Event. The id lets browsers resume
+// with Last-Event-ID after reconnecting.
+func WriteEvent(responseWriter http.ResponseWriter, flusher http.Flusher, eventID uint64, payload []byte) error {
+	event := "id: " + strconv.FormatUint(eventID, 10) + "\ndata: " + string(payload) + "\n\n"
+
+	_, err := responseWriter.Write([]byte(event))
+	if err != nil {
+		slog.Error("failed writing event payload", "error", err)
+
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+
+	flusher.Flush()
+
+	return nil
+}
+
+// disableWriteDeadline lifts the server's WriteTimeout for a long-lived event
+// stream; heartbeats and failed writes decide when the stream ends instead.
+func disableWriteDeadline(responseWriter http.ResponseWriter) {
+	err := http.NewResponseController(responseWriter).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.Warn("failed clearing event stream write deadline", "error", err)
+	}
+}
+
+// WriteHeartbeat sends an SSE comment, which browsers ignore.
+func WriteHeartbeat(responseWriter http.ResponseWriter, flusher http.Flusher) error {
+	_, err := responseWriter.Write([]byte(": heartbeat\n\n"))
+	if err != nil {
+		return fmt.Errorf("failed to write heartbeat: %w", err)
+	}
+
+	flusher.Flush()
+
+	return nil
+}
+
+// eventSeq is the ID of the latest event. The store and the runtime each
+// count their own changes, and their sum goes up whichever one moves.
+func eventSeq(store wsserver.Store, runtime *wsserver.Runtime) uint64 {
+	return store.Seq() + runtime.Seq()
+}
+
+// streamStoreEvents sends the rendered payload once, then again every time a
+// store or runtime change alters it, until the context is done or a write
+// fails.
+func streamStoreEvents(
+	ctx context.Context,
+	responseWriter http.ResponseWriter,
+	flusher http.Flusher,
+	store wsserver.Store,
+	runtime *wsserver.Runtime,
+	lastEventID string,
+	render renderFunc,
+) {
+	storeSub := store.Subscribe()
+	defer storeSub.Close()
+
+	runtimeSub := runtime.Subscribe()
+	defer runtimeSub.Close()
+
+	sseViewers.Inc()
+	defer sseViewers.Dec()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	// Commit the headers now; a resuming viewer may not get an event for a while.
+	flusher.Flush()
+
+	last, err := sendInitialEvent(responseWriter, flusher, eventSeq(store, runtime), lastEventID, render)
+	if err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-storeSub.C:
+			last, err = sendIfChanged(responseWriter, flusher, eventSeq(store, runtime), last, render)
+		case <-runtimeSub.C:
+			last, err = sendIfChanged(responseWriter, flusher, eventSeq(store, runtime), last, render)
+		case <-heartbeat.C:
+			err = WriteHeartbeat(responseWriter, flusher)
+		case <-ctx.Done():
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// sendInitialEvent skips the first event when the browser is resuming and
+// already holds the latest state.
+func sendInitialEvent(
+	responseWriter http.ResponseWriter,
+	flusher http.Flusher,
+	seq uint64,
+	lastEventID string,
+	render renderFunc,
+) ([]byte, error) {
+	payload, err := render()
+	if err != nil {
+		return nil, err
+	}
+
+	if lastEventID == strconv.FormatUint(seq, 10) {
+		return payload, nil
+	}
+
+	return payload, WriteEvent(responseWriter, flusher, seq, payload)
+}
+
+func sendIfChanged(
+	responseWriter http.ResponseWriter,
+	flusher http.Flusher,
+	seq uint64,
+	last []byte,
+	render renderFunc,
+) ([]byte, error) {
+	payload, err := render()
+	if err != nil {
+		return last, err
+	}
+
+	if bytes.Equal(payload, last) {
+		return last, nil
+	}
+
+	return payload, WriteEvent(responseWriter, flusher, seq, payload)
+}
@@ -0,0 +1,257 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/server"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+type sseEvent struct {
+	id   string
+	data string
+}
+
+// openEventStream connects to an SSE endpoint and returns a channel of parsed events.
+func openEventStream(t *testing.T, url, lastEventID string) <-chan sseEvent {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open event stream: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+
+	events := make(chan sseEvent, 16)
+
+	go func() {
+		defer close(events)
+
+		scanner := bufio.NewScanner(resp.Body)
+
+		var current sseEvent
+
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				current.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				current.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && current.data != "":
+				events <- current
+				current = sseEvent{}
+			}
+		}
+	}()
+
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("event stream closed")
+		}
+
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	return sseEvent{}
+}
+
+func expectNoEvent(t *testing.T, events <-chan sseEvent) {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		t.Fatalf("expected no event, got %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEventsHandlerWithStorePushesOnlyChanges(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "client1", embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Focus: "first"}})
+
+	ts := httptest.NewServer(server.EventsHandlerWithStore(store, wsserver.NewRuntime()))
+	t.Cleanup(ts.Close)
+
+	events := openEventStream(t, ts.URL, "")
+
+	initial := nextEvent(t, events)
+	if !strings.Contains(initial.data, "first") {
+		t.Errorf("expected initial state, got %s", initial.data)
+	}
+
+	setConfig(t, store, "client1", embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Focus: "first"}})
+	expectNoEvent(t, events)
+
+	setConfig(t, store, "client1", embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Focus: "second"}})
+
+	changed := nextEvent(t, events)
+	if !strings.Contains(changed.data, "second") {
+		t.Errorf("expected changed state, got %s", changed.data)
+	}
+
+	initialID, _ := strconv.ParseUint(initial.id, 10, 64)
+	changedID, _ := strconv.ParseUint(changed.id, 10, 64)
+
+	if changedID <= initialID {
+		t.Errorf("expected increasing event ids, got %s then %s", initial.id, changed.id)
+	}
+}
+
+func TestEventsHandlerWithStorePushesPresenceChanges(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	runtime := wsserver.NewRuntime()
+	setConfig(t, store, "client1", embed.SiteConfig{User: "alice"})
+
+	ts := httptest.NewServer(server.EventsHandlerWithStore(store, runtime))
+	t.Cleanup(ts.Close)
+
+	events := openEventStream(t, ts.URL, "")
+
+	initial := nextEvent(t, events)
+	if !strings.Contains(initial.data, `"state":"offline"`) {
+		t.Errorf("expected the client to start offline, got %s", initial.data)
+	}
+
+	runtime.Presence.Seen("client1", time.Minute)
+
+	online := nextEvent(t, events)
+	if !strings.Contains(online.data, `"state":"online"`) {
+		t.Errorf("expected the client to come online, got %s", online.data)
+	}
+
+	if online.id == initial.id {
+		t.Errorf("expected a new event id, got %s twice", online.id)
+	}
+}
+
+func TestEventsHandlerWithStoreOutlivesWriteTimeout(t *testing.T) {
+	t.Parallel()
+
+	const writeTimeout = 200 * time.Millisecond
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "client1", embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Focus: "first"}})
+
+	ts := httptest.NewUnstartedServer(server.EventsHandlerWithStore(store, wsserver.NewRuntime()))
+	ts.Config.WriteTimeout = writeTimeout
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	events := openEventStream(t, ts.URL, "")
+	nextEvent(t, events)
+
+	time.Sleep(3 * writeTimeout)
+
+	setConfig(t, store, "client1", embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Focus: "second"}})
+
+	changed := nextEvent(t, events)
+	if !strings.Contains(changed.data, "second") {
+		t.Errorf("expected changed state after write timeout, got %s", changed.data)
+	}
+}
+
+func TestEventsHandlerWithStoreResumesFromLastEventID(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "client1", embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Focus: "seen"}})
+
+	ts := httptest.NewServer(server.EventsHandlerWithStore(store, wsserver.NewRuntime()))
+	t.Cleanup(ts.Close)
+
+	events := openEventStream(t, ts.URL, strconv.FormatUint(store.Seq(), 10))
+	expectNoEvent(t, events)
+
+	setConfig(t, store, "client1", embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Focus: "new"}})
+
+	event := nextEvent(t, events)
+	if !strings.Contains(event.data, "new") {
+		t.Errorf("expected only the new state, got %s", event.data)
+	}
+
+	stale := openEventStream(t, ts.URL, "1")
+
+	event = nextEvent(t, stale)
+	if !strings.Contains(event.data, "new") {
+		t.Errorf("expected a stale viewer to get the current state, got %s", event.data)
+	}
+}
+
+func TestClientEventsHandlerIgnoresOtherClients(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", embed.SiteConfig{User: "alice"})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /u/{clientID}/events", server.ClientEventsHandler(store, wsserver.NewRuntime()))
+
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	events := openEventStream(t, ts.URL+"/u/alice/events", "")
+	nextEvent(t, events)
+
+	setConfig(t, store, "bob", embed.SiteConfig{User: "bob"})
+	expectNoEvent(t, events)
+
+	setConfig(t, store, "alice", embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Active: true}})
+
+	event := nextEvent(t, events)
+	if !strings.Contains(event.data, `"active":true`) {
+		t.Errorf("expected alice's update, got %s", event.data)
+	}
+}
+
+func TestWriteHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+
+	err := server.WriteHeartbeat(rec, rec)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if rec.Body.String() != ": heartbeat\n\n" {
+		t.Errorf("expected SSE comment, got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+var ErrInvalidSince = errors.New("since must be an RFC 3339 time or a duration such as 24h")
+
+// HistoryResponse is the body of the client history endpoint.
+type HistoryResponse struct {
+	ClientID    string                `json:"clientId"`
+	Since       time.Time             `json:"since,omitzero"`
+	Transitions []wsserver.Transition `json:"transitions"`
+}
+
+// ClientHistoryPath returns the history API URL for clientID.
+func ClientHistoryPath(clientID string) string {
+	return "/api/v1/clients/" + url.PathEscape(clientID) + "/history"
+}
+
+// ClientHistoryHandler returns a client's status transitions, oldest first.
+// The optional since parameter is either an RFC 3339 time or a duration
+// counted back from now, such as "24h".
+func ClientHistoryHandler(store wsserver.Store) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, req *http.Request) {
+		clientID := req.PathValue(clientIDPathValue)
+
+		since, err := parseSince(req.URL.Query().Get("since"), time.Now())
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		transitions := store.History(clientID, since)
+
+		_, ok := store.Get(clientID)
+		if !ok && len(transitions) == 0 {
+			http.Error(responseWriter, "client not found", http.StatusNotFound)
+
+			return
+		}
+
+		if transitions == nil {
+			transitions = []wsserver.Transition{}
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.Header().Set("Cache-Control", "no-store")
+
+		err = json.NewEncoder(responseWriter).Encode(HistoryResponse{
+			ClientID:    clientID,
+			Since:       since,
+			Transitions: transitions,
+		})
+		if err != nil {
+			slog.Error("failed encoding history", "error", err)
+		}
+	}
+}
+
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	since, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return since, nil
+	}
+
+	ago, err := time.ParseDuration(value)
+	if err != nil || ago < 0 {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidSince, value)
+	}
+
+	return now.Add(-ago), nil
+}
@@ -0,0 +1,92 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/server"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+func getHistory(t *testing.T, mux http.Handler, target string) (*httptest.ResponseRecorder, server.HistoryResponse) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+	var body server.HistoryResponse
+
+	if rec.Code == http.StatusOK {
+		err := json.Unmarshal(rec.Body.Bytes(), &body)
+		if err != nil {
+			t.Fatalf("failed to decode history: %v", err)
+		}
+	}
+
+	return rec, body
+}
+
+func TestClientHistoryHandler(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", embed.SiteConfig{Contributor: embed.Contributor{Status: embed.StatusRed}})
+	setConfig(t, store, "alice", embed.SiteConfig{Contributor: embed.Contributor{Status: embed.StatusYellow}})
+
+	mux := server.NewMux(store, nil, nil)
+
+	rec, body := getHistory(t, mux, server.ClientHistoryPath("alice"))
+	if rec.Code != http.StatusOK || len(body.Transitions) != 2 || body.Transitions[1].Status != embed.StatusYellow {
+		t.Fatalf("expected both transitions, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	_, body = getHistory(t, mux, server.ClientHistoryPath("alice")+"?since="+future)
+	if body.Transitions == nil || len(body.Transitions) != 0 {
+		t.Errorf("expected an empty list for a future since, got %+v", body.Transitions)
+	}
+
+	_, body = getHistory(t, mux, server.ClientHistoryPath("alice")+"?since=1h")
+	if len(body.Transitions) != 2 || time.Since(body.Since) < 59*time.Minute {
+		t.Errorf("expected a duration since to count back from now, got %+v", body)
+	}
+}
+
+func TestClientHistoryHandlerErrors(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", embed.SiteConfig{})
+
+	mux := server.NewMux(store, nil, nil)
+
+	rec, _ := getHistory(t, mux, server.ClientHistoryPath("bob"))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown client, got %d", rec.Code)
+	}
+
+	rec, _ = getHistory(t, mux, server.ClientHistoryPath("alice")+"?since=yesterday")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "since must be") {
+		t.Errorf("expected 400 for a bad since, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestClientIndexHandlerLinksHistory(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", embed.SiteConfig{User: "alice"})
+
+	rec := httptest.NewRecorder()
+	server.NewMux(store, nil, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/u/alice", nil))
+
+	if !strings.Contains(rec.Body.String(), `id="timeline"`) || !strings.Contains(rec.Body.String(), "/api/v1/clients/alice/history") {
+		t.Error("expected the per-user page to render the timeline")
+	}
+}
@@ -0,0 +1,150 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/server"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+	"github.com/gorilla/websocket"
+)
+
+// scrape fetches /metrics and returns each sample's value keyed by its name
+// and labels, as written.
+func scrape(t *testing.T, handler http.Handler) map[string]float64 {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 from /metrics, got %d", rec.Code)
+	}
+
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(rec.Body)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("unparseable sample %q: %v", line, err)
+		}
+
+		samples[key] = parsed
+	}
+
+	return samples
+}
+
+// pushForMetrics pushes twice as metrics-alice, sends an unknown message
+// type and tries to connect with a bad token. The connection stays open until
+// the test ends.
+func pushForMetrics(t *testing.T, wsURL string) {
+	t.Helper()
+
+	header := http.Header{"Authorization": {"Bearer push-token"}}
+
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	_ = resp.Body.Close()
+
+	// Left open so the scrape still counts the connection.
+	t.Cleanup(func() { _ = conn.Close() })
+
+	config := embed.SiteConfig{Contributor: embed.Contributor{Status: embed.StatusGreen}}
+
+	for _, msg := range []wsserver.Message{
+		{Type: "push", ClientID: "metrics-alice", Config: &config},
+		{Type: "push", ClientID: "metrics-alice", Config: &config},
+		{Type: "shout", ClientID: "metrics-alice"},
+	} {
+		err = conn.WriteJSON(msg)
+		if err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+
+		var reply wsserver.Message
+
+		err = conn.ReadJSON(&reply)
+		if err != nil {
+			t.Fatalf("failed to read reply: %v", err)
+		}
+	}
+
+	_, resp, err = websocket.DefaultDialer.Dial(wsURL, http.Header{"Authorization": {"Bearer wrong"}})
+	if err == nil {
+		t.Fatal("expected a bad token to be refused")
+	}
+
+	_ = resp.Body.Close()
+}
+
+func TestMetricsHandlerCoversPushesAndViewers(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	registry := auth.NewRegistry()
+	_ = registry.Register("push-token", auth.AnyClientID)
+
+	ts := httptest.NewServer(server.NewMux(store, registry, nil))
+	t.Cleanup(ts.Close)
+
+	pushForMetrics(t, "ws"+strings.TrimPrefix(ts.URL, "http")+"/ws")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events", nil)
+
+	stream, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to open event stream: %v", err)
+	}
+	defer stream.Body.Close()
+
+	// The first event arrives once the stream is counted.
+	_, _ = bufio.NewReader(stream.Body).ReadString('\n')
+
+	samples := scrape(t, server.NewMux(store, registry, nil))
+
+	if got := samples[`rlgl_pushes_total{client_id="metrics-alice"}`]; got != 2 {
+		t.Errorf("expected 2 pushes from metrics-alice, got %v", got)
+	}
+
+	for _, key := range []string{
+		`rlgl_push_rejects_total{reason="unknown_type"}`,
+		`rlgl_push_rejects_total{reason="bad_token"}`,
+		"rlgl_websocket_connections",
+		"rlgl_sse_viewers",
+	} {
+		if samples[key] < 1 {
+			t.Errorf("expected %s to be at least 1, got %v", key, samples[key])
+		}
+	}
+
+	age, ok := samples[`rlgl_client_seconds_since_update{client_id="metrics-alice"}`]
+	if !ok || age < 0 || age > 60 {
+		t.Errorf("expected a recent update for metrics-alice, got %v (present: %v)", age, ok)
+	}
+
+	if _, ok := samples["rlgl_slack_sync_duration_seconds_count"]; !ok {
+		t.Error("expected the Slack sync latency histogram to be exposed")
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log/slog"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/benwsapp/rlgl/pkg/auth"
 	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/metrics"
 	"github.com/benwsapp/rlgl/pkg/wsserver"
 )
 
@@ -47,7 +49,7 @@ func ConfigHandler(configPath string) http.HandlerFunc {
 		responseWriter.Header().Set("Content-Type", "application/json")
 		responseWriter.Header().Set("Cache-Control", "no-store")
 
-		err = json.NewEncoder(responseWriter).Encode(cfg)
+		err = json.NewEncoder(responseWriter).Encode(cfg.Public())
 		if err != nil {
 			slog.Error("failed encoding config", "error", err)
 		}
@@ -64,25 +66,44 @@ func EventsHandler(configPath string) http.HandlerFunc {
 		}
 
 		SetupSSEHeaders(responseWriter)
+		disableWriteDeadline(responseWriter)
 		StreamEvents(req.Context(), responseWriter, flusher, configPath)
 	}
 }
 
-// StreamEvents sends Server-Sent Events periodically until context is done.
+// StreamEvents polls the config file and sends a Server-Sent Event only when
+// its contents change, with a periodic heartbeat, until context is done.
 func StreamEvents(ctx context.Context, responseWriter http.ResponseWriter, flusher http.Flusher, configPath string) {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	poll := time.NewTicker(1 * time.Second)
+	defer poll.Stop()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	render := func() ([]byte, error) {
+		return loadConfigPayload(configPath)
+	}
+
+	var (
+		last []byte
+		seq  uint64
+		err  error
+	)
 
 	for {
 		select {
-		case <-ticker.C:
-			err := SendEventData(responseWriter, flusher, configPath)
-			if err != nil {
-				return
-			}
+		case <-poll.C:
+			seq++
+			last, err = sendIfChanged(responseWriter, flusher, seq, last, render)
+		case <-heartbeat.C:
+			err = WriteHeartbeat(responseWriter, flusher)
 		case <-ctx.Done():
 			return
 		}
+
+		if err != nil {
+			return
+		}
 	}
 }
 
@@ -95,18 +116,9 @@ func SetupSSEHeaders(w http.ResponseWriter) {
 
 // SendEventData sends a single Server-Sent Event with the current config.
 func SendEventData(responseWriter http.ResponseWriter, flusher http.Flusher, configPath string) error {
-	cfg, err := embed.LoadSiteConfig(configPath)
+	payload, err := loadConfigPayload(configPath)
 	if err != nil {
-		slog.Error("failed loading config for event stream", "error", err)
-
-		return fmt.Errorf("failed to load config: %w", err)
-	}
-
-	payload, err := json.Marshal(cfg)
-	if err != nil {
-		slog.Error("failed marshaling event payload", "error", err)
-
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return err
 	}
 
 	_, writeErr := responseWriter.Write([]byte("data: " + string(payload) + "\n\n"))
@@ -121,39 +133,55 @@ func SendEventData(responseWriter http.ResponseWriter, flusher http.Flusher, con
 	return nil
 }
 
-func Run(addr string, store *wsserver.Store, trustedOrigins []string, token string) error {
-	var authToken string
+func loadConfigPayload(configPath string) ([]byte, error) {
+	cfg, err := embed.LoadSiteConfig(configPath)
+	if err != nil {
+		slog.Error("failed loading config for event stream", "error", err)
 
-	if token == "" {
-		generatedToken, err := generateToken()
-		if err != nil {
-			return fmt.Errorf("failed to generate token: %w", err)
-		}
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
 
-		authToken = generatedToken
-		slog.Info("WebSocket authentication token (save this!)", "token", authToken)
-	} else {
-		authToken = token
+	payload, err := json.Marshal(cfg.Public())
+	if err != nil {
+		slog.Error("failed marshaling event payload", "error", err)
 
-		slog.Info("using pre-configured authentication token")
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	mux := http.NewServeMux()
+	return payload, nil
+}
 
-	// WebSocket endpoints for client push (requires authentication)
-	mux.HandleFunc("/ws", wsserver.Handler(store, authToken))
+// Options configures Run.
+type Options struct {
+	TrustedOrigins []string
 
-	// Status endpoint showing all stored configs
-	mux.HandleFunc("/status", wsserver.StatusHandler(store))
+	// Token is a shared push token that may push as any client. When neither
+	// Token nor Registry is set, one is generated and logged.
+	Token string
 
-	// HTML index page (uses first available config or shows all)
-	mux.HandleFunc("/", IndexHandlerWithStore(store))
+	// Registry holds per-client push credentials.
+	Registry *auth.Registry
 
-	// JSON config endpoints
-	mux.HandleFunc("/config", ConfigHandlerWithStore(store))
+	// Viewer, when set, requires a login to read the dashboard.
+	Viewer *ViewerAuth
 
-	// SSE events endpoint
-	mux.HandleFunc("/events", EventsHandlerWithStore(store))
+	// TLS, when enabled, serves HTTPS and WSS instead of plain HTTP.
+	TLS TLSOptions
+
+	// SlashCommands, when set, serves the /rlgl Slack slash command.
+	SlashCommands *SlashCommands
+
+	// Presence decides when quiet clients are shown as stale or offline.
+	Presence wsserver.PresencePolicy
+}
+
+// Run serves the dashboard and the WebSocket endpoint until ctx is done, then
+// shuts down gracefully.
+func Run(ctx context.Context, addr string, store wsserver.Store, opts Options) error {
+	registry, err := pushRegistry(opts)
+	if err != nil {
+		return err
+	}
 
 	const (
 		readHeaderTimeout = 5 * time.Second
@@ -162,23 +190,145 @@ func Run(addr string, store *wsserver.Store, trustedOrigins []string, token stri
 		idleTimeout       = 60 * time.Second
 	)
 
+	conns := wsserver.NewConnections()
+
+	runtime := wsserver.NewRuntime()
+	runtime.Presence.SetPolicy(opts.Presence)
+
+	var tlsConfig *tls.Config
+
+	if opts.TLS.Enabled() {
+		tlsConfig, err = NewTLSConfig(opts.TLS)
+		if err != nil {
+			return err
+		}
+	}
+
 	server := &http.Server{
 		Addr:              addr,
-		Handler:           CSRFMiddleware(mux, trustedOrigins...),
+		Handler:           CSRFMiddleware(newMux(store, runtime, registry, opts.Viewer, conns, opts.SlashCommands), opts.TrustedOrigins...),
 		ReadHeaderTimeout: readHeaderTimeout,
 		ReadTimeout:       readTimeout,
 		WriteTimeout:      writeTimeout,
 		IdleTimeout:       idleTimeout,
+		TLSConfig:         tlsConfig,
 	}
 
-	slog.Info("http server listening", "addr", addr)
+	go runtime.Presence.Watch(ctx, wsserver.DefaultPresenceCheck)
+
+	slog.Info("http server listening",
+		"addr", addr,
+		"viewer_login", opts.Viewer != nil,
+		"tls", tlsConfig != nil,
+		"slack_commands", opts.SlashCommands != nil,
+	)
 
-	err := server.ListenAndServe()
+	return wsserver.ListenAndServe(ctx, server, conns) //nolint:wrapcheck
+}
+
+// pushRegistry returns the registry clients authenticate against, adding the
+// shared token to it. The shared token predates per-client credentials and
+// may push as anyone.
+func pushRegistry(opts Options) (*auth.Registry, error) {
+	registry := opts.Registry
+	token := opts.Token
+
+	switch {
+	case token != "":
+		slog.Info("using pre-configured authentication token")
+	case registry == nil:
+		generatedToken, err := generateToken()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate token: %w", err)
+		}
+
+		token = generatedToken
+		slog.Info("WebSocket authentication token (save this!)", "token", token)
+	default:
+		return registry, nil
+	}
+
+	if registry == nil {
+		registry = auth.NewRegistry()
+	}
+
+	err := registry.Register(token, auth.AnyClientID)
 	if err != nil {
-		return fmt.Errorf("server failed: %w", err)
+		return nil, fmt.Errorf("failed to register token: %w", err)
 	}
 
-	return nil
+	return registry, nil
+}
+
+// NewMux registers every server route. Read endpoints only ever serve
+// embed.PublicSiteConfig, so no Slack settings leave the server, and they
+// require a viewer login when viewer is set.
+func NewMux(store wsserver.Store, registry *auth.Registry, viewer *ViewerAuth) *http.ServeMux {
+	return newMux(store, wsserver.NewRuntime(), registry, viewer, wsserver.NewConnections(), nil)
+}
+
+func newMux(
+	store wsserver.Store,
+	runtime *wsserver.Runtime,
+	registry *auth.Registry,
+	viewer *ViewerAuth,
+	conns *wsserver.Connections,
+	slash *SlashCommands,
+) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// WebSocket endpoints for client push (requires authentication)
+	mux.HandleFunc("/ws", conns.Handler(store, runtime, registry))
+
+	// Connections whose token goes away are told so and closed at once
+	if registry != nil {
+		registry.OnRevoke(func() { conns.CloseRevoked(registry) })
+	}
+
+	// Status endpoint showing all stored configs
+	mux.Handle("/status", viewer.Protect(wsserver.StatusHandler(store, runtime)))
+
+	// HTML team board showing every client
+	mux.Handle("/", viewer.Protect(IndexHandlerWithStore(store, runtime)))
+
+	// JSON team endpoint
+	mux.Handle("/config", viewer.Protect(ConfigHandlerWithStore(store, runtime)))
+
+	// SSE events endpoint carrying the whole team
+	mux.Handle("/events", viewer.Protect(EventsHandlerWithStore(store, runtime)))
+
+	// Per-client page, JSON and SSE endpoints
+	mux.Handle("GET /u/{clientID}", viewer.Protect(ClientIndexHandler(store)))
+	mux.Handle("GET /u/{clientID}/config", viewer.Protect(ClientConfigHandler(store, runtime)))
+	mux.Handle("GET /u/{clientID}/events", viewer.Protect(ClientEventsHandler(store, runtime)))
+
+	// Per-client status history
+	mux.Handle("GET /api/v1/clients/{clientID}/history", viewer.Protect(ClientHistoryHandler(store)))
+
+	// Status API for pushing without a WebSocket (requires authentication)
+	statusAPI := wsserver.StatusAPIHandler(store, runtime, registry)
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		mux.Handle(method+" /api/v1/clients/{clientID}/status", statusAPI)
+	}
+
+	// Commands from the dashboard to a connected client, such as a nudge
+	mux.Handle("POST /api/v1/clients/{clientID}/commands", viewer.Protect(conns.CommandHandler()))
+
+	// Slack slash command (requires a request signed by Slack)
+	if slash != nil {
+		mux.Handle("POST "+SlashCommandPath, slash.Handler(store, runtime))
+	}
+
+	// Prometheus metrics; they name every client, so they are protected too
+	mux.Handle("GET /metrics", viewer.Protect(metrics.Default.Handler(wsserver.LastUpdateCollector(store, runtime))))
+
+	// Viewer login and logout
+	if viewer != nil {
+		mux.HandleFunc(loginPath, viewer.LoginHandler())
+		mux.HandleFunc(logoutPath, viewer.LogoutHandler())
+	}
+
+	return mux
 }
 
 func generateToken() (string, error) {
@@ -190,26 +340,13 @@ func generateToken() (string, error) {
 	return token, nil
 }
 
-func IndexHandlerWithStore(store *wsserver.Store) http.HandlerFunc {
+func IndexHandlerWithStore(store wsserver.Store, runtime *wsserver.Runtime) http.HandlerFunc {
 	return func(responseWriter http.ResponseWriter, req *http.Request) {
 		slog.Info("request received", "method", req.Method, "path", req.URL.Path, "remote_addr", req.RemoteAddr)
 
-		configs := store.GetAll()
-		if len(configs) == 0 {
-			http.Error(responseWriter, "no configs available", http.StatusNotFound)
+		team := BuildTeam(store, runtime, ParseSortOrder(req.URL.Query().Get("sort")))
 
-			return
-		}
-
-		// Use the first config for rendering
-		var cfg embed.SiteConfig
-		for _, c := range configs {
-			cfg = c
-
-			break
-		}
-
-		content, err := renderIndex(cfg)
+		content, err := renderTeam(team)
 		if err != nil {
 			slog.Error("failed rendering template", "error", err)
 			http.Error(responseWriter, "internal server error", http.StatusInternalServerError)
@@ -224,34 +361,21 @@ func IndexHandlerWithStore(store *wsserver.Store) http.HandlerFunc {
 	}
 }
 
-func ConfigHandlerWithStore(store *wsserver.Store) http.HandlerFunc {
-	return func(responseWriter http.ResponseWriter, _ *http.Request) {
-		configs := store.GetAll()
-		if len(configs) == 0 {
-			http.Error(responseWriter, "no configs available", http.StatusNotFound)
-
-			return
-		}
-
-		// Return the first config
-		var cfg embed.SiteConfig
-		for _, c := range configs {
-			cfg = c
-
-			break
-		}
+func ConfigHandlerWithStore(store wsserver.Store, runtime *wsserver.Runtime) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, req *http.Request) {
+		team := BuildTeam(store, runtime, ParseSortOrder(req.URL.Query().Get("sort")))
 
 		responseWriter.Header().Set("Content-Type", "application/json")
 		responseWriter.Header().Set("Cache-Control", "no-store")
 
-		err := json.NewEncoder(responseWriter).Encode(cfg)
+		err := json.NewEncoder(responseWriter).Encode(team)
 		if err != nil {
 			slog.Error("failed encoding config", "error", err)
 		}
 	}
 }
 
-func EventsHandlerWithStore(store *wsserver.Store) http.HandlerFunc {
+func EventsHandlerWithStore(store wsserver.Store, runtime *wsserver.Runtime) http.HandlerFunc {
 	return func(responseWriter http.ResponseWriter, req *http.Request) {
 		flusher, ok := responseWriter.(http.Flusher)
 		if !ok {
@@ -261,76 +385,78 @@ func EventsHandlerWithStore(store *wsserver.Store) http.HandlerFunc {
 		}
 
 		SetupSSEHeaders(responseWriter)
-		StreamEventsFromStore(req.Context(), responseWriter, flusher, store)
+		disableWriteDeadline(responseWriter)
+		StreamEventsFromStore(
+			req.Context(),
+			responseWriter,
+			flusher,
+			store,
+			runtime,
+			ParseSortOrder(req.URL.Query().Get("sort")),
+			req.Header.Get("Last-Event-ID"),
+		)
 	}
 }
 
+// StreamEventsFromStore sends the whole team's state whenever it changes,
+// resuming quietly when lastEventID already matches the latest change.
 func StreamEventsFromStore(
 	ctx context.Context,
 	responseWriter http.ResponseWriter,
 	flusher http.Flusher,
-	store *wsserver.Store,
+	store wsserver.Store,
+	runtime *wsserver.Runtime,
+	order SortOrder,
+	lastEventID string,
 ) {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			err := SendEventDataFromStore(responseWriter, flusher, store)
-			if err != nil {
-				return
-			}
-		case <-ctx.Done():
-			return
-		}
-	}
+	streamStoreEvents(ctx, responseWriter, flusher, store, runtime, lastEventID, func() ([]byte, error) {
+		return marshalTeam(store, runtime, order)
+	})
 }
 
-func SendEventDataFromStore(responseWriter http.ResponseWriter, flusher http.Flusher, store *wsserver.Store) error {
-	configs := store.GetAll()
-	if len(configs) == 0 {
-		return nil
+// SendEventDataFromStore sends a single Server-Sent Event with the whole team's state.
+func SendEventDataFromStore(
+	responseWriter http.ResponseWriter,
+	flusher http.Flusher,
+	store wsserver.Store,
+	runtime *wsserver.Runtime,
+	order SortOrder,
+) error {
+	payload, err := marshalTeam(store, runtime, order)
+	if err != nil {
+		return err
 	}
 
-	// Send the first config
-	var cfg embed.SiteConfig
-	for _, c := range configs {
-		cfg = c
-
-		break
-	}
+	return WriteEvent(responseWriter, flusher, eventSeq(store, runtime), payload)
+}
 
-	payload, err := json.Marshal(cfg)
+func marshalTeam(store wsserver.Store, runtime *wsserver.Runtime, order SortOrder) ([]byte, error) {
+	payload, err := json.Marshal(BuildTeam(store, runtime, order))
 	if err != nil {
 		slog.Error("failed marshaling event payload", "error", err)
 
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	_, writeErr := responseWriter.Write([]byte("data: " + string(payload) + "\n\n"))
-	if writeErr != nil {
-		slog.Error("failed writing event payload", "error", writeErr)
-
-		return fmt.Errorf("failed to write event: %w", writeErr)
-	}
-
-	flusher.Flush()
-
-	return nil
+	return payload, nil
 }
 
-func renderIndex(cfg embed.SiteConfig) ([]byte, error) {
-	tmpl, err := embed.GetTemplate()
+func renderTeam(team Team) ([]byte, error) {
+	tmpl, err := embed.GetTeamTemplate()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get template: %w", err)
 	}
 
-	var buf []byte
+	page := teamPage{
+		Title:      teamTitle,
+		Sort:       team.Sort,
+		SortOrders: SortOrders,
+		Members:    team.Members,
+	}
 
-	w := &bytesWriter{buf: &buf}
+	var buf []byte
 
-	err = tmpl.Execute(w, cfg)
+	err = tmpl.Execute(&bytesWriter{buf: &buf}, page)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute template: %w", err)
 	}
@@ -2,6 +2,7 @@ package server_test
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/benwsapp/rlgl/pkg/auth"
 	"github.com/benwsapp/rlgl/pkg/embed"
 	"github.com/benwsapp/rlgl/pkg/server"
 	"github.com/benwsapp/rlgl/pkg/wsserver"
@@ -300,9 +302,9 @@ func TestIndexHandlerWithStore(t *testing.T) {
 		},
 	}
 
-	store.Set("client1", config)
+	setConfig(t, store, "client1", config)
 
-	handler := server.IndexHandlerWithStore(store)
+	handler := server.IndexHandlerWithStore(store, wsserver.NewRuntime())
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	rec := httptest.NewRecorder()
 
@@ -323,14 +325,18 @@ func TestIndexHandlerWithStoreEmptyStore(t *testing.T) {
 
 	store := wsserver.NewStore()
 
-	handler := server.IndexHandlerWithStore(store)
+	handler := server.IndexHandlerWithStore(store, wsserver.NewRuntime())
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusNotFound {
-		t.Errorf("expected status 404, got %d", rec.Code)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+
+	if !strings.Contains(rec.Body.String(), "No one has checked in yet.") {
+		t.Error("expected empty board message")
 	}
 }
 
@@ -350,9 +356,9 @@ func TestConfigHandlerWithStore(t *testing.T) {
 		},
 	}
 
-	store.Set("client1", config)
+	setConfig(t, store, "client1", config)
 
-	handler := server.ConfigHandlerWithStore(store)
+	handler := server.ConfigHandlerWithStore(store, wsserver.NewRuntime())
 	req := httptest.NewRequest(http.MethodGet, "/config", nil)
 	rec := httptest.NewRecorder()
 
@@ -378,14 +384,25 @@ func TestConfigHandlerWithStoreEmptyStore(t *testing.T) {
 
 	store := wsserver.NewStore()
 
-	handler := server.ConfigHandlerWithStore(store)
+	handler := server.ConfigHandlerWithStore(store, wsserver.NewRuntime())
 	req := httptest.NewRequest(http.MethodGet, "/config", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusNotFound {
-		t.Errorf("expected status 404, got %d", rec.Code)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+
+	var team server.Team
+
+	err := json.NewDecoder(rec.Body).Decode(&team)
+	if err != nil {
+		t.Fatalf("failed to decode team: %v", err)
+	}
+
+	if len(team.Members) != 0 {
+		t.Errorf("expected no members, got %d", len(team.Members))
 	}
 }
 
@@ -405,9 +422,9 @@ func TestEventsHandlerWithStore(t *testing.T) {
 		},
 	}
 
-	store.Set("client1", config)
+	setConfig(t, store, "client1", config)
 
-	handler := server.EventsHandlerWithStore(store)
+	handler := server.EventsHandlerWithStore(store, wsserver.NewRuntime())
 	req := httptest.NewRequest(http.MethodGet, "/events", nil)
 	rec := httptest.NewRecorder()
 
@@ -444,9 +461,9 @@ func TestEventsHandlerWithStoreNoFlusher(t *testing.T) {
 		},
 	}
 
-	store.Set("client1", config)
+	setConfig(t, store, "client1", config)
 
-	handler := server.EventsHandlerWithStore(store)
+	handler := server.EventsHandlerWithStore(store, wsserver.NewRuntime())
 	req := httptest.NewRequest(http.MethodGet, "/events", nil)
 	rec := &noFlusherWriter{}
 
@@ -473,7 +490,7 @@ func TestStreamEventsFromStore(t *testing.T) {
 		},
 	}
 
-	store.Set("client1", config)
+	setConfig(t, store, "client1", config)
 
 	rec := httptest.NewRecorder()
 
@@ -483,7 +500,7 @@ func TestStreamEventsFromStore(t *testing.T) {
 	done := make(chan bool, 1)
 
 	go func() {
-		server.StreamEventsFromStore(ctx, rec, rec, store)
+		server.StreamEventsFromStore(ctx, rec, rec, store, wsserver.NewRuntime(), server.SortByName, "")
 
 		done <- true
 	}()
@@ -511,11 +528,11 @@ func TestSendEventDataFromStore(t *testing.T) {
 		},
 	}
 
-	store.Set("client1", config)
+	setConfig(t, store, "client1", config)
 
 	rec := httptest.NewRecorder()
 
-	err := server.SendEventDataFromStore(rec, rec, store)
+	err := server.SendEventDataFromStore(rec, rec, store, wsserver.NewRuntime(), server.SortByName)
 	if err != nil {
 		t.Errorf("expected no error, got %v", err)
 	}
@@ -533,8 +550,77 @@ func TestSendEventDataFromStoreEmptyStore(t *testing.T) {
 
 	rec := httptest.NewRecorder()
 
-	err := server.SendEventDataFromStore(rec, rec, store)
+	err := server.SendEventDataFromStore(rec, rec, store, wsserver.NewRuntime(), server.SortByName)
 	if err != nil {
 		t.Logf("error returned as expected: %v", err)
 	}
 }
+
+func setConfig(t *testing.T, store wsserver.Store, clientID string, config embed.SiteConfig) {
+	t.Helper()
+
+	err := store.Set(clientID, config)
+	if err != nil {
+		t.Fatalf("failed to set config: %v", err)
+	}
+}
+
+func TestMuxServesStatusAPI(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	registry := auth.NewRegistry()
+	_ = registry.Register("push-token", auth.AnyClientID)
+
+	// Scripts send no Origin, so cross-origin protection lets them through.
+	mux := server.CSRFMiddleware(server.NewMux(store, registry, nil))
+
+	for _, step := range []struct {
+		method string
+		body   string
+		code   int
+	}{
+		{http.MethodPut, `{"name":"CI"}`, http.StatusCreated},
+		{http.MethodPatch, `{"contributor":{"status":"red"}}`, http.StatusOK},
+		{http.MethodDelete, ``, http.StatusNoContent},
+	} {
+		req := httptest.NewRequest(step.method, "/api/v1/clients/ci/status", strings.NewReader(step.body))
+		req.Header.Set("Authorization", "Bearer push-token")
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != step.code {
+			t.Errorf("%s: expected %d, got %d: %s", step.method, step.code, rec.Code, rec.Body.String())
+		}
+	}
+
+	if _, ok := store.Get("ci"); ok {
+		t.Error("expected the client to be deleted")
+	}
+}
+
+func TestMuxServesCommandAPI(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	_ = store.Set("ci", embed.SiteConfig{Name: "CI"})
+
+	mux := server.NewMux(store, auth.NewRegistry(), nil)
+
+	req := httptest.NewRequest(http.MethodPost, server.ClientCommandsPath("ci"), strings.NewReader(`{"command":"nudge"}`))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a client with no connection, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/u/ci", nil))
+
+	if !strings.Contains(rec.Body.String(), `id="nudge-button"`) {
+		t.Error("expected the client page to offer a nudge button")
+	}
+}
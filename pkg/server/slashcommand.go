@@ -0,0 +1,264 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/slack"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+// SlashCommandPath is where Slack sends the /rlgl slash command.
+const SlashCommandPath = "/slack/commands"
+
+// maxSlashCommandBodySize bounds a slash command request body.
+const maxSlashCommandBodySize = 8 << 10
+
+// DefaultSlashCommandTTL is how long a slash command's change outlasts the
+// client's own pushes.
+const DefaultSlashCommandTTL = 4 * time.Hour
+
+const slashCommandUsage = "Usage: `/rlgl green|yellow|red|away [focus]`, " +
+	"`/rlgl queue add <task>` or `/rlgl queue clear`."
+
+var (
+	ErrSigningSecretRequired = errors.New("signing secret is required")
+	ErrInvalidSlackUser      = errors.New("invalid Slack user mapping")
+	ErrUnknownSlashCommand   = errors.New("unknown command")
+
+	// errNoStatus stops a command for a client that has never pushed.
+	errNoStatus = errors.New("client has no status")
+)
+
+// SlashCommands serves the /rlgl Slack slash command, which changes the
+// status of the client linked to the Slack user who ran it. Requests must be
+// signed with the app's signing secret. A change is kept as an override of
+// the client's config, so pushes of the config the client already had don't
+// undo it until the override expires.
+type SlashCommands struct {
+	signingSecret string
+	users         map[string]string
+	ttl           time.Duration
+}
+
+// NewSlashCommands links each Slack user ID in users to the client ID it may
+// change.
+func NewSlashCommands(signingSecret string, users map[string]string) (*SlashCommands, error) {
+	if signingSecret == "" {
+		return nil, ErrSigningSecretRequired
+	}
+
+	return &SlashCommands{signingSecret: signingSecret, users: users, ttl: DefaultSlashCommandTTL}, nil
+}
+
+// WithTTL sets how long a command's change outlasts the client's pushes.
+func (s *SlashCommands) WithTTL(ttl time.Duration) *SlashCommands {
+	s.ttl = ttl
+
+	return s
+}
+
+// ParseSlackUsers reads "<Slack user ID>=<client ID>" pairs.
+func ParseSlackUsers(pairs []string) (map[string]string, error) {
+	users := make(map[string]string, len(pairs))
+
+	for _, pair := range pairs {
+		userID, clientID, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || userID == "" || clientID == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSlackUser, pair)
+		}
+
+		users[userID] = clientID
+	}
+
+	return users, nil
+}
+
+// slashResponse is the reply Slack shows the user who ran the command.
+type slashResponse struct {
+	ResponseType string `json:"response_type"` //nolint:tagliatelle
+	Text         string `json:"text"`
+}
+
+// Handler verifies the request came from Slack and answers with an
+// ephemeral message saying what changed. Mistakes in the command itself are
+// answered the same way, as Slack shows nothing useful for an error status.
+func (s *SlashCommands) Handler(store wsserver.Store, runtime *wsserver.Runtime) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(responseWriter, req.Body, maxSlashCommandBodySize))
+		if err != nil {
+			http.Error(responseWriter, "failed to read request body", http.StatusBadRequest)
+
+			return
+		}
+
+		err = slack.Verify(s.signingSecret, req.Header, body, time.Now())
+		if err != nil {
+			slog.Warn("Slack command rejected", "error", err, "remote_addr", req.RemoteAddr)
+			http.Error(responseWriter, "unauthorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(responseWriter, "invalid form", http.StatusBadRequest)
+
+			return
+		}
+
+		reply := s.run(store, runtime, form.Get("user_id"), form.Get("text"))
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+
+		err = json.NewEncoder(responseWriter).Encode(slashResponse{ResponseType: "ephemeral", Text: reply})
+		if err != nil {
+			slog.Error("failed encoding Slack command response", "error", err)
+		}
+	}
+}
+
+// run applies text to the config of userID's client and returns the reply.
+func (s *SlashCommands) run(store wsserver.Store, runtime *wsserver.Runtime, userID, text string) string {
+	clientID, ok := s.users[userID]
+	if !ok {
+		slog.Warn("Slack command from unlinked user", "slack_user_id", userID)
+
+		return "Your Slack user (" + userID + ") is not linked to an rlgl client yet. " +
+			"Ask whoever runs the server to add it to `--slack-users`."
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" || text == "help" {
+		return slashCommandUsage
+	}
+
+	apply, err := parseSlashCommand(text)
+	if err != nil {
+		return err.Error() + ". " + slashCommandUsage
+	}
+
+	var (
+		reply      string
+		invalidErr error
+	)
+
+	config, err := store.Update(clientID, func(config embed.SiteConfig, exists bool) (embed.SiteConfig, error) {
+		if !exists {
+			return config, errNoStatus
+		}
+
+		reply = apply(&config)
+		invalidErr = config.Validate()
+
+		return config, invalidErr
+	})
+
+	switch {
+	case errors.Is(err, errNoStatus):
+		return "rlgl has no status for " + clientID + " yet. Start your client first."
+	case invalidErr != nil:
+		return "That would make an invalid config: " + invalidErr.Error() + "."
+	case err != nil:
+		slog.Error("failed to store config from Slack command", "error", err, "client_id", clientID)
+
+		return "Failed to save your status. Try again in a moment."
+	}
+
+	runtime.Overrides.Add(clientID, func(config *embed.SiteConfig) { apply(config) }, s.ttl)
+	runtime.Slack.Sync(clientID, config)
+	slog.Info("applied Slack command", "client_id", clientID, "text", text)
+
+	return reply
+}
+
+// slashCommand changes a config as a /rlgl command asks and returns what to
+// tell the user. It is replayed on the client's later pushes, so running it
+// on a config it has already changed must change nothing.
+type slashCommand func(config *embed.SiteConfig) string
+
+// parseSlashCommand reads the text after /rlgl.
+func parseSlashCommand(text string) (slashCommand, error) {
+	word, rest, _ := strings.Cut(text, " ")
+	rest = unquote(rest)
+
+	switch {
+	case embed.Status(word).Valid():
+		return setStatus(embed.Status(word), rest), nil
+	case word == "queue":
+		return parseQueueCommand(rest)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownSlashCommand, word)
+	}
+}
+
+func parseQueueCommand(text string) (slashCommand, error) {
+	action, task, _ := strings.Cut(text, " ")
+	task = unquote(task)
+
+	switch {
+	case action == "add" && task != "":
+		return func(config *embed.SiteConfig) string {
+			if slices.Contains(config.Contributor.Queue, task) {
+				return "“" + task + "” is already in your queue."
+			}
+
+			config.Contributor.Queue = append(config.Contributor.Queue, task)
+
+			return "Added “" + task + "” to your queue (" + strconv.Itoa(len(config.Contributor.Queue)) + " in it now)."
+		}, nil
+	case action == "clear":
+		return func(config *embed.SiteConfig) string {
+			config.Contributor.Queue = nil
+
+			return "Cleared your queue."
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownSlashCommand, strings.TrimSpace("queue "+action))
+	}
+}
+
+// setStatus sets the light, and the focus when one is given.
+func setStatus(status embed.Status, focus string) slashCommand {
+	return func(config *embed.SiteConfig) string {
+		config.Contributor = config.Contributor.WithStatus(status)
+
+		if focus == "" {
+			return "Your light is now " + string(status) + "."
+		}
+
+		config.Contributor.Focus = focus
+
+		return "Your light is now " + string(status) + ": " + focus + "."
+	}
+}
+
+// unquote trims space and one pair of quotes, straight or curly as Slack
+// may send them.
+func unquote(text string) string {
+	text = strings.TrimSpace(text)
+
+	for _, quotes := range [][2]string{{`"`, `"`}, {"“", "”"}} {
+		inner, ok := strings.CutPrefix(text, quotes[0])
+		if !ok {
+			continue
+		}
+
+		inner, ok = strings.CutSuffix(inner, quotes[1])
+		if ok {
+			return strings.TrimSpace(inner)
+		}
+	}
+
+	return text
+}
@@ -0,0 +1,284 @@
+package server_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/server"
+	"github.com/benwsapp/rlgl/pkg/slack"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+const signingSecret = "slack-signing-secret"
+
+type slashReply struct {
+	ResponseType string `json:"response_type"` //nolint:tagliatelle
+	Text         string `json:"text"`
+}
+
+func newSlashCommands(t *testing.T) (http.HandlerFunc, *wsserver.MemoryStore) {
+	t.Helper()
+
+	commands, err := server.NewSlashCommands(signingSecret, map[string]string{"U123": "alice", "U456": "bob"})
+	if err != nil {
+		t.Fatalf("failed to create slash commands: %v", err)
+	}
+
+	store := wsserver.NewStore()
+
+	err = store.Set("alice", embed.SiteConfig{
+		User:        "alice",
+		Contributor: embed.Contributor{Status: embed.StatusGreen, Focus: "reviews", Queue: []string{"deploy"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to set config: %v", err)
+	}
+
+	return commands.Handler(store, wsserver.NewRuntime()), store
+}
+
+// slashRequest is the request Slack sends when userID runs /rlgl text,
+// signed at signedAt.
+func slashRequest(userID, text string, signedAt time.Time) *http.Request {
+	body := url.Values{"command": {"/rlgl"}, "user_id": {userID}, "text": {text}}.Encode()
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+
+	req := httptest.NewRequest(http.MethodPost, server.SlashCommandPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(slack.TimestampHeader, timestamp)
+	req.Header.Set(slack.SignatureHeader, slack.Sign(signingSecret, timestamp, []byte(body)))
+
+	return req
+}
+
+func runSlashCommand(t *testing.T, handler http.Handler, userID, text string) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, slashRequest(userID, text, time.Now()))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var reply slashReply
+
+	err := json.Unmarshal(rec.Body.Bytes(), &reply)
+	if err != nil {
+		t.Fatalf("failed to decode reply: %v", err)
+	}
+
+	if reply.ResponseType != "ephemeral" {
+		t.Errorf("expected an ephemeral reply, got %q", reply.ResponseType)
+	}
+
+	return reply.Text
+}
+
+func TestSlashCommandChangesStatus(t *testing.T) {
+	t.Parallel()
+
+	handler, store := newSlashCommands(t)
+
+	reply := runSlashCommand(t, handler, "U123", `red "debugging prod"`)
+	if reply != "Your light is now red: debugging prod." {
+		t.Errorf("unexpected reply: %q", reply)
+	}
+
+	config, _ := store.Get("alice")
+	if config.Contributor.State() != embed.StatusRed || config.Contributor.Focus != "debugging prod" {
+		t.Errorf("expected alice to be red and debugging prod, got %+v", config.Contributor)
+	}
+
+	runSlashCommand(t, handler, "U123", "green")
+	runSlashCommand(t, handler, "U123", "queue add “write the postmortem”")
+
+	config, _ = store.Get("alice")
+	if config.Contributor.State() != embed.StatusGreen || config.Contributor.Focus != "debugging prod" {
+		t.Errorf("expected alice to be green and keep her focus, got %+v", config.Contributor)
+	}
+
+	if want := []string{"deploy", "write the postmortem"}; !slices.Equal(config.Contributor.Queue, want) {
+		t.Errorf("expected queue %v, got %v", want, config.Contributor.Queue)
+	}
+
+	runSlashCommand(t, handler, "U123", "queue clear")
+
+	config, _ = store.Get("alice")
+	if len(config.Contributor.Queue) != 0 {
+		t.Errorf("expected the queue to be cleared, got %v", config.Contributor.Queue)
+	}
+}
+
+func TestSlashCommandOutlastsClientPushes(t *testing.T) {
+	t.Parallel()
+
+	commands, err := server.NewSlashCommands(signingSecret, map[string]string{"U123": "alice"})
+	if err != nil {
+		t.Fatalf("failed to create slash commands: %v", err)
+	}
+
+	pushed := embed.SiteConfig{
+		User:        "alice",
+		Contributor: embed.Contributor{Status: embed.StatusGreen, Focus: "reviews", Queue: []string{"deploy"}},
+	}
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", pushed)
+
+	runtime := wsserver.NewRuntime()
+	handler := commands.Handler(store, runtime)
+
+	runSlashCommand(t, handler, "U123", `red "debugging prod"`)
+	runSlashCommand(t, handler, "U123", "queue add postmortem")
+
+	if reply := runSlashCommand(t, handler, "U123", "queue add postmortem"); !strings.Contains(reply, "already in your queue") {
+		t.Errorf("expected a task already queued not to be added again, got %q", reply)
+	}
+
+	config := runtime.Overrides.Apply("alice", pushed)
+	if config.Contributor.State() != embed.StatusRed || config.Contributor.Focus != "debugging prod" {
+		t.Errorf("expected the client's next push to stay red, got %+v", config.Contributor)
+	}
+
+	if want := []string{"deploy", "postmortem"}; !slices.Equal(config.Contributor.Queue, want) {
+		t.Errorf("expected queue %v, got %v", want, config.Contributor.Queue)
+	}
+
+	edited := pushed
+	edited.Contributor.Focus = "release notes"
+
+	if config = runtime.Overrides.Apply("alice", edited); config.Contributor.State() != embed.StatusGreen {
+		t.Errorf("expected an edited config to win over the command, got %+v", config.Contributor)
+	}
+
+	expiring, err := server.NewSlashCommands(signingSecret, map[string]string{"U123": "alice"})
+	if err != nil {
+		t.Fatalf("failed to create slash commands: %v", err)
+	}
+
+	runtime = wsserver.NewRuntime()
+	runSlashCommand(t, expiring.WithTTL(0).Handler(store, runtime), "U123", "yellow")
+
+	if config = runtime.Overrides.Apply("alice", pushed); config.Contributor.State() != embed.StatusGreen {
+		t.Errorf("expected an expired change to give way to the push, got %+v", config.Contributor)
+	}
+}
+
+func TestSlashCommandKeepsClientOverride(t *testing.T) {
+	t.Parallel()
+
+	handler, store := newSlashCommands(t)
+
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	_, err := store.Update("alice", func(config embed.SiteConfig, _ bool) (embed.SiteConfig, error) {
+		config.Override = &embed.Override{Status: embed.StatusYellow, Until: until}
+
+		return config, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to set override: %v", err)
+	}
+
+	runSlashCommand(t, handler, "U123", "red")
+
+	config, _ := store.Get("alice")
+	if config.Override == nil || !config.Override.Until.Equal(until) {
+		t.Errorf("expected the command to leave the client's own override alone, got %+v", config.Override)
+	}
+}
+
+func TestSlashCommandReplies(t *testing.T) {
+	t.Parallel()
+
+	handler, store := newSlashCommands(t)
+
+	tests := []struct {
+		name   string
+		userID string
+		text   string
+		want   string
+	}{
+		{"help", "U123", "", "Usage:"},
+		{"unknown command", "U123", "purple", `unknown command "purple"`},
+		{"unknown queue command", "U123", "queue shuffle", `unknown command "queue shuffle"`},
+		{"unlinked user", "U999", "red", "not linked"},
+		{"client without a status", "U456", "red", "no status for bob"},
+	}
+
+	for _, test := range tests {
+		if reply := runSlashCommand(t, handler, test.userID, test.text); !strings.Contains(reply, test.want) {
+			t.Errorf("%s: expected the reply to mention %q, got %q", test.name, test.want, reply)
+		}
+	}
+
+	if config, _ := store.Get("alice"); config.Contributor.State() != embed.StatusGreen {
+		t.Errorf("expected alice's status to be unchanged, got %+v", config.Contributor)
+	}
+
+	if _, ok := store.Get("bob"); ok {
+		t.Error("expected bob to stay off the board")
+	}
+}
+
+func TestSlashCommandRejectsUnsignedRequests(t *testing.T) {
+	t.Parallel()
+
+	handler, store := newSlashCommands(t)
+
+	tampered := slashRequest("U123", "green", time.Now())
+	tampered.Header.Set(slack.SignatureHeader, slack.Sign("other-secret", tampered.Header.Get(slack.TimestampHeader), nil))
+
+	requests := map[string]*http.Request{
+		"wrong secret": tampered,
+		"replayed":     slashRequest("U123", "red", time.Now().Add(-time.Hour)),
+	}
+
+	for name, req := range requests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, rec.Code)
+		}
+	}
+
+	if config, _ := store.Get("alice"); config.Contributor.State() != embed.StatusGreen {
+		t.Errorf("expected alice's status to be unchanged, got %+v", config.Contributor)
+	}
+}
+
+func TestParseSlackUsers(t *testing.T) {
+	t.Parallel()
+
+	users, err := server.ParseSlackUsers([]string{"U123=alice", " U456=bob "})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if users["U123"] != "alice" || users["U456"] != "bob" {
+		t.Errorf("unexpected users: %v", users)
+	}
+
+	for _, pair := range []string{"U123", "=alice", "U123="} {
+		_, err = server.ParseSlackUsers([]string{pair})
+		if !errors.Is(err, server.ErrInvalidSlackUser) {
+			t.Errorf("%q: expected ErrInvalidSlackUser, got %v", pair, err)
+		}
+	}
+
+	_, err = server.NewSlashCommands("", users)
+	if !errors.Is(err, server.ErrSigningSecretRequired) {
+		t.Errorf("expected ErrSigningSecretRequired, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+type SortOrder string
+
+const (
+	SortByName    SortOrder = "name"
+	SortByStatus  SortOrder = "status"
+	SortByUpdated SortOrder = "updated"
+
+	teamTitle = "Team Status"
+)
+
+// SortOrders lists the supported team board orderings, default first.
+var SortOrders = []SortOrder{SortByName, SortByStatus, SortByUpdated}
+
+type TeamMember struct {
+	ClientID  string                 `json:"clientId"`
+	Config    embed.PublicSiteConfig `json:"config"`
+	UpdatedAt time.Time              `json:"updatedAt"`
+	Presence  wsserver.Presence      `json:"presence"`
+}
+
+type Team struct {
+	Sort    SortOrder    `json:"sort"`
+	Members []TeamMember `json:"members"`
+}
+
+type teamPage struct {
+	Title      string
+	Sort       SortOrder
+	SortOrders []SortOrder
+	Members    []TeamMember
+}
+
+// ParseSortOrder returns the named sort order, falling back to SortByName.
+func ParseSortOrder(value string) SortOrder {
+	order := SortOrder(strings.ToLower(strings.TrimSpace(value)))
+	if slices.Contains(SortOrders, order) {
+		return order
+	}
+
+	return SortByName
+}
+
+// BuildTeam collects every client in the store in the requested order.
+func BuildTeam(store wsserver.Store, runtime *wsserver.Runtime, order SortOrder) Team {
+	entries := store.Entries()
+
+	members := make([]TeamMember, 0, len(entries))
+	for _, entry := range entries {
+		members = append(members, TeamMember{
+			ClientID:  entry.ClientID,
+			Config:    entry.Config.Public(),
+			UpdatedAt: entry.UpdatedAt,
+			Presence:  runtime.Presence.Get(entry.ClientID),
+		})
+	}
+
+	SortMembers(members, order)
+
+	return Team{Sort: order, Members: members}
+}
+
+// SortMembers orders members in place. Every order falls back to display name
+// and then client ID, so the result is stable across refreshes.
+func SortMembers(members []TeamMember, order SortOrder) {
+	slices.SortFunc(members, func(left, right TeamMember) int {
+		switch order {
+		case SortByStatus:
+			if byStatus := compareStatus(left, right); byStatus != 0 {
+				return byStatus
+			}
+		case SortByUpdated:
+			if byUpdated := right.UpdatedAt.Compare(left.UpdatedAt); byUpdated != 0 {
+				return byUpdated
+			}
+		case SortByName:
+		}
+
+		return cmp.Or(
+			cmp.Compare(strings.ToLower(displayName(left)), strings.ToLower(displayName(right))),
+			cmp.Compare(left.ClientID, right.ClientID),
+		)
+	})
+}
+
+// compareStatus puts the most available members first: green, then yellow,
+// red and away.
+func compareStatus(left, right TeamMember) int {
+	return cmp.Compare(left.Config.Contributor.State().Rank(), right.Config.Contributor.State().Rank())
+}
+
+func displayName(member TeamMember) string {
+	if member.Config.User != "" {
+		return member.Config.User
+	}
+
+	return member.ClientID
+}
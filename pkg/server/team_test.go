@@ -0,0 +1,234 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/server"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+func TestParseSortOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input    string
+		expected server.SortOrder
+	}{
+		{"", server.SortByName},
+		{"name", server.SortByName},
+		{"Status", server.SortByStatus},
+		{" updated ", server.SortByUpdated},
+		{"bogus", server.SortByName},
+	}
+
+	for _, tt := range tests {
+		if got := server.ParseSortOrder(tt.input); got != tt.expected {
+			t.Errorf("ParseSortOrder(%q): expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSortMembers(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	members := func() []server.TeamMember {
+		return []server.TeamMember{
+			{ClientID: "c", Config: embed.PublicSiteConfig{User: "carol"}, UpdatedAt: base},
+			{ClientID: "a", Config: embed.PublicSiteConfig{User: "Alice"}, UpdatedAt: base.Add(time.Minute)},
+			{
+				ClientID:  "b",
+				Config:    embed.PublicSiteConfig{User: "bob", Contributor: embed.Contributor{Active: true}},
+				UpdatedAt: base,
+			},
+			{ClientID: "d", UpdatedAt: base.Add(2 * time.Minute)},
+		}
+	}
+
+	tests := []struct {
+		order    server.SortOrder
+		expected string
+	}{
+		{server.SortByName, "abcd"},
+		{server.SortByStatus, "bacd"},
+		{server.SortByUpdated, "dabc"},
+	}
+
+	for _, tt := range tests {
+		sorted := members()
+		server.SortMembers(sorted, tt.order)
+
+		var got strings.Builder
+		for _, member := range sorted {
+			got.WriteString(member.ClientID)
+		}
+
+		if got.String() != tt.expected {
+			t.Errorf("sort %s: expected %s, got %s", tt.order, tt.expected, got.String())
+		}
+	}
+}
+
+func TestSortMembersByStatusLevel(t *testing.T) {
+	t.Parallel()
+
+	member := func(clientID string, status embed.Status) server.TeamMember {
+		return server.TeamMember{ClientID: clientID, Config: embed.PublicSiteConfig{Contributor: embed.Contributor{Status: status}}}
+	}
+
+	members := []server.TeamMember{
+		member("a", embed.StatusAway),
+		member("b", embed.StatusRed),
+		member("c", embed.StatusYellow),
+		member("d", embed.StatusGreen),
+	}
+
+	server.SortMembers(members, server.SortByStatus)
+
+	var got strings.Builder
+	for _, member := range members {
+		got.WriteString(member.ClientID)
+	}
+
+	if got.String() != "dcba" {
+		t.Errorf("expected green, yellow, red, away order, got %s", got.String())
+	}
+}
+
+func TestConfigHandlerWithStoreReturnsWholeTeam(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "client2", embed.SiteConfig{Name: "Site 2", User: "zoe"})
+	setConfig(t, store, "client1", embed.SiteConfig{Name: "Site 1", User: "adam"})
+
+	for range 5 {
+		req := httptest.NewRequest(http.MethodGet, "/config?sort=name", nil)
+		rec := httptest.NewRecorder()
+
+		server.ConfigHandlerWithStore(store, wsserver.NewRuntime()).ServeHTTP(rec, req)
+
+		var team server.Team
+
+		err := json.NewDecoder(rec.Body).Decode(&team)
+		if err != nil {
+			t.Fatalf("failed to decode team: %v", err)
+		}
+
+		if len(team.Members) != 2 {
+			t.Fatalf("expected 2 members, got %d", len(team.Members))
+		}
+
+		if team.Members[0].ClientID != "client1" || team.Members[1].ClientID != "client2" {
+			t.Errorf("expected stable order client1, client2; got %s, %s",
+				team.Members[0].ClientID, team.Members[1].ClientID)
+		}
+	}
+}
+
+func TestIndexHandlerWithStoreRendersEveryClient(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "client1", embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Focus: "Reviews"}})
+	setConfig(t, store, "client2", embed.SiteConfig{User: "bob", Contributor: embed.Contributor{Focus: "Deploys"}})
+
+	req := httptest.NewRequest(http.MethodGet, "/?sort=status", nil)
+	rec := httptest.NewRecorder()
+
+	server.IndexHandlerWithStore(store, wsserver.NewRuntime()).ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+
+	for _, want := range []string{"alice", "bob", "Reviews", "Deploys", `<option value="status" selected>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected body to contain %q", want)
+		}
+	}
+}
+
+func TestIndexHandlerWithStoreRendersStatusStyles(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "client1", embed.SiteConfig{
+		User:        "alice",
+		Contributor: embed.Contributor{Status: embed.StatusYellow},
+		Statuses:    map[embed.Status]embed.StatusStyle{embed.StatusYellow: {Label: "Heads down", Color: "#f59e0b"}},
+	})
+	setConfig(t, store, "client2", embed.SiteConfig{User: "bob"})
+
+	rec := httptest.NewRecorder()
+	server.IndexHandlerWithStore(store, wsserver.NewRuntime()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`class="light yellow" style="color: #f59e0b" aria-label="Heads down"`,
+		`class="light red" aria-label="Red light"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected body to contain %q", want)
+		}
+	}
+}
+
+func TestIndexHandlerWithStoreShowsPresence(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	runtime := wsserver.NewRuntime()
+	runtime.Presence.SetPolicy(wsserver.PresencePolicy{GreyStale: true})
+	setConfig(t, store, "client1", embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Status: embed.StatusGreen}})
+	setConfig(t, store, "client2", embed.SiteConfig{User: "bob", Contributor: embed.Contributor{Status: embed.StatusGreen}})
+	runtime.Presence.Seen("client1", time.Minute)
+
+	rec := httptest.NewRecorder()
+	server.IndexHandlerWithStore(store, runtime).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body := rec.Body.String()
+
+	if !strings.Contains(body, `class="light green" aria-label`) || !strings.Contains(body, `class="light green grey"`) {
+		t.Errorf("expected only the offline client to be greyed out, got %s", body)
+	}
+
+	if strings.Count(body, `<p class="presence offline">offline</p>`) != 1 {
+		t.Errorf("expected one offline badge, got %s", body)
+	}
+}
+
+func TestSendEventDataFromStoreCarriesTeam(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "client1", embed.SiteConfig{User: "alice"})
+	setConfig(t, store, "client2", embed.SiteConfig{User: "bob"})
+
+	rec := httptest.NewRecorder()
+
+	err := server.SendEventDataFromStore(rec, rec, store, wsserver.NewRuntime(), server.SortByName)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_, event, _ := strings.Cut(rec.Body.String(), "data: ")
+	payload := strings.TrimSuffix(event, "\n\n")
+
+	var team server.Team
+
+	err = json.Unmarshal([]byte(payload), &team)
+	if err != nil {
+		t.Fatalf("failed to decode event payload: %v", err)
+	}
+
+	if len(team.Members) != 2 {
+		t.Errorf("expected 2 members in event, got %d", len(team.Members))
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTLSKeyPairIncomplete = errors.New("both a TLS certificate and key are required")
+	ErrClientCARequiresTLS  = errors.New("a client CA requires a TLS certificate and key")
+	ErrNoClientCACerts      = errors.New("no certificates found in client CA file")
+)
+
+// TLSOptions configures HTTPS and WSS. When ClientCAFile is set, clients may
+// present a certificate signed by it; its common name then authenticates a
+// WebSocket connection as that client ID without a token.
+type TLSOptions struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+// Enabled reports whether TLS was asked for at all.
+func (o TLSOptions) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.ClientCAFile != ""
+}
+
+// NewTLSConfig builds the server's TLS config. The key pair is reloaded
+// whenever its files change, so renewed certificates are picked up without a
+// restart.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		if opts.ClientCAFile != "" {
+			return nil, ErrClientCARequiresTLS
+		}
+
+		return nil, ErrTLSKeyPairIncomplete
+	}
+
+	reloader := &certReloader{certFile: opts.CertFile, keyFile: opts.KeyFile}
+
+	_, err := reloader.GetCertificate(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if opts.ClientCAFile != "" {
+		config.ClientCAs, err = loadCertPool(opts.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// Browsers reading the dashboard have no certificate, so one is only
+		// verified when it is offered.
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path) // #nosec G304 - path comes from the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%w: %s", ErrNoClientCACerts, path)
+	}
+
+	return pool, nil
+}
+
+// fileStamp identifies a version of a file well enough to notice it being
+// replaced.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// certReloader serves the key pair in certFile and keyFile. Each handshake
+// checks whether the files have changed and reloads them if so. A pair that
+// fails to load, such as a certificate written before its key, is retried on
+// the next handshake while the previous one keeps being served.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certSeen fileStamp
+	keySeen  fileStamp
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certStamp, certErr := statFile(r.certFile)
+	keyStamp, keyErr := statFile(r.keyFile)
+
+	err := errors.Join(certErr, keyErr)
+	if err == nil && r.cert != nil && certStamp == r.certSeen && keyStamp == r.keySeen {
+		return r.cert, nil
+	}
+
+	if err == nil {
+		err = r.load(certStamp, keyStamp)
+	}
+
+	if err != nil && r.cert != nil {
+		slog.Error("failed to reload TLS certificate, serving the previous one", "error", err)
+
+		return r.cert, nil
+	}
+
+	return r.cert, err
+}
+
+func (r *certReloader) load(certStamp, keyStamp fileStamp) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	if r.cert != nil {
+		slog.Info("reloaded TLS certificate", "cert", r.certFile)
+	}
+
+	r.cert = &cert
+	r.certSeen = certStamp
+	r.keySeen = keyStamp
+
+	return nil
+}
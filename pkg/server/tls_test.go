@@ -0,0 +1,272 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/server"
+	"github.com/benwsapp/rlgl/pkg/wsclient"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	path string
+}
+
+func newTestCA(t *testing.T, dir string) testCA {
+	t.Helper()
+
+	ca := testCA{path: filepath.Join(dir, "ca.pem")}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "rlgl test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	ca.cert, ca.key = signCert(t, template, nil, nil)
+	writePEM(t, ca.path, "CERTIFICATE", ca.cert.Raw)
+
+	return ca
+}
+
+// issue writes a certificate for commonName signed by the CA, and its key,
+// to dir and returns their paths.
+func (ca testCA) issue(t *testing.T, dir, commonName string, serial int64) (string, string) {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	cert, key := signCert(t, template, ca.cert, ca.key)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certPath := filepath.Join(dir, commonName+".pem")
+	keyPath := filepath.Join(dir, commonName+"-key.pem")
+
+	writePEM(t, certPath, "CERTIFICATE", cert.Raw)
+	writePEM(t, keyPath, "EC PRIVATE KEY", keyDER)
+
+	return certPath, keyPath
+}
+
+func signCert(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	return cert, key
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+// serveTLS serves handler over TLS with config on a local port and returns
+// its wss:// URL.
+func serveTLS(t *testing.T, config *tls.Config, handler http.Handler) string {
+	t.Helper()
+
+	var listenConfig net.ListenConfig
+
+	listener, err := listenConfig.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	httpServer := &http.Server{Handler: handler, ReadHeaderTimeout: time.Second}
+
+	go func() {
+		_ = httpServer.Serve(tls.NewListener(listener, config))
+	}()
+
+	t.Cleanup(func() { _ = httpServer.Close() })
+
+	return "wss://" + listener.Addr().String() + "/ws"
+}
+
+func TestNewTLSConfigReloadsChangedCertificate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	certPath, keyPath := ca.issue(t, dir, "server", 2)
+
+	config, err := server.NewTLSConfig(server.TLSOptions{CertFile: certPath, KeyFile: keyPath})
+	if err != nil {
+		t.Fatalf("failed to build TLS config: %v", err)
+	}
+
+	first, err := config.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("failed to get certificate: %v", err)
+	}
+
+	renewedCert, renewedKey := ca.issue(t, t.TempDir(), "server", 3)
+
+	for _, rename := range [][2]string{{renewedKey, keyPath}, {renewedCert, certPath}} {
+		err = os.Rename(rename[0], rename[1])
+		if err != nil {
+			t.Fatalf("failed to replace %s: %v", rename[1], err)
+		}
+	}
+
+	// Make sure the replacement is noticed even on filesystems with coarse
+	// modification times.
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certPath, later, later)
+
+	second, err := config.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("failed to get certificate: %v", err)
+	}
+
+	if second.Leaf.SerialNumber.Cmp(first.Leaf.SerialNumber) == 0 {
+		t.Errorf("expected the renewed certificate to be served, still got serial %v", second.Leaf.SerialNumber)
+	}
+
+	err = os.WriteFile(keyPath, []byte("not a key"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to corrupt key: %v", err)
+	}
+
+	third, err := config.GetCertificate(nil)
+	if err != nil || third != second {
+		t.Errorf("expected a broken key pair to keep the previous certificate, got %v", err)
+	}
+}
+
+func TestNewTLSConfigRejectsIncompleteOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := server.NewTLSConfig(server.TLSOptions{CertFile: "cert.pem"})
+	if !errors.Is(err, server.ErrTLSKeyPairIncomplete) {
+		t.Errorf("expected ErrTLSKeyPairIncomplete, got %v", err)
+	}
+
+	_, err = server.NewTLSConfig(server.TLSOptions{ClientCAFile: "ca.pem"})
+	if !errors.Is(err, server.ErrClientCARequiresTLS) {
+		t.Errorf("expected ErrClientCARequiresTLS, got %v", err)
+	}
+}
+
+func TestClientCertificateCommonNameIsClientID(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	serverCert, serverKey := ca.issue(t, dir, "server", 2)
+	clientCert, clientKey := ca.issue(t, dir, "alice", 3)
+
+	config, err := server.NewTLSConfig(server.TLSOptions{CertFile: serverCert, KeyFile: serverKey, ClientCAFile: ca.path})
+	if err != nil {
+		t.Fatalf("failed to build TLS config: %v", err)
+	}
+
+	store := wsserver.NewStore()
+	url := serveTLS(t, config, server.NewMux(store, auth.NewRegistry(), nil))
+
+	clientConfig, err := wsclient.LoadTLSConfig(ca.path, clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("failed to load client TLS config: %v", err)
+	}
+
+	alice := wsclient.NewClient(url, "alice", "")
+	alice.SetTLSConfig(clientConfig)
+
+	err = alice.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect with a client certificate: %v", err)
+	}
+	defer alice.Close()
+
+	config1 := embed.SiteConfig{Name: "Alice", Contributor: embed.Contributor{Status: embed.StatusGreen}}
+
+	err = alice.PushConfig(config1)
+	if err != nil {
+		t.Fatalf("expected the certificate's CN to push as itself, got %v", err)
+	}
+
+	bob := wsclient.NewClient(url, "bob", "")
+	bob.SetTLSConfig(clientConfig)
+
+	err = bob.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect with a client certificate: %v", err)
+	}
+	defer bob.Close()
+
+	err = bob.PushConfig(config1)
+	if !errors.Is(err, wsclient.ErrServerError) {
+		t.Errorf("expected a push as another client ID to be rejected, got %v", err)
+	}
+
+	caOnly, err := wsclient.LoadTLSConfig(ca.path, "", "")
+	if err != nil {
+		t.Fatalf("failed to load client TLS config: %v", err)
+	}
+
+	anonymous := wsclient.NewClient(url, "alice", "")
+	anonymous.SetTLSConfig(caOnly)
+
+	err = anonymous.Connect()
+	if err == nil {
+		_ = anonymous.Close()
+
+		t.Error("expected a connection without a certificate or token to be refused")
+	}
+}
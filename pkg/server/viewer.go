@@ -0,0 +1,218 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+)
+
+const (
+	sessionCookieName = "rlgl_session"
+	sessionTTL        = 12 * time.Hour
+	sessionKeyLength  = 32
+	loginPath         = "/login"
+	logoutPath        = "/logout"
+	loginTitle        = "Sign In"
+)
+
+var ErrViewerPasswordRequired = errors.New("viewer password is required")
+
+// ViewerAuth puts the dashboard's read endpoints behind a viewer password.
+// A successful login is remembered in an HMAC-signed session cookie; the
+// signing key is generated at startup, so a restart signs everyone out.
+// Scripts can skip the cookie and send the password as a bearer token.
+type ViewerAuth struct {
+	password [sha256.Size]byte
+	key      []byte
+}
+
+func NewViewerAuth(password string) (*ViewerAuth, error) {
+	if password == "" {
+		return nil, ErrViewerPasswordRequired
+	}
+
+	key := make([]byte, sessionKeyLength)
+
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session key: %w", err)
+	}
+
+	return &ViewerAuth{password: sha256.Sum256([]byte(password)), key: key}, nil
+}
+
+// Protect requires a viewer session for next. A nil ViewerAuth leaves the
+// dashboard open, as it was before logins existed.
+func (a *ViewerAuth) Protect(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, req *http.Request) {
+		if a.authenticated(req) {
+			next.ServeHTTP(responseWriter, req)
+
+			return
+		}
+
+		// Browsers asking for a page are sent to the login form; API and
+		// event stream requests just get a 401.
+		if req.Method == http.MethodGet && strings.Contains(req.Header.Get("Accept"), "text/html") {
+			http.Redirect(responseWriter, req, loginPath+"?next="+url.QueryEscape(req.URL.RequestURI()), http.StatusSeeOther)
+
+			return
+		}
+
+		http.Error(responseWriter, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// LoginHandler shows the login form and starts a session on the right password.
+func (a *ViewerAuth) LoginHandler() http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			renderLogin(responseWriter, http.StatusOK, "", safeNext(req.URL.Query().Get("next")))
+		case http.MethodPost:
+			next := safeNext(req.PostFormValue("next"))
+
+			if !a.checkPassword(req.PostFormValue("password")) {
+				slog.Warn("viewer login failed", "remote_addr", req.RemoteAddr)
+				renderLogin(responseWriter, http.StatusUnauthorized, "Wrong password.", next)
+
+				return
+			}
+
+			http.SetCookie(responseWriter, sessionCookie(req, a.sign(time.Now().Add(sessionTTL)), int(sessionTTL.Seconds())))
+
+			slog.Info("viewer logged in", "remote_addr", req.RemoteAddr)
+			http.Redirect(responseWriter, req, next, http.StatusSeeOther)
+		default:
+			http.Error(responseWriter, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// LogoutHandler ends the viewer's session. Only POST is accepted, so another
+// site cannot sign the viewer out with a link or an image.
+func (a *ViewerAuth) LogoutHandler() http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			responseWriter.Header().Set("Allow", http.MethodPost)
+			http.Error(responseWriter, "method not allowed", http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		http.SetCookie(responseWriter, sessionCookie(req, "", -1))
+		http.Redirect(responseWriter, req, loginPath, http.StatusSeeOther)
+	}
+}
+
+// sessionCookie is the session cookie for value, or its deletion for a
+// negative maxAge. It is only marked Secure when req came over TLS, as
+// browsers drop Secure cookies set over plain HTTP, and the server listens
+// on plain HTTP unless given a certificate.
+func sessionCookie(req *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (a *ViewerAuth) authenticated(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if ok {
+		return a.checkPassword(token)
+	}
+
+	cookie, err := req.Cookie(sessionCookieName)
+	if err != nil {
+		return false
+	}
+
+	return a.verify(cookie.Value)
+}
+
+func (a *ViewerAuth) checkPassword(password string) bool {
+	sum := sha256.Sum256([]byte(password))
+
+	return subtle.ConstantTimeCompare(sum[:], a.password[:]) == 1
+}
+
+// sign returns a session value of the form "<expiry>.<mac>".
+func (a *ViewerAuth) sign(expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+
+	return expiry + "." + base64.RawURLEncoding.EncodeToString(a.mac(expiry))
+}
+
+func (a *ViewerAuth) verify(value string) bool {
+	expiry, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, a.mac(expiry)) {
+		return false
+	}
+
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return time.Now().Before(time.Unix(expires, 0))
+}
+
+func (a *ViewerAuth) mac(expiry string) []byte {
+	hash := hmac.New(sha256.New, a.key)
+	hash.Write([]byte(expiry))
+
+	return hash.Sum(nil)
+}
+
+// safeNext only allows redirects back to a path on this server.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+
+	return next
+}
+
+func renderLogin(responseWriter http.ResponseWriter, status int, message, next string) {
+	tmpl, err := embed.GetLoginTemplate()
+	if err != nil {
+		slog.Error("failed to get template", "error", err)
+		http.Error(responseWriter, "internal server error", http.StatusInternalServerError)
+
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	responseWriter.WriteHeader(status)
+
+	err = tmpl.Execute(responseWriter, embed.LoginPage{Title: loginTitle, Error: message, Next: next})
+	if err != nil {
+		slog.Error("failed rendering template", "error", err)
+	}
+}
@@ -0,0 +1,301 @@
+package server_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/server"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+	"github.com/gorilla/websocket"
+)
+
+const viewerPassword = "correct horse battery staple"
+
+func newViewerMux(t *testing.T) (*http.ServeMux, *auth.Registry) {
+	t.Helper()
+
+	viewer, err := server.NewViewerAuth(viewerPassword)
+	if err != nil {
+		t.Fatalf("NewViewerAuth failed: %v", err)
+	}
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", embed.SiteConfig{User: "alice"})
+
+	registry := auth.NewRegistry()
+
+	err = registry.Register("push-token", auth.AnyClientID)
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	return server.NewMux(store, registry, viewer), registry
+}
+
+func login(t *testing.T, mux http.Handler, password, next string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{"password": {password}, "next": {next}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func sessionCookie(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "rlgl_session" {
+			return cookie
+		}
+	}
+
+	t.Fatal("expected a session cookie")
+
+	return nil
+}
+
+func TestNewViewerAuthRequiresPassword(t *testing.T) {
+	t.Parallel()
+
+	_, err := server.NewViewerAuth("")
+	if !errors.Is(err, server.ErrViewerPasswordRequired) {
+		t.Errorf("expected ErrViewerPasswordRequired, got %v", err)
+	}
+}
+
+func TestViewerAuthProtectsReadEndpoints(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := newViewerMux(t)
+
+	for _, target := range []string{"/", "/status", "/config", "/events", "/u/alice", "/u/alice/config", "/u/alice/events", "/api/v1/clients/alice/history", "/metrics"} {
+		rec := serveBriefly(mux, target)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected status 401, got %d", target, rec.Code)
+		}
+
+		if strings.Contains(rec.Body.String(), "alice") {
+			t.Errorf("%s: expected no data before login, got %s", target, rec.Body.String())
+		}
+	}
+}
+
+func TestViewerAuthRedirectsBrowsersToLogin(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := newViewerMux(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/u/alice", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d", rec.Code)
+	}
+
+	if location := rec.Header().Get("Location"); location != "/login?next=%2Fu%2Falice" {
+		t.Errorf("unexpected redirect: %s", location)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login?next=/u/alice", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="/u/alice"`) {
+		t.Errorf("expected login form carrying next, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestViewerAuthLoginSession(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := newViewerMux(t)
+
+	rec := login(t, mux, "wrong", "/")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Wrong password.") {
+		t.Errorf("expected failed login, got %d", rec.Code)
+	}
+
+	rec = login(t, mux, viewerPassword, "/u/alice")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/u/alice" {
+		t.Fatalf("expected redirect to /u/alice, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+
+	cookie := sessionCookie(t, rec)
+	if cookie.Secure || !cookie.HttpOnly {
+		t.Errorf("expected an HTTP-only session cookie not marked Secure over plain HTTP, got %+v", cookie)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/u/alice/config", nil)
+	req.AddCookie(cookie)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected session to grant access, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/u/alice/config", nil)
+	req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value + "x"})
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected tampered session to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestViewerAuthLoginRejectsOffsiteRedirects(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := newViewerMux(t)
+
+	for _, next := range []string{"//evil.example", "https://evil.example", `/\evil.example`} {
+		rec := login(t, mux, viewerPassword, next)
+
+		if location := rec.Header().Get("Location"); location != "/" {
+			t.Errorf("next=%q: expected redirect to /, got %s", next, location)
+		}
+	}
+}
+
+func TestViewerAuthBearerPassword(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := newViewerMux(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("Authorization", "Bearer "+viewerPassword)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected bearer password to grant access, got %d", rec.Code)
+	}
+}
+
+func TestViewerAuthMarksSessionSecureOverTLS(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := newViewerMux(t)
+
+	form := url.Values{"password": {viewerPassword}}
+	req := httptest.NewRequest(http.MethodPost, "https://rlgl.example/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if cookie := sessionCookie(t, rec); !cookie.Secure {
+		t.Errorf("expected a Secure session cookie over TLS, got %+v", cookie)
+	}
+}
+
+func TestViewerAuthLoginOverPlainHTTP(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := newViewerMux(t)
+
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := client.PostForm(ts.URL+"/login", url.Values{"password": {viewerPassword}, "next": {"/u/alice/config"}})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	_ = resp.Body.Close()
+
+	var session *http.Cookie
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "rlgl_session" {
+			session = cookie
+		}
+	}
+
+	// Browsers drop a Secure cookie set over plain HTTP, which would send
+	// the viewer back to the login form forever.
+	if session == nil || session.Secure {
+		t.Fatalf("expected a session cookie a browser keeps over plain HTTP, got %+v", session)
+	}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, ts.URL+resp.Header.Get("Location"), nil)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+
+	req.AddCookie(session)
+
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the session to grant access over plain HTTP, got %d", resp.StatusCode)
+	}
+}
+
+func TestViewerAuthLogout(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := newViewerMux(t)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/logout", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("expected GET /logout to be refused, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/logout", nil))
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Errorf("expected redirect to /login, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+
+	if cookie := sessionCookie(t, rec); cookie.MaxAge >= 0 {
+		t.Errorf("expected the session cookie to be deleted, got %+v", cookie)
+	}
+}
+
+func TestViewerAuthLeavesPushPathOnBearerTokens(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := newViewerMux(t)
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	headers := http.Header{"Authorization": {"Bearer push-token"}}
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", headers)
+	if err != nil {
+		t.Fatalf("expected push token to connect without a viewer session: %v", err)
+	}
+
+	_ = resp.Body.Close()
+	_ = conn.Close()
+}
@@ -0,0 +1,73 @@
+package slack_test
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/slack"
+)
+
+func signedHeader(timestamp, signature string) http.Header {
+	header := http.Header{}
+	header.Set(slack.TimestampHeader, timestamp)
+	header.Set(slack.SignatureHeader, signature)
+
+	return header
+}
+
+func TestVerifySlackExample(t *testing.T) {
+	t.Parallel()
+
+	// The example from Slack's guide to verifying requests.
+	const (
+		secret    = "8f742231b10e8888abcd99yyyzzz85a5"
+		timestamp = "1531420618"
+		signature = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+		body      = "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V" +
+			"&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=" +
+			"&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN" +
+			"&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	)
+
+	now := time.Unix(1531420618, 0).Add(time.Minute)
+
+	err := slack.Verify(secret, signedHeader(timestamp, signature), []byte(body), now)
+	if err != nil {
+		t.Errorf("expected Slack's example to verify, got %v", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	t.Parallel()
+
+	const secret = "signing-secret"
+
+	now := time.Now()
+	body := []byte("user_id=U123&text=green")
+	fresh := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-slack.MaxRequestAge-time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+		want   error
+	}{
+		{"unsigned", http.Header{}, body, slack.ErrMissingSignature},
+		{"wrong secret", signedHeader(fresh, slack.Sign("other-secret", fresh, body)), body, slack.ErrInvalidSignature},
+		{"changed body", signedHeader(fresh, slack.Sign(secret, fresh, body)), []byte("user_id=U123&text=red"), slack.ErrInvalidSignature},
+		{"bad timestamp", signedHeader("yesterday", slack.Sign(secret, "yesterday", body)), body, slack.ErrInvalidSignature},
+		{"replayed", signedHeader(stale, slack.Sign(secret, stale, body)), body, slack.ErrStaleRequest},
+		{"signed", signedHeader(fresh, slack.Sign(secret, fresh, body)), body, nil},
+	}
+
+	for _, test := range tests {
+		err := slack.Verify(secret, test.header, test.body, now)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, err)
+		}
+	}
+}
@@ -7,40 +7,173 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
-	slackAPIURL     = "https://slack.com/api/users.profile.set"
+	slackAPIURL     = "https://slack.com/api"
 	requestTimeout  = 10 * time.Second
 	maxStatusLength = 100
+
+	defaultAttempts = 3
+	defaultBackoff  = time.Second
+
+	// maxRetryDelay is the longest SetStatus waits before a retry. A
+	// Retry-After beyond it is not waited out; a *RateLimitError saying how
+	// long to wait is returned instead.
+	maxRetryDelay = 30 * time.Second
 )
 
-var ErrSlackAPI = errors.New("slack API error")
+var (
+	// ErrSlackAPI wraps every error Slack reports, alongside one of the more
+	// specific errors below when the code is known.
+	ErrSlackAPI = errors.New("slack API error")
+
+	// ErrInvalidAuth means the token is malformed or does not exist.
+	ErrInvalidAuth = errors.New("invalid auth")
+	// ErrTokenRevoked means the user or an admin revoked the token.
+	ErrTokenRevoked = errors.New("token revoked")
+	// ErrRateLimited means Slack asked for fewer requests, with HTTP 429 or
+	// the ratelimited code.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrProfileSetFailed means Slack failed to save the profile.
+	ErrProfileSetFailed = errors.New("profile set failed")
+	// ErrUnavailable means Slack answered with a server error.
+	ErrUnavailable = errors.New("slack unavailable")
+	// ErrMissingScope means the token lacks the OAuth scope a call needs,
+	// such as users:write for presence or dnd:write for snoozes.
+	ErrMissingScope = errors.New("missing scope")
+	// ErrSnoozeNotActive means there was no snooze to end.
+	ErrSnoozeNotActive = errors.New("snooze not active")
+)
+
+// RateLimitError is an HTTP 429 from Slack along with how long its
+// Retry-After asked callers to wait. It matches ErrSlackAPI and
+// ErrRateLimited.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: %s: retry after %s", ErrSlackAPI, ErrRateLimited, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() []error {
+	return []error{ErrSlackAPI, ErrRateLimited}
+}
+
+// Presence is what users.setPresence sets: auto lets Slack work it out from
+// activity, away shows the user as away regardless.
+type Presence string
+
+const (
+	PresenceAuto Presence = "auto"
+	PresenceAway Presence = "away"
+)
+
+const (
+	methodProfileSet  = "users.profile.set"
+	methodSetPresence = "users.setPresence"
+	methodSetSnooze   = "dnd.setSnooze"
+	methodEndSnooze   = "dnd.endSnooze"
+
+	contentTypeJSON = "application/json; charset=utf-8"
+	contentTypeForm = "application/x-www-form-urlencoded"
+)
+
+// errorCodes maps Slack error codes to the errors they are reported as.
+var errorCodes = map[string]error{
+	"invalid_auth":       ErrInvalidAuth,
+	"not_authed":         ErrInvalidAuth,
+	"account_inactive":   ErrTokenRevoked,
+	"token_revoked":      ErrTokenRevoked,
+	"ratelimited":        ErrRateLimited,
+	"profile_set_failed": ErrProfileSetFailed,
+	"missing_scope":      ErrMissingScope,
+	"snooze_not_active":  ErrSnoozeNotActive,
+}
 
 type Client struct {
 	userToken  string
 	httpClient *http.Client
-	apiURL     string
+	baseURL    string
+	profileURL string
+	attempts   int
+	backoff    time.Duration
 }
 
 func NewClient(userToken string) *Client {
 	return &Client{
 		userToken: userToken,
-		apiURL:    slackAPIURL,
+		baseURL:   slackAPIURL,
 		httpClient: &http.Client{
 			Timeout: requestTimeout,
 		},
+		attempts: defaultAttempts,
+		backoff:  defaultBackoff,
 	}
 }
 
+// WithBaseURL points the client at another Slack Web API, such as an
+// httptest stand-in. Each call is posted to url followed by "/" and the
+// method name, e.g. "/users.profile.set".
+func (c *Client) WithBaseURL(url string) *Client {
+	c.baseURL = url
+	c.profileURL = ""
+
+	return c
+}
+
+// WithAPIURL sets the users.profile.set endpoint SetStatus posts to. The
+// other methods are posted next to it, to url without a trailing
+// "/users.profile.set" followed by "/" and the method name.
+//
+// Deprecated: Use WithBaseURL, which takes the API's base URL.
 func (c *Client) WithAPIURL(url string) *Client {
-	c.apiURL = url
+	c.baseURL = strings.TrimSuffix(url, "/"+methodProfileSet)
+	c.profileURL = url
+
+	return c
+}
+
+// WithRetries sets how many times SetStatus tries in all and how long it
+// waits after the first failure, doubling after each one.
+func (c *Client) WithRetries(attempts int, backoff time.Duration) *Client {
+	c.attempts = max(attempts, 1)
+	c.backoff = backoff
 
 	return c
 }
 
+// Retryable reports whether err is worth trying again later: a rate limit, a
+// failure on Slack's side or a request that never got an answer. Auth errors
+// and anything else Slack rejects are not.
+func Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrProfileSetFailed) || errors.Is(err, ErrUnavailable) {
+		return true
+	}
+
+	return !errors.Is(err, ErrSlackAPI)
+}
+
+// apiError returns the error for a Slack error code.
+func apiError(code string) error {
+	if err, ok := errorCodes[code]; ok {
+		return fmt.Errorf("%w: %w", ErrSlackAPI, err)
+	}
+
+	return fmt.Errorf("%w: %s", ErrSlackAPI, code)
+}
+
 type ProfileStatus struct {
 	StatusText       string `json:"status_text"`       //nolint:tagliatelle // Slack API uses snake_case
 	StatusEmoji      string `json:"status_emoji"`      //nolint:tagliatelle // Slack API uses snake_case
@@ -56,6 +189,11 @@ type ProfileResponse struct {
 	Error string `json:"error,omitempty"`
 }
 
+// SetStatus sets the user's status text and emoji until expirationSeconds, a
+// Unix time, or for good when it is 0. Rate limits and transient failures are
+// retried with backoff, waiting at least as long as a 429's Retry-After asks.
+// Errors Slack reports wrap ErrSlackAPI and, for known codes, one of the
+// errors such as ErrTokenRevoked.
 func (c *Client) SetStatus(statusText, statusEmoji string, expirationSeconds int) error {
 	if len(statusText) > maxStatusLength {
 		statusText = statusText[:maxStatusLength]
@@ -74,15 +212,78 @@ func (c *Client) SetStatus(statusText, statusEmoji string, expirationSeconds int
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	return c.call(methodProfileSet, contentTypeJSON, payload)
+}
+
+// SetPresence sets the user's presence to auto or away.
+func (c *Client) SetPresence(presence Presence) error {
+	return c.call(methodSetPresence, contentTypeForm, []byte(url.Values{"presence": {string(presence)}}.Encode()))
+}
+
+// SetSnooze turns on Do Not Disturb for duration, rounded up to whole
+// minutes, replacing any snooze already running.
+func (c *Client) SetSnooze(duration time.Duration) error {
+	minutes := max(int((duration+time.Minute-1)/time.Minute), 1)
+
+	return c.call(methodSetSnooze, contentTypeForm, []byte(url.Values{"num_minutes": {strconv.Itoa(minutes)}}.Encode()))
+}
+
+// EndSnooze turns Do Not Disturb off. Ending a snooze that is not running is
+// not an error.
+func (c *Client) EndSnooze() error {
+	err := c.call(methodEndSnooze, contentTypeForm, nil)
+	if errors.Is(err, ErrSnoozeNotActive) {
+		return nil
+	}
+
+	return err
+}
+
+// call posts body to a Web API method, retrying rate limits and transient
+// failures with backoff.
+func (c *Client) call(method, contentType string, body []byte) error {
+	for attempt := 1; ; attempt++ {
+		err := c.post(method, contentType, body)
+		if attempt >= c.attempts || !Retryable(err) {
+			return err
+		}
+
+		var wait time.Duration
+
+		var rateLimit *RateLimitError
+		if errors.As(err, &rateLimit) {
+			wait = rateLimit.RetryAfter
+		}
+
+		delay := max(wait, c.backoff<<(attempt-1))
+		if delay > maxRetryDelay {
+			return err
+		}
+
+		slog.Warn("retrying Slack call", "method", method, "error", err, "attempt", attempt, "delay", delay)
+		time.Sleep(delay)
+	}
+}
+
+func (c *Client) methodURL(method string) string {
+	if method == methodProfileSet && c.profileURL != "" {
+		return c.profileURL
+	}
+
+	return c.baseURL + "/" + method
+}
+
+// post sends one request to a Web API method.
+func (c *Client) post(method, contentType string, body []byte) error {
 	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
 	defer cancel()
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL, bytes.NewReader(payload))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.methodURL(method), bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
+	httpReq.Header.Set("Content-Type", contentType)
 	httpReq.Header.Set("Authorization", "Bearer "+c.userToken)
 
 	resp, err := c.httpClient.Do(httpReq)
@@ -91,25 +292,42 @@ func (c *Client) SetStatus(statusText, statusEmoji string, expirationSeconds int
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return &RateLimitError{RetryAfter: retryAfter(resp.Header)}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("%w: %w: HTTP %d", ErrSlackAPI, ErrUnavailable, resp.StatusCode)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
 	var slackResp ProfileResponse
 
-	err = json.Unmarshal(body, &slackResp)
+	err = json.Unmarshal(respBody, &slackResp)
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
 	if !slackResp.Ok {
-		return fmt.Errorf("%w: %s", ErrSlackAPI, slackResp.Error)
+		return apiError(slackResp.Error)
 	}
 
 	return nil
 }
 
+// retryAfter reads a Retry-After header in seconds, as Slack sends it.
+func retryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
 func (c *Client) ClearStatus() error {
 	return c.SetStatus("", "", 0)
 }
@@ -2,10 +2,15 @@ package slack_test
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/benwsapp/rlgl/pkg/slack"
 )
@@ -16,7 +21,7 @@ func TestSetStatusSuccess(t *testing.T) {
 	server := createMockServer(t, slack.ProfileResponse{Ok: true})
 	defer server.Close()
 
-	client := slack.NewClient("test-token").WithAPIURL(server.URL)
+	client := slack.NewClient("test-token").WithBaseURL(server.URL)
 
 	err := client.SetStatus("Working on feature", ":computer:", 0)
 	if err != nil {
@@ -33,7 +38,7 @@ func TestSetStatusSlackAPIError(t *testing.T) {
 	})
 	defer server.Close()
 
-	client := slack.NewClient("test-token").WithAPIURL(server.URL)
+	client := slack.NewClient("test-token").WithBaseURL(server.URL)
 
 	err := client.SetStatus("Test status", ":test:", 0)
 	if err == nil {
@@ -51,7 +56,7 @@ func TestSetStatusEmptyStatus(t *testing.T) {
 	server := createMockServer(t, slack.ProfileResponse{Ok: true})
 	defer server.Close()
 
-	client := slack.NewClient("test-token").WithAPIURL(server.URL)
+	client := slack.NewClient("test-token").WithBaseURL(server.URL)
 
 	err := client.SetStatus("", "", 0)
 	if err != nil {
@@ -87,7 +92,7 @@ func TestSetStatusLongTextTruncation(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client := slack.NewClient("test-token").WithAPIURL(server.URL)
+	client := slack.NewClient("test-token").WithBaseURL(server.URL)
 
 	err := client.SetStatus(longStatusText, ":long:", 0)
 	if err != nil {
@@ -123,7 +128,7 @@ func TestClearStatus(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client := slack.NewClient("test-token").WithAPIURL(server.URL)
+	client := slack.NewClient("test-token").WithBaseURL(server.URL)
 
 	err := client.ClearStatus()
 	if err != nil {
@@ -131,6 +136,234 @@ func TestClearStatus(t *testing.T) {
 	}
 }
 
+func TestSetStatusClassifiesErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		code string
+		want error
+	}{
+		{"invalid_auth", slack.ErrInvalidAuth},
+		{"token_revoked", slack.ErrTokenRevoked},
+		{"ratelimited", slack.ErrRateLimited},
+		{"profile_set_failed", slack.ErrProfileSetFailed},
+	}
+
+	for _, test := range tests {
+		server := createMockServer(t, slack.ProfileResponse{Ok: false, Error: test.code})
+
+		err := slack.NewClient("test-token").WithBaseURL(server.URL).WithRetries(1, 0).SetStatus("Testing", ":test:", 0)
+		if !errors.Is(err, test.want) || !errors.Is(err, slack.ErrSlackAPI) {
+			t.Errorf("%s: expected %v wrapping ErrSlackAPI, got %v", test.code, test.want, err)
+		}
+
+		server.Close()
+	}
+}
+
+// countingServer answers with each response in turn, then keeps repeating
+// the last, and counts the requests.
+func countingServer(t *testing.T, responses ...func(http.ResponseWriter)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, _ *http.Request) {
+		call := int(calls.Add(1))
+		responses[min(call, len(responses))-1](responseWriter)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+func respondOK(responseWriter http.ResponseWriter) {
+	_ = json.NewEncoder(responseWriter).Encode(slack.ProfileResponse{Ok: true})
+}
+
+func respondTooManyRequests(retryAfter string) func(http.ResponseWriter) {
+	return func(responseWriter http.ResponseWriter) {
+		responseWriter.Header().Set("Retry-After", retryAfter)
+		responseWriter.WriteHeader(http.StatusTooManyRequests)
+	}
+}
+
+func TestSetStatusHonorsRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	server, calls := countingServer(t, respondTooManyRequests("1"), respondOK)
+
+	start := time.Now()
+
+	err := slack.NewClient("test-token").WithBaseURL(server.URL).WithRetries(3, time.Millisecond).SetStatus("Testing", ":test:", 0)
+	if err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected the retry to wait out Retry-After, waited %s", elapsed)
+	}
+
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 requests, got %d", calls.Load())
+	}
+}
+
+func TestSetStatusRetriesTransientFailures(t *testing.T) {
+	t.Parallel()
+
+	unavailable := func(responseWriter http.ResponseWriter) {
+		responseWriter.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	server, calls := countingServer(t, unavailable, unavailable, respondOK)
+
+	err := slack.NewClient("test-token").WithBaseURL(server.URL).WithRetries(3, time.Millisecond).SetStatus("Testing", ":test:", 0)
+	if err != nil || calls.Load() != 3 {
+		t.Errorf("expected success on the third attempt, got %v after %d", err, calls.Load())
+	}
+
+	server, calls = countingServer(t, unavailable)
+
+	err = slack.NewClient("test-token").WithBaseURL(server.URL).WithRetries(2, time.Millisecond).SetStatus("Testing", ":test:", 0)
+	if !errors.Is(err, slack.ErrUnavailable) || calls.Load() != 2 {
+		t.Errorf("expected ErrUnavailable after 2 attempts, got %v after %d", err, calls.Load())
+	}
+}
+
+func TestSetStatusGivesUpWithoutRetrying(t *testing.T) {
+	t.Parallel()
+
+	revoked := func(responseWriter http.ResponseWriter) {
+		_ = json.NewEncoder(responseWriter).Encode(slack.ProfileResponse{Ok: false, Error: "token_revoked"})
+	}
+
+	for name, respond := range map[string]func(http.ResponseWriter){
+		"revoked token":    revoked,
+		"long Retry-After": respondTooManyRequests("3600"),
+	} {
+		server, calls := countingServer(t, respond)
+
+		err := slack.NewClient("test-token").WithBaseURL(server.URL).WithRetries(3, time.Millisecond).SetStatus("Testing", ":test:", 0)
+		if err == nil || calls.Load() != 1 {
+			t.Errorf("%s: expected to give up after one request, got %v after %d", name, err, calls.Load())
+		}
+	}
+}
+
+func TestSetStatusReturnsLongRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	server, _ := countingServer(t, respondTooManyRequests("120"))
+
+	err := slack.NewClient("test-token").WithBaseURL(server.URL).SetStatus("Testing", ":test:", 0)
+
+	var rateLimit *slack.RateLimitError
+	if !errors.As(err, &rateLimit) || rateLimit.RetryAfter != 2*time.Minute {
+		t.Fatalf("expected a RateLimitError asking for 2m, got %v", err)
+	}
+
+	if !errors.Is(err, slack.ErrRateLimited) || !errors.Is(err, slack.ErrSlackAPI) {
+		t.Errorf("expected the error to match ErrRateLimited and ErrSlackAPI, got %v", err)
+	}
+}
+
+// recordingServer answers ok to every call and records each as its path and
+// form.
+func recordingServer(t *testing.T, response slack.ProfileResponse) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer test-token" {
+			t.Error("expected Authorization header with Bearer token")
+		}
+
+		err := req.ParseForm()
+		if err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+
+		mu.Lock()
+		calls = append(calls, req.URL.Path+"?"+req.PostForm.Encode())
+		mu.Unlock()
+
+		_ = json.NewEncoder(responseWriter).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return slices.Clone(calls)
+	}
+}
+
+func TestSetPresenceAndSnooze(t *testing.T) {
+	t.Parallel()
+
+	server, calls := recordingServer(t, slack.ProfileResponse{Ok: true})
+	client := slack.NewClient("test-token").WithBaseURL(server.URL)
+
+	err := errors.Join(
+		client.SetPresence(slack.PresenceAway),
+		client.SetSnooze(89*time.Minute+30*time.Second),
+		client.EndSnooze(),
+		client.SetPresence(slack.PresenceAuto),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"/users.setPresence?presence=away",
+		"/dnd.setSnooze?num_minutes=90",
+		"/dnd.endSnooze?",
+		"/users.setPresence?presence=auto",
+	}
+	if got := calls(); !slices.Equal(got, want) {
+		t.Errorf("expected calls %v, got %v", want, got)
+	}
+}
+
+func TestWithAPIURLTakesProfileEndpoint(t *testing.T) {
+	t.Parallel()
+
+	server, calls := recordingServer(t, slack.ProfileResponse{Ok: true})
+	client := slack.NewClient("test-token").WithAPIURL(server.URL + "/api/users.profile.set") //nolint:staticcheck // the deprecated option must keep working
+
+	err := errors.Join(client.SetStatus("Testing", ":test:", 0), client.EndSnooze())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := calls()
+	if len(got) != 2 || !strings.HasPrefix(got[0], "/api/users.profile.set?") || got[1] != "/api/dnd.endSnooze?" {
+		t.Errorf("expected the profile endpoint to be used as given, got %v", got)
+	}
+}
+
+func TestEndSnoozeWithoutSnooze(t *testing.T) {
+	t.Parallel()
+
+	server, _ := recordingServer(t, slack.ProfileResponse{Ok: false, Error: "snooze_not_active"})
+
+	err := slack.NewClient("test-token").WithBaseURL(server.URL).EndSnooze()
+	if err != nil {
+		t.Errorf("expected ending no snooze to succeed, got %v", err)
+	}
+
+	err = slack.NewClient("test-token").WithBaseURL(server.URL).SetPresence(slack.PresenceAway)
+	if !errors.Is(err, slack.ErrSnoozeNotActive) {
+		t.Errorf("expected other calls to report the error, got %v", err)
+	}
+}
+
 func createMockServer(t *testing.T, response slack.ProfileResponse) *httptest.Server {
 	t.Helper()
 
@@ -0,0 +1,25 @@
+package wsclient
+
+import "github.com/benwsapp/rlgl/pkg/schedule"
+
+// WithBackoff sets the reconnect backoff, so tests need not wait out the
+// default one.
+func (r *Runner) WithBackoff(backoff Backoff) *Runner {
+	r.backoff = backoff
+
+	return r
+}
+
+// WithClock evaluates schedules against clock rather than the wall clock.
+func (r *Runner) WithClock(clock schedule.Clock) *Runner {
+	r.scheduler = schedule.New(clock)
+
+	return r
+}
+
+// WithSlackAPIURL points WithClearSlack at a fake Slack API.
+func (r *Runner) WithSlackAPIURL(url string) *Runner {
+	r.slackAPIURL = url
+
+	return r
+}
@@ -0,0 +1,140 @@
+package wsclient
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+var ErrResponseTimeout = errors.New("timed out waiting for response")
+
+// CommandHandler handles a command from the server. Handlers run on the
+// connection's read loop, so they must return quickly and must not wait for
+// a reply from the server themselves.
+type CommandHandler func(msg Message)
+
+// reader reads a connection's messages on its own goroutine, handing
+// commands to their handlers and everything else to whoever is waiting for
+// a reply.
+type reader struct {
+	replies chan Message
+	done    chan struct{}
+	err     error
+}
+
+// HandleCommand calls handler for every command of that kind from the
+// server, replacing any handler set before. Commands without a handler are
+// logged and dropped.
+func (c *Client) HandleCommand(command protocol.Command, handler CommandHandler) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.handlers[command] = handler
+}
+
+func (c *Client) handler(command protocol.Command) CommandHandler {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	return c.handlers[command]
+}
+
+// startReading starts the read loop once the handshake is done.
+func (c *Client) startReading() {
+	// The loop waits for the server for as long as the connection lasts;
+	// each reply is waited for with its own timeout instead.
+	_ = c.conn.SetReadDeadline(time.Time{})
+
+	c.reader = &reader{
+		// One reply is buffered, as it can arrive before anyone waits for it.
+		replies: make(chan Message, 1),
+		done:    make(chan struct{}),
+	}
+
+	go c.readLoop(c.conn, c.reader)
+}
+
+func (c *Client) readLoop(conn *websocket.Conn, r *reader) {
+	defer close(r.done)
+
+	for {
+		var msg Message
+
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			r.err = err
+
+			return
+		}
+
+		if msg.Type == protocol.TypeCommand {
+			c.dispatch(msg)
+
+			continue
+		}
+
+		select {
+		case r.replies <- msg:
+		default:
+			slog.Warn("dropped unexpected message from server", "type", msg.Type)
+		}
+	}
+}
+
+func (c *Client) dispatch(msg Message) {
+	slog.Debug("received command from server", "command", msg.Command)
+
+	handler := c.handler(msg.Command)
+	if handler == nil {
+		slog.Info("ignored command from server", "command", msg.Command, "text", msg.Text)
+
+		return
+	}
+
+	handler(msg)
+}
+
+// readResponse waits a bounded time for the server's reply, so a dead
+// connection surfaces as an error instead of blocking forever. A reply that
+// is too late would be taken for the answer to the next request, so the
+// connection is closed instead.
+func (c *Client) readResponse() (Message, error) {
+	if c.reader == nil {
+		return c.readHandshake()
+	}
+
+	timer := time.NewTimer(responseTimeout)
+	defer timer.Stop()
+
+	select {
+	case response := <-c.reader.replies:
+		return response, nil
+	case <-c.reader.done:
+		return Message{}, fmt.Errorf("failed to read message: %w", c.reader.err)
+	case <-timer.C:
+		_ = c.conn.Close()
+
+		return Message{}, ErrResponseTimeout
+	}
+}
+
+// readHandshake reads the reply to the hello, before the read loop starts.
+func (c *Client) readHandshake() (Message, error) {
+	var response Message
+
+	err := c.conn.SetReadDeadline(time.Now().Add(responseTimeout))
+	if err != nil {
+		return response, fmt.Errorf("failed to set read deadline: %w", err)
+	}
+
+	err = c.conn.ReadJSON(&response)
+	if err != nil {
+		return response, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,382 @@
+package wsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"reflect"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/protocol"
+	"github.com/benwsapp/rlgl/pkg/schedule"
+	"github.com/benwsapp/rlgl/pkg/slack"
+)
+
+const (
+	defaultInitialBackoff = 1 * time.Second
+	defaultMaxBackoff     = 30 * time.Second
+	defaultKeepalive      = 15 * time.Second
+
+	// scheduleCheckInterval is how often the schedule is re-evaluated, so a
+	// scheduled change is pushed even when the file has not changed.
+	scheduleCheckInterval = time.Minute
+
+	// maxBackoffShift stops the doubling before it can overflow.
+	maxBackoffShift = 30
+)
+
+// ConnState is the connection state a Runner reports in its logs.
+type ConnState string
+
+const (
+	StateDisconnected ConnState = "disconnected"
+	StateConnecting   ConnState = "connecting"
+	StateConnected    ConnState = "connected"
+)
+
+// Backoff is a capped exponential backoff. Each delay is jittered to between
+// half and all of its nominal value so that clients restarted together do not
+// reconnect in lockstep.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// DefaultBackoff waits 1s after the first failure, doubling up to 30s.
+func DefaultBackoff() Backoff {
+	return Backoff{Initial: defaultInitialBackoff, Max: defaultMaxBackoff}
+}
+
+// Delay returns the jittered wait before reconnect attempt number attempt,
+// counting from zero.
+func (b Backoff) Delay(attempt int) time.Duration {
+	delay := b.Max
+
+	if attempt < maxBackoffShift && b.Initial<<attempt < b.Max {
+		delay = b.Initial << attempt
+	}
+
+	half := delay / 2
+
+	// #nosec G404 - jitter does not need a cryptographic source
+	return half + rand.N(half+1)
+}
+
+// Runner keeps a client connected and pushes the config on every interval.
+// Whenever the connection drops it reconnects with backoff and re-pushes the
+// latest config from disk. In watch mode it also pushes as soon as the config
+// file changes, and the interval only serves as a slow fallback resync.
+//
+// Every pushed config shows the status its schedule and override call for,
+// not just the status written in the file.
+type Runner struct {
+	client     *Client
+	configPath string
+	interval   time.Duration
+	keepalive  time.Duration
+	backoff    Backoff
+	debounce   time.Duration
+	scheduler  *schedule.Scheduler
+	state      ConnState
+
+	// clearSlack clears the Slack status when Run stops, using slackAPIURL
+	// if set.
+	clearSlack  bool
+	slackAPIURL string
+
+	// lastPushed is the config the server acknowledged on this connection.
+	lastPushed *embed.SiteConfig
+
+	// resync is signalled when the server asks for the config again.
+	resync chan struct{}
+}
+
+func NewRunner(client *Client, configPath string, interval time.Duration) *Runner {
+	runner := &Runner{
+		client:     client,
+		configPath: configPath,
+		interval:   interval,
+		keepalive:  defaultKeepalive,
+		backoff:    DefaultBackoff(),
+		scheduler:  schedule.New(schedule.SystemClock{}),
+		state:      StateDisconnected,
+		resync:     make(chan struct{}, 1),
+	}
+
+	client.HandleCommand(protocol.CommandResync, runner.handleResync)
+	client.HandleCommand(protocol.CommandNudge, handleNudge)
+	client.HandleCommand(protocol.CommandShutdown, handleShutdown)
+	client.HandleCommand(protocol.CommandTokenRotated, handleTokenRotated)
+
+	return runner
+}
+
+// WithKeepalive sets how often an idle connection is pinged to detect that it
+// has died between pushes.
+func (r *Runner) WithKeepalive(keepalive time.Duration) *Runner {
+	r.keepalive = keepalive
+
+	return r
+}
+
+// WithClearSlack clears the Slack status set from the config's Slack settings
+// when Run stops, so a stopped client does not leave its last status behind.
+func (r *Runner) WithClearSlack() *Runner {
+	r.clearSlack = true
+
+	return r
+}
+
+// WithWatch pushes whenever the config file changes, once it has been quiet
+// for debounce. Changes that leave the parsed config as it was are not pushed.
+func (r *Runner) WithWatch(debounce time.Duration) *Runner {
+	r.debounce = debounce
+
+	return r
+}
+
+// Run pushes the config until ctx is done, reconnecting as needed. It gives
+// up early only if the server refuses the handshake.
+func (r *Runner) Run(ctx context.Context) error {
+	defer r.leave()
+
+	changes, stopWatching, err := r.watchConfig(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopWatching()
+
+	defer r.clearSlackStatus()
+
+	// The client is heard from at least on every push and keepalive ping.
+	r.client.SetHeartbeat(min(r.interval, r.keepalive))
+
+	slog.Info("client started", "interval", r.interval, "config", r.configPath, "watch", changes != nil)
+
+	attempt := 0
+
+	for {
+		connected, err := r.session(ctx, changes)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// Reconnecting will not make an incompatible server any more willing.
+		if errors.Is(err, ErrHandshakeRefused) {
+			return err
+		}
+
+		if connected {
+			attempt = 0
+		}
+
+		delay := r.backoff.Delay(attempt)
+		attempt++
+
+		slog.Warn("connection lost, reconnecting", "error", err, "attempt", attempt, "delay", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// watchConfig starts watching the config file when pushes on change are
+// enabled. The channel is nil otherwise.
+func (r *Runner) watchConfig(ctx context.Context) (<-chan struct{}, func(), error) {
+	if r.debounce <= 0 {
+		return nil, func() {}, nil
+	}
+
+	watcher, err := newConfigWatcher(r.configPath, r.debounce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	go watcher.run(ctx)
+
+	return watcher.C, func() { _ = watcher.Close() }, nil
+}
+
+// session connects, pushes the config and keeps pushing until the connection
+// fails. It reports whether the connection was established at all.
+func (r *Runner) session(ctx context.Context, changes <-chan struct{}) (bool, error) {
+	r.setState(StateConnecting)
+
+	err := r.client.ConnectContext(ctx)
+	if err != nil {
+		r.setState(StateDisconnected)
+
+		return false, err
+	}
+
+	r.setState(StateConnected)
+
+	err = r.pushLoop(ctx, changes)
+	r.disconnect(err)
+
+	return true, err
+}
+
+func (r *Runner) pushLoop(ctx context.Context, changes <-chan struct{}) error {
+	push := time.NewTicker(r.interval)
+	defer push.Stop()
+
+	keepalive := time.NewTicker(r.keepalive)
+	defer keepalive.Stop()
+
+	scheduled := time.NewTicker(scheduleCheckInterval)
+	defer scheduled.Stop()
+
+	err := r.push(false)
+
+	for err == nil {
+		select {
+		case <-push.C:
+			err = r.push(false)
+		case <-changes:
+			err = r.push(true)
+		case <-scheduled.C:
+			err = r.push(true)
+		case <-r.resync:
+			err = r.push(false)
+		case <-keepalive.C:
+			err = r.client.Ping()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	return err
+}
+
+// push sends the latest config, or nothing if skipUnchanged is set and the
+// server already has it. Only connection failures are returned; a bad config
+// file or a rejected push is logged and retried on the next tick.
+func (r *Runner) push(skipUnchanged bool) error {
+	config, err := embed.LoadSiteConfig(r.configPath)
+	if err != nil {
+		slog.Error("failed to load config", "error", err)
+
+		return nil
+	}
+
+	config, reason := r.scheduler.Apply(config)
+	slog.Debug("applied schedule", "status", config.Contributor.Status, "reason", reason)
+
+	if skipUnchanged && r.lastPushed != nil && reflect.DeepEqual(*r.lastPushed, config) {
+		slog.Debug("config unchanged, skipping push")
+
+		return nil
+	}
+
+	err = r.client.PushConfig(config)
+	if errors.Is(err, ErrServerError) {
+		slog.Error("server rejected config", "error", err)
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to push config: %w", err)
+	}
+
+	r.lastPushed = &config
+
+	return nil
+}
+
+// clearSlackStatus clears the Slack status of the user in the config, if
+// WithClearSlack is set and the config syncs to Slack at all.
+func (r *Runner) clearSlackStatus() {
+	if !r.clearSlack {
+		return
+	}
+
+	config, err := embed.LoadSiteConfig(r.configPath)
+	if err != nil {
+		slog.Error("failed to load config to clear Slack status", "error", err)
+
+		return
+	}
+
+	if !config.Slack.Enabled || config.Slack.UserToken == "" {
+		return
+	}
+
+	client := slack.NewClient(config.Slack.UserToken)
+	if r.slackAPIURL != "" {
+		client = client.WithBaseURL(r.slackAPIURL)
+	}
+
+	err = client.ClearStatus()
+	if err != nil {
+		slog.Error("failed to clear Slack status", "error", err, "user", config.User)
+
+		return
+	}
+
+	slog.Info("cleared Slack status", "user", config.User)
+}
+
+// handleResync asks pushLoop to push the config now. Requests that arrive
+// before it gets round to it are folded into one push.
+func (r *Runner) handleResync(Message) {
+	slog.Info("server asked for a resync")
+
+	select {
+	case r.resync <- struct{}{}:
+	default:
+	}
+}
+
+func handleNudge(msg Message) {
+	slog.Warn("nudged from the dashboard", "text", msg.Text)
+}
+
+func handleShutdown(msg Message) {
+	slog.Info("server is shutting down, will reconnect", "text", msg.Text)
+}
+
+func handleTokenRotated(msg Message) {
+	slog.Error("auth token was rotated or revoked, update the client's token", "text", msg.Text)
+}
+
+// leave closes the connection as Run stops, telling the server the client
+// has stopped for good.
+func (r *Runner) leave() {
+	err := r.client.Leave()
+	if err != nil {
+		slog.Debug("failed to close connection", "error", err)
+	}
+
+	r.disconnect(nil)
+}
+
+func (r *Runner) disconnect(cause error) {
+	r.lastPushed = nil
+
+	closeErr := r.client.Close()
+	if closeErr != nil {
+		slog.Debug("failed to close connection", "error", closeErr)
+	}
+
+	if r.state != StateDisconnected {
+		slog.Info("connection state changed", "from", r.state, "to", StateDisconnected, "error", cause)
+		r.state = StateDisconnected
+	}
+}
+
+func (r *Runner) setState(state ConnState) {
+	if r.state == state {
+		return
+	}
+
+	slog.Info("connection state changed", "from", r.state, "to", state)
+	r.state = state
+}
@@ -0,0 +1,326 @@
+package wsclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/protocol"
+	"github.com/benwsapp/rlgl/pkg/schedule"
+	"github.com/benwsapp/rlgl/pkg/slack"
+	"github.com/benwsapp/rlgl/pkg/wsclient"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+// trackingListener remembers accepted connections so a test can drop them,
+// including hijacked WebSocket connections that http.Server.Close leaves open.
+type trackingListener struct {
+	net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	l.mu.Lock()
+	l.conns = append(l.conns, conn)
+	l.mu.Unlock()
+
+	return conn, nil
+}
+
+func (l *trackingListener) closeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, conn := range l.conns {
+		_ = conn.Close()
+	}
+}
+
+// startServer serves a wsserver on addr and returns a function that stops it
+// and drops every open connection, as a server restart would.
+func startServer(t *testing.T, addr string, store wsserver.Store) (string, func()) {
+	t.Helper()
+
+	var listenConfig net.ListenConfig
+
+	inner, err := listenConfig.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", addr, err)
+	}
+
+	listener := &trackingListener{Listener: inner}
+	server := &http.Server{
+		Handler:           wsserver.Handler(store, "test-token"),
+		ReadHeaderTimeout: time.Second,
+	}
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	var once sync.Once
+
+	stop := func() {
+		once.Do(func() {
+			_ = server.Close()
+			listener.closeAll()
+		})
+	}
+
+	t.Cleanup(stop)
+
+	return inner.Addr().String(), stop
+}
+
+func waitForConfig(t *testing.T, store wsserver.Store, clientID string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		_, ok := store.Get(clientID)
+		if ok {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for %s to push its config", clientID)
+}
+
+func TestBackoffDelay(t *testing.T) {
+	t.Parallel()
+
+	backoff := wsclient.Backoff{Initial: 100 * time.Millisecond, Max: time.Second}
+
+	tests := []struct {
+		attempt int
+		nominal time.Duration
+	}{
+		{attempt: 0, nominal: 100 * time.Millisecond},
+		{attempt: 1, nominal: 200 * time.Millisecond},
+		{attempt: 3, nominal: 800 * time.Millisecond},
+		{attempt: 4, nominal: time.Second},
+		{attempt: 100, nominal: time.Second},
+	}
+
+	for _, tt := range tests {
+		for range 20 {
+			delay := backoff.Delay(tt.attempt)
+			if delay < tt.nominal/2 || delay > tt.nominal {
+				t.Errorf("attempt %d: expected delay in [%v, %v], got %v", tt.attempt, tt.nominal/2, tt.nominal, delay)
+			}
+		}
+	}
+}
+
+func TestRunnerReconnectsAfterServerRestart(t *testing.T) {
+	t.Parallel()
+
+	configPath := createTestConfig(t)
+
+	firstStore := wsserver.NewStore()
+	addr, stop := startServer(t, "127.0.0.1:0", firstStore)
+
+	client := wsclient.NewClient("ws://"+addr, "test-client", "test-token")
+	runner := wsclient.NewRunner(client, configPath, time.Hour).
+		WithBackoff(wsclient.Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond}).
+		WithKeepalive(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- runner.Run(ctx)
+	}()
+
+	waitForConfig(t, firstStore, "test-client")
+
+	stop()
+
+	// The push interval is an hour, so the config can only reach the new
+	// server through the re-push that follows a reconnect.
+	secondStore := wsserver.NewStore()
+	startServer(t, addr, secondStore)
+
+	waitForConfig(t, secondStore, "test-client")
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runner did not stop after cancel")
+	}
+}
+
+func TestRunnerPushesOnResync(t *testing.T) {
+	t.Parallel()
+
+	registry := auth.NewRegistry()
+	_ = registry.Register("test-token", auth.AnyClientID)
+
+	store := wsserver.NewStore()
+	conns := wsserver.NewConnections()
+
+	server := httptest.NewServer(conns.Handler(store, wsserver.NewRuntime(), registry))
+	defer server.Close()
+
+	client := wsclient.NewClient("ws"+strings.TrimPrefix(server.URL, "http"), "test-client", "test-token")
+	runner := wsclient.NewRunner(client, createTestConfig(t), time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = runner.Run(ctx)
+	}()
+
+	waitForConfig(t, store, "test-client")
+
+	_, _ = store.Delete("test-client")
+
+	// The push interval is an hour, so only the resync can bring it back.
+	if delivered := conns.Send("test-client", protocol.CommandResync, ""); delivered != 1 {
+		t.Fatalf("expected the resync to reach the runner, got %d", delivered)
+	}
+
+	waitForConfig(t, store, "test-client")
+}
+
+func TestRunnerStopsWhileReconnecting(t *testing.T) {
+	t.Parallel()
+
+	configPath := createTestConfig(t)
+
+	client := wsclient.NewClient("ws://127.0.0.1:1/ws", "test-client", "test-token")
+	runner := wsclient.NewRunner(client, configPath, time.Second).
+		WithBackoff(wsclient.Backoff{Initial: 10 * time.Millisecond, Max: 20 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err := runner.Run(ctx)
+	if err != nil {
+		t.Errorf("expected nil error on cancel, got %v", err)
+	}
+
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("expected runner to keep retrying until the deadline, got %v", ctx.Err())
+	}
+}
+
+func TestRunnerPushesScheduledStatus(t *testing.T) {
+	t.Parallel()
+
+	configPath := filepath.Join(t.TempDir(), "rlgl.yaml")
+	content := `user: "testuser"
+contributor:
+  status: green
+schedule:
+  timezone: UTC
+  working_hours:
+    start: "09:00"
+    end: "17:00"
+`
+
+	err := os.WriteFile(configPath, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	store := wsserver.NewStore()
+	addr, _ := startServer(t, "127.0.0.1:0", store)
+
+	clock := schedule.NewFakeClock(time.Date(2026, time.October, 6, 20, 0, 0, 0, time.UTC))
+	client := wsclient.NewClient("ws://"+addr, "test-client", "test-token")
+	runner := wsclient.NewRunner(client, configPath, time.Hour).WithClock(clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go func() {
+		_ = runner.Run(ctx)
+	}()
+
+	waitForConfig(t, store, "test-client")
+
+	config, _ := store.Get("test-client")
+	if config.Contributor.Status != embed.StatusRed || config.Contributor.Active {
+		t.Errorf("expected red after hours, got %+v", config.Contributor)
+	}
+}
+
+func TestRunnerClearsSlackStatusOnStop(t *testing.T) {
+	t.Parallel()
+
+	configPath := filepath.Join(t.TempDir(), "rlgl.yaml")
+	content := `user: "testuser"
+contributor:
+  status: red
+slack:
+  enabled: true
+  user_token: "xoxp-test"
+`
+
+	err := os.WriteFile(configPath, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cleared := make(chan string, 1)
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, req *http.Request) {
+		var body slack.ProfileRequest
+
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		cleared <- body.Profile.StatusText + body.Profile.StatusEmoji
+
+		_ = json.NewEncoder(responseWriter).Encode(slack.ProfileResponse{Ok: true})
+	}))
+	t.Cleanup(slackAPI.Close)
+
+	client := wsclient.NewClient("ws://127.0.0.1:1/ws", "test-client", "test-token")
+	runner := wsclient.NewRunner(client, configPath, time.Hour).
+		WithBackoff(wsclient.Backoff{Initial: 10 * time.Millisecond, Max: 20 * time.Millisecond}).
+		WithClearSlack().
+		WithSlackAPIURL(slackAPI.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = runner.Run(ctx)
+	if err != nil {
+		t.Fatalf("expected nil error on cancel, got %v", err)
+	}
+
+	select {
+	case status := <-cleared:
+		if status != "" {
+			t.Errorf("expected an empty Slack status, got %q", status)
+		}
+	default:
+		t.Error("expected the Slack status to be cleared on stop")
+	}
+}
@@ -0,0 +1,36 @@
+package wsclient_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benwsapp/rlgl/pkg/wsclient"
+)
+
+func TestLoadTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	config, err := wsclient.LoadTLSConfig("", "", "")
+	if err != nil || config != nil {
+		t.Errorf("expected no TLS config without any files, got %v, %v", config, err)
+	}
+
+	_, err = wsclient.LoadTLSConfig("", "client.pem", "")
+	if !errors.Is(err, wsclient.ErrClientKeyPairIncomplete) {
+		t.Errorf("expected ErrClientKeyPairIncomplete, got %v", err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+
+	err = os.WriteFile(caFile, []byte("not a certificate"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+
+	_, err = wsclient.LoadTLSConfig(caFile, "", "")
+	if !errors.Is(err, wsclient.ErrNoCACerts) {
+		t.Errorf("expected ErrNoCACerts, got %v", err)
+	}
+}
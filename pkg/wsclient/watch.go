@@ -0,0 +1,111 @@
+package wsclient
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce is how long the config file must stay quiet after a
+// change before it is pushed, so editors that save in several steps (truncate,
+// write, rename) trigger a single push.
+const DefaultWatchDebounce = 250 * time.Millisecond
+
+// configWatcher signals on C once the config file has settled after a change.
+type configWatcher struct {
+	C <-chan struct{}
+
+	changes  chan struct{}
+	watcher  *fsnotify.Watcher
+	path     string
+	debounce time.Duration
+}
+
+// newConfigWatcher watches the directory holding path rather than the file
+// itself, because editors often replace the file and a watch on the old inode
+// would go silent.
+func newConfigWatcher(path string, debounce time.Duration) (*configWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	cleanPath := filepath.Clean(path)
+
+	err = watcher.Add(filepath.Dir(cleanPath))
+	if err != nil {
+		_ = watcher.Close()
+
+		return nil, fmt.Errorf("failed to watch config directory: %w", err)
+	}
+
+	changes := make(chan struct{}, 1)
+
+	return &configWatcher{
+		C:        changes,
+		changes:  changes,
+		watcher:  watcher,
+		path:     cleanPath,
+		debounce: debounce,
+	}, nil
+}
+
+// run forwards debounced change notifications until ctx is done.
+func (w *configWatcher) run(ctx context.Context) {
+	settle := time.NewTimer(w.debounce)
+	settle.Stop()
+
+	defer settle.Stop()
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+
+			w.onEvent(event, settle)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			slog.Warn("config watcher error", "error", err)
+		case <-settle.C:
+			w.notify()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// onEvent restarts the settle timer for changes to the config file, ignoring
+// its siblings and permission-only changes.
+func (w *configWatcher) onEvent(event fsnotify.Event, settle *time.Timer) {
+	if filepath.Clean(event.Name) != w.path || event.Op == fsnotify.Chmod {
+		return
+	}
+
+	settle.Reset(w.debounce)
+}
+
+// notify signals a change without blocking; one pending signal is enough.
+func (w *configWatcher) notify() {
+	select {
+	case w.changes <- struct{}{}:
+	default:
+	}
+}
+
+func (w *configWatcher) Close() error {
+	err := w.watcher.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close watcher: %w", err)
+	}
+
+	return nil
+}
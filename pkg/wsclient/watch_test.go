@@ -0,0 +1,107 @@
+package wsclient_test
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/wsclient"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+// countingStore counts every push the server receives, including identical ones.
+type countingStore struct {
+	wsserver.Store
+
+	sets atomic.Int32
+}
+
+func (s *countingStore) Update(clientID string, change wsserver.UpdateFunc) (embed.SiteConfig, error) {
+	s.sets.Add(1)
+
+	return s.Store.Update(clientID, change) //nolint:wrapcheck
+}
+
+func writeConfig(t *testing.T, path, focus string) {
+	t.Helper()
+
+	content := "name: \"Test Site\"\nuser: \"testuser\"\ncontributor:\n  active: true\n  focus: \"" + focus + "\"\n"
+
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+func waitForFocus(t *testing.T, store wsserver.Store, focus string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		config, ok := store.Get("test-client")
+		if ok && config.Contributor.Focus == focus {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for focus %q", focus)
+}
+
+func TestRunnerWatchPushesOnChange(t *testing.T) {
+	t.Parallel()
+
+	configPath := createTestConfig(t)
+	writeConfig(t, configPath, "first")
+
+	store := &countingStore{Store: wsserver.NewStore()}
+	addr, _ := startServer(t, "127.0.0.1:0", store)
+
+	debounce := 50 * time.Millisecond
+	client := wsclient.NewClient("ws://"+addr, "test-client", "test-token")
+	runner := wsclient.NewRunner(client, configPath, time.Hour).WithWatch(debounce)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go func() {
+		_ = runner.Run(ctx)
+	}()
+
+	waitForFocus(t, store, "first")
+
+	// An editor saving in several quick steps should cause a single push.
+	writeConfig(t, configPath, "")
+	writeConfig(t, configPath, "second")
+	waitForFocus(t, store, "second")
+
+	if got := store.sets.Load(); got != 2 {
+		t.Errorf("expected 2 pushes after a debounced save, got %d", got)
+	}
+
+	// Rewriting the same content must not reach the server.
+	writeConfig(t, configPath, "second")
+	time.Sleep(4 * debounce)
+
+	if got := store.sets.Load(); got != 2 {
+		t.Errorf("expected an unchanged config to be skipped, got %d pushes", got)
+	}
+}
+
+func TestRunnerWatchMissingDirectory(t *testing.T) {
+	t.Parallel()
+
+	client := wsclient.NewClient("ws://127.0.0.1:1/ws", "test-client", "test-token")
+	runner := wsclient.NewRunner(client, "/nonexistent/dir/rlgl.yaml", time.Hour).
+		WithWatch(wsclient.DefaultWatchDebounce)
+
+	err := runner.Run(context.Background())
+	if err == nil {
+		t.Fatal("expected an error when the config directory cannot be watched")
+	}
+}
@@ -2,20 +2,26 @@ package wsclient
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/protocol"
 	"github.com/gorilla/websocket"
 )
 
 const (
 	handshakeTimeout = 10 * time.Second
 	httpTimeout      = 10 * time.Second
+	responseTimeout  = 10 * time.Second
+	closeTimeout     = 2 * time.Second
 )
 
 var (
@@ -23,20 +29,28 @@ var (
 	ErrServerError           = errors.New("server error")
 	ErrUnexpectedMessageType = errors.New("unexpected message type")
 	ErrUnexpectedStatusCode  = errors.New("unexpected status code")
+	ErrHandshakeRefused      = errors.New("server refused handshake")
+	ErrUnsupported           = errors.New("not supported by server")
 )
 
-type Message struct {
-	Type     string            `json:"type"`
-	ClientID string            `json:"clientId"`
-	Config   *embed.SiteConfig `json:"config,omitempty"`
-	Error    string            `json:"error,omitempty"`
-}
+// Message is a message on the /ws WebSocket.
+type Message = protocol.Message
 
 type Client struct {
 	serverURL string
 	clientID  string
 	authToken string
+	version   string
+	heartbeat time.Duration
+	tlsConfig *tls.Config
 	conn      *websocket.Conn
+	reader    *reader
+
+	handlersMu sync.Mutex
+	handlers   map[protocol.Command]CommandHandler
+
+	// capabilities are those the server agreed to in the handshake.
+	capabilities []protocol.Capability
 }
 
 func NewClient(serverURL, clientID, authToken string) *Client {
@@ -44,14 +58,37 @@ func NewClient(serverURL, clientID, authToken string) *Client {
 		serverURL: serverURL,
 		clientID:  clientID,
 		authToken: authToken,
+		handlers:  make(map[protocol.Command]CommandHandler),
 	}
 }
 
+// SetHeartbeat tells the server the longest the client will go between
+// messages, so it can tell when the client has gone quiet.
+func (c *Client) SetHeartbeat(heartbeat time.Duration) {
+	c.heartbeat = heartbeat
+}
+
+// SetVersion sets the rlgl version the client reports in the handshake.
+func (c *Client) SetVersion(version string) {
+	c.version = version
+}
+
+// SetTLSConfig sets the TLS config used to dial wss:// servers.
+func (c *Client) SetTLSConfig(config *tls.Config) {
+	c.tlsConfig = config
+}
+
 func (c *Client) Connect() error {
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext dials the server, giving up when ctx is done.
+func (c *Client) ConnectContext(ctx context.Context) error {
 	slog.Info("connecting to websocket server", "url", c.serverURL)
 
 	dialer := &websocket.Dialer{
 		HandshakeTimeout: handshakeTimeout,
+		TLSClientConfig:  c.tlsConfig,
 	}
 
 	headers := http.Header{}
@@ -59,7 +96,7 @@ func (c *Client) Connect() error {
 		headers.Add("Authorization", "Bearer "+c.authToken)
 	}
 
-	conn, resp, err := dialer.Dial(c.serverURL, headers)
+	conn, resp, err := dialer.DialContext(ctx, c.serverURL, headers)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
@@ -69,14 +106,96 @@ func (c *Client) Connect() error {
 	}
 
 	c.conn = conn
-	slog.Info("connected to server", "url", c.serverURL)
+
+	err = c.handshake()
+	if err != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+
+		return err
+	}
+
+	c.startReading()
+
+	slog.Info("connected to server", "url", c.serverURL, "capabilities", c.capabilities)
 
 	return nil
 }
 
+// handshake introduces the client and records what the server supports. A
+// server from before the handshake answers with an unknown type error; it
+// is still spoken to, but only with pushes and pings.
+func (c *Client) handshake() error {
+	hello := protocol.Hello(c.clientID, c.version)
+	hello.Interval = c.heartbeatSeconds()
+
+	err := c.conn.WriteJSON(hello)
+	if err != nil {
+		return fmt.Errorf("failed to send hello: %w", err)
+	}
+
+	response, err := c.readResponse()
+	if err != nil {
+		return fmt.Errorf("failed to read welcome: %w", err)
+	}
+
+	switch {
+	case response.Type == protocol.TypeError && response.Error == protocol.UnknownTypeError:
+		slog.Warn("server predates the protocol handshake, patches are unavailable")
+
+		c.capabilities = nil
+
+		return nil
+	case response.Type == protocol.TypeError:
+		return fmt.Errorf("%w: %s", ErrHandshakeRefused, response.Error)
+	case response.Type != protocol.TypeWelcome:
+		return fmt.Errorf("%w: %s", ErrUnexpectedMessageType, response.Type)
+	}
+
+	err = protocol.CheckWelcome(response)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrHandshakeRefused, err)
+	}
+
+	c.capabilities = response.Capabilities
+
+	return nil
+}
+
+// Supports reports whether the server agreed to capability in the handshake.
+func (c *Client) Supports(capability protocol.Capability) bool {
+	return slices.Contains(c.capabilities, capability)
+}
+
+// Close tells the server the client is going away, with a close frame, and
+// closes the connection.
 func (c *Client) Close() error {
+	return c.close(websocket.CloseNormalClosure)
+}
+
+// Leave closes the connection like Close, but tells the server the client is
+// stopping rather than about to reconnect, so the server drops what it has
+// synced to Slack for it.
+func (c *Client) Leave() error {
+	return c.close(websocket.CloseGoingAway)
+}
+
+func (c *Client) close(code int) error {
 	if c.conn != nil {
+		message := websocket.FormatCloseMessage(code, "")
+
+		// The connection may already be dead, in which case there is no one to tell.
+		_ = c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeTimeout))
+
 		err := c.conn.Close()
+
+		if c.reader != nil {
+			<-c.reader.done
+		}
+
+		c.conn = nil
+		c.reader = nil
+
 		if err != nil {
 			return fmt.Errorf("failed to close connection: %w", err)
 		}
@@ -86,35 +205,52 @@ func (c *Client) Close() error {
 }
 
 func (c *Client) PushConfig(config embed.SiteConfig) error {
-	if c.conn == nil {
-		return ErrNotConnected
+	return c.send(Message{
+		Type:     protocol.TypePush,
+		ClientID: c.clientID,
+		Config:   &config,
+		Interval: c.heartbeatSeconds(),
+	})
+}
+
+// PatchConfig changes part of the client's stored config with an RFC 7396
+// JSON merge patch, such as {"contributor":{"status":"red"}}.
+func (c *Client) PatchConfig(patch json.RawMessage) error {
+	if c.conn != nil && !c.Supports(protocol.CapabilityPatch) {
+		return fmt.Errorf("%w: %s", ErrUnsupported, protocol.CapabilityPatch)
 	}
 
-	msg := Message{
-		Type:     "push",
+	return c.send(Message{
+		Type:     protocol.TypePatch,
 		ClientID: c.clientID,
-		Config:   &config,
+		Patch:    patch,
+		Interval: c.heartbeatSeconds(),
+	})
+}
+
+// send writes a push or patch and waits for the server to acknowledge it.
+func (c *Client) send(msg Message) error {
+	if c.conn == nil {
+		return ErrNotConnected
 	}
 
 	err := c.conn.WriteJSON(msg)
 	if err != nil {
-		return fmt.Errorf("failed to send config: %w", err)
+		return fmt.Errorf("failed to send %s: %w", msg.Type, err)
 	}
 
-	slog.Info("sent config to server", "client_id", c.clientID)
+	slog.Info("sent "+string(msg.Type)+" to server", "client_id", c.clientID)
 
-	var response Message
-
-	err = c.conn.ReadJSON(&response)
+	response, err := c.readResponse()
 	if err != nil {
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if response.Type == "error" {
+	if response.Type == protocol.TypeError {
 		return fmt.Errorf("%w: %s", ErrServerError, response.Error)
 	}
 
-	if response.Type != "ack" {
+	if response.Type != protocol.TypeAck {
 		return fmt.Errorf("%w: %s", ErrUnexpectedMessageType, response.Type)
 	}
 
@@ -129,8 +265,9 @@ func (c *Client) Ping() error {
 	}
 
 	msg := Message{
-		Type:     "ping",
+		Type:     protocol.TypePing,
 		ClientID: c.clientID,
+		Interval: c.heartbeatSeconds(),
 	}
 
 	err := c.conn.WriteJSON(msg)
@@ -138,68 +275,38 @@ func (c *Client) Ping() error {
 		return fmt.Errorf("failed to send ping: %w", err)
 	}
 
-	var response Message
-
-	err = c.conn.ReadJSON(&response)
+	response, err := c.readResponse()
 	if err != nil {
 		return fmt.Errorf("failed to read pong: %w", err)
 	}
 
-	if response.Type != "pong" {
+	if response.Type != protocol.TypePong {
 		return fmt.Errorf("%w: %s", ErrUnexpectedMessageType, response.Type)
 	}
 
 	return nil
 }
 
-func Run(serverURL, configPath, clientID, authToken string, interval time.Duration) error {
-	client := NewClient(serverURL, clientID, authToken)
-
-	err := client.Connect()
-	if err != nil {
-		return err
-	}
-	defer client.Close()
-
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	pushConfig := func() error {
-		config, err := embed.LoadSiteConfig(configPath)
-		if err != nil {
-			return fmt.Errorf("failed to load config: %w", err)
-		}
-
-		pushErr := client.PushConfig(config)
-		if pushErr != nil {
-			return fmt.Errorf("failed to push config: %w", pushErr)
-		}
-
-		return nil
-	}
-
-	err = pushConfig()
-	if err != nil {
-		return err
-	}
-
-	slog.Info("client started", "interval", interval, "config", configPath)
-
-	for range ticker.C {
-		err := pushConfig()
-		if err != nil {
-			slog.Error("failed to push config", "error", err)
+// heartbeatSeconds rounds the heartbeat up to whole seconds.
+func (c *Client) heartbeatSeconds() int {
+	return int((c.heartbeat + time.Second - 1) / time.Second)
+}
 
-			continue
-		}
-	}
+// Run pushes the config every interval, reconnecting whenever the connection
+// to the server is lost. It only returns once ctx is done or the server
+// refuses the handshake.
+func Run(ctx context.Context, serverURL, configPath, clientID, authToken string, interval time.Duration) error {
+	client := NewClient(serverURL, clientID, authToken)
 
-	return nil
+	return NewRunner(client, configPath, interval).Run(ctx)
 }
 
 func RunOnce(serverURL, configPath, clientID, authToken string) error {
-	client := NewClient(serverURL, clientID, authToken)
+	return PushOnce(NewClient(serverURL, clientID, authToken), configPath)
+}
 
+// PushOnce connects client, pushes the config once and disconnects.
+func PushOnce(client *Client, configPath string) error {
 	err := client.Connect()
 	if err != nil {
 		return err
@@ -241,7 +348,7 @@ func GetStatusJSON(serverURL string) (string, error) {
 		return "", fmt.Errorf("%w: %d", ErrUnexpectedStatusCode, resp.StatusCode)
 	}
 
-	var result map[string]embed.SiteConfig
+	var result map[string]embed.PublicSiteConfig
 
 	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
 	if decodeErr != nil {
@@ -11,8 +11,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/benwsapp/rlgl/pkg/auth"
 	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/protocol"
 	"github.com/benwsapp/rlgl/pkg/wsclient"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
 	"github.com/gorilla/websocket"
 )
 
@@ -41,6 +44,32 @@ contributor:
 	return configPath
 }
 
+// answerHello plays the server's side of the handshake.
+func answerHello(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	var hello wsclient.Message
+
+	err := conn.ReadJSON(&hello)
+	if err != nil {
+		t.Error(err)
+
+		return
+	}
+
+	welcome, err := protocol.Welcome(hello)
+	if err != nil {
+		t.Error(err)
+
+		return
+	}
+
+	err = conn.WriteJSON(welcome)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 func TestNewClient(t *testing.T) {
 	t.Parallel()
 
@@ -66,6 +95,8 @@ func TestClientConnectAndClose(t *testing.T) {
 		}
 		defer conn.Close()
 
+		answerHello(t, conn)
+
 		time.Sleep(100 * time.Millisecond)
 	}))
 	defer server.Close()
@@ -85,6 +116,61 @@ func TestClientConnectAndClose(t *testing.T) {
 	}
 }
 
+func TestClientLeaveTellsServerItStopped(t *testing.T) {
+	t.Parallel()
+
+	codes := make(chan int, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(writer, req, nil)
+		if err != nil {
+			t.Error(err)
+
+			return
+		}
+		defer conn.Close()
+
+		answerHello(t, conn)
+
+		_, _, err = conn.ReadMessage()
+
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) {
+			codes <- closeErr.Code
+		} else {
+			codes <- 0
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for _, test := range []struct {
+		name  string
+		close func(client *wsclient.Client) error
+		want  int
+	}{
+		{"Close", (*wsclient.Client).Close, websocket.CloseNormalClosure},
+		{"Leave", (*wsclient.Client).Leave, websocket.CloseGoingAway},
+	} {
+		client := wsclient.NewClient(wsURL, "test-client", "test-token")
+
+		err := client.Connect()
+		if err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		err = test.close(client)
+		if err != nil {
+			t.Fatalf("%s failed: %v", test.name, err)
+		}
+
+		if code := <-codes; code != test.want {
+			t.Errorf("%s: expected close code %d, got %d", test.name, test.want, code)
+		}
+	}
+}
+
 func TestClientPushConfig(t *testing.T) {
 	t.Parallel()
 
@@ -101,6 +187,8 @@ func TestClientPushConfig(t *testing.T) {
 		}
 		defer conn.Close()
 
+		answerHello(t, conn)
+
 		var msg wsclient.Message
 
 		err = conn.ReadJSON(&msg)
@@ -177,6 +265,8 @@ func TestClientPing(t *testing.T) {
 		}
 		defer conn.Close()
 
+		answerHello(t, conn)
+
 		var msg wsclient.Message
 
 		err = conn.ReadJSON(&msg)
@@ -282,6 +372,8 @@ func TestRunOnce(t *testing.T) {
 		}
 		defer conn.Close()
 
+		answerHello(t, conn)
+
 		var msg wsclient.Message
 
 		err = conn.ReadJSON(&msg)
@@ -325,6 +417,8 @@ func TestRunOnceInvalidConfig(t *testing.T) {
 		}
 		defer conn.Close()
 
+		answerHello(t, conn)
+
 		time.Sleep(100 * time.Millisecond)
 	}))
 	defer server.Close()
@@ -364,6 +458,8 @@ func TestClientPushConfigServerError(t *testing.T) {
 		}
 		defer conn.Close()
 
+		answerHello(t, conn)
+
 		var msg wsclient.Message
 
 		err = conn.ReadJSON(&msg)
@@ -425,6 +521,8 @@ func TestClientPushConfigUnexpectedMessageType(t *testing.T) {
 		}
 		defer conn.Close()
 
+		answerHello(t, conn)
+
 		var msg wsclient.Message
 
 		err = conn.ReadJSON(&msg)
@@ -496,6 +594,8 @@ func TestClientPingUnexpectedResponse(t *testing.T) {
 		}
 		defer conn.Close()
 
+		answerHello(t, conn)
+
 		var msg wsclient.Message
 
 		err = conn.ReadJSON(&msg)
@@ -553,41 +653,173 @@ func TestGetStatusJSONHTTPError(t *testing.T) {
 	}
 }
 
-func TestRunConnectError(t *testing.T) {
+func TestClientPatchConfig(t *testing.T) {
 	t.Parallel()
 
-	configPath := createTestConfig(t)
+	store := wsserver.NewStore()
 
-	err := wsclient.Run("ws://localhost:9999/ws", configPath, "test-client", "test-token", 1*time.Second)
-	if err == nil {
-		t.Fatal("expected connection error")
+	server := httptest.NewServer(wsserver.Handler(store, "test-token"))
+	defer server.Close()
+
+	client := wsclient.NewClient("ws"+strings.TrimPrefix(server.URL, "http"), "test-client", "test-token")
+
+	err := client.Connect()
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	err = client.PushConfig(embed.SiteConfig{Name: "Test Site", Contributor: embed.Contributor{Status: embed.StatusGreen}})
+	if err != nil {
+		t.Fatalf("PushConfig failed: %v", err)
+	}
+
+	err = client.PatchConfig(json.RawMessage(`{"contributor":{"focus":"Deploying"}}`))
+	if err != nil {
+		t.Fatalf("PatchConfig failed: %v", err)
+	}
+
+	config, _ := store.Get("test-client")
+	if config.Name != "Test Site" || config.Contributor.Focus != "Deploying" {
+		t.Errorf("expected the patch to set only the focus, got %+v", config)
+	}
+
+	err = client.PatchConfig(json.RawMessage(`{"nmae":"typo"}`))
+	if !errors.Is(err, wsclient.ErrServerError) {
+		t.Errorf("expected a bad patch to be refused, got %v", err)
 	}
 }
 
-func TestRunInitialPushError(t *testing.T) {
-	t.Parallel()
+// replyToHello serves a WebSocket that answers the client's hello with reply
+// and then acknowledges whatever it is sent.
+func replyToHello(t *testing.T, reply wsclient.Message) string {
+	t.Helper()
 
 	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
-		upgrader := websocket.Upgrader{
-			CheckOrigin: func(_ *http.Request) bool {
-				return true
-			},
-		}
+		upgrader := websocket.Upgrader{}
 
 		conn, err := upgrader.Upgrade(writer, req, nil)
 		if err != nil {
-			t.Fatal(err)
+			t.Error(err)
+
+			return
 		}
 		defer conn.Close()
 
-		time.Sleep(100 * time.Millisecond)
+		for response := reply; ; response = (wsclient.Message{Type: protocol.TypeAck}) {
+			var msg wsclient.Message
+
+			if conn.ReadJSON(&msg) != nil || conn.WriteJSON(response) != nil {
+				return
+			}
+		}
 	}))
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestClientHandshake(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(wsserver.Handler(wsserver.NewStore(), "test-token"))
 	defer server.Close()
 
-	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := wsclient.NewClient("ws"+strings.TrimPrefix(server.URL, "http"), "test-client", "test-token")
+	client.SetVersion("v1.2.3")
 
-	err := wsclient.Run(wsURL, "/nonexistent/config.yaml", "test-client", "test-token", 1*time.Second)
-	if err == nil {
-		t.Fatal("expected error for invalid config")
+	err := client.Connect()
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	if !client.Supports(protocol.CapabilityPatch) {
+		t.Error("expected the server to agree to patches")
+	}
+}
+
+func TestClientHandshakeWithLegacyServer(t *testing.T) {
+	t.Parallel()
+
+	wsURL := replyToHello(t, wsclient.Message{Type: protocol.TypeError, Error: protocol.UnknownTypeError})
+
+	client := wsclient.NewClient(wsURL, "test-client", "test-token")
+
+	err := client.Connect()
+	if err != nil {
+		t.Fatalf("expected a server without the handshake to be accepted, got %v", err)
+	}
+	defer client.Close()
+
+	err = client.PushConfig(embed.SiteConfig{Name: "Test Site"})
+	if err != nil {
+		t.Errorf("expected pushes to work, got %v", err)
+	}
+
+	err = client.PatchConfig(json.RawMessage(`{"name":"Patched"}`))
+	if !errors.Is(err, wsclient.ErrUnsupported) {
+		t.Errorf("expected patches to be unavailable, got %v", err)
+	}
+}
+
+func TestClientHandshakeRefused(t *testing.T) {
+	t.Parallel()
+
+	wsURL := replyToHello(t, wsclient.Message{Type: protocol.TypeError, Error: "incompatible protocol version"})
+
+	err := wsclient.NewClient(wsURL, "test-client", "test-token").Connect()
+	if !errors.Is(err, wsclient.ErrHandshakeRefused) {
+		t.Errorf("expected ErrHandshakeRefused, got %v", err)
+	}
+
+	runner := wsclient.NewRunner(wsclient.NewClient(wsURL, "test-client", "test-token"), createTestConfig(t), time.Second)
+
+	err = runner.Run(t.Context())
+	if !errors.Is(err, wsclient.ErrHandshakeRefused) {
+		t.Errorf("expected the runner to give up on a refusing server, got %v", err)
+	}
+}
+
+func TestClientHandlesCommands(t *testing.T) {
+	t.Parallel()
+
+	registry := auth.NewRegistry()
+	_ = registry.Register("test-token", auth.AnyClientID)
+
+	conns := wsserver.NewConnections()
+
+	server := httptest.NewServer(conns.Handler(wsserver.NewStore(), wsserver.NewRuntime(), registry))
+	defer server.Close()
+
+	client := wsclient.NewClient("ws"+strings.TrimPrefix(server.URL, "http"), "test-client", "test-token")
+
+	nudges := make(chan wsclient.Message, 1)
+	client.HandleCommand(protocol.CommandNudge, func(msg wsclient.Message) { nudges <- msg })
+
+	err := client.Connect()
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	if delivered := conns.Send("test-client", protocol.CommandNudge, "standup in 5"); delivered != 1 {
+		t.Fatalf("expected the nudge to reach the client, got %d", delivered)
+	}
+
+	select {
+	case msg := <-nudges:
+		if msg.Text != "standup in 5" {
+			t.Errorf("expected the nudge text, got %q", msg.Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the nudge")
+	}
+
+	conns.Send("test-client", protocol.CommandShutdown, "")
+
+	err = client.Ping()
+	if err != nil {
+		t.Errorf("expected replies to still reach the client between commands, got %v", err)
 	}
 }
@@ -0,0 +1,181 @@
+package wsserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/benwsapp/rlgl/pkg/embed"
+)
+
+// ClientIDPathValue names the path wildcard holding the client ID.
+const ClientIDPathValue = "clientID"
+
+// maxStatusBodySize bounds a status API request body.
+const maxStatusBodySize = 1 << 20
+
+// APIError is the body of every error response from the status API.
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// StatusAPIHandler lets scripts and CI jobs set a client's status without
+// holding a WebSocket open. PUT and POST replace the client's config with the
+// body, PATCH applies the body to the stored config as a JSON merge patch and
+// DELETE takes the client off the board. Requests authenticate as on /ws, and
+// writes are stored exactly as pushes are, overrides included. The client ID
+// is the ClientIDPathValue path value.
+func StatusAPIHandler(store Store, runtime *Runtime, registry *auth.Registry) http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		clientID := req.PathValue(ClientIDPathValue)
+
+		cred, err := identify(req, registry)
+		if err == nil {
+			err = cred.authorize(clientID)
+		}
+
+		if err != nil {
+			rejectRequest(writer, req, clientID, err)
+
+			return
+		}
+
+		if req.Method == http.MethodDelete {
+			deleteStatus(writer, store, runtime, clientID)
+
+			return
+		}
+
+		writeStatus(writer, req, store, runtime, clientID)
+	}
+}
+
+// rejectRequest answers a request that failed authentication or may not
+// write clientID.
+func rejectRequest(writer http.ResponseWriter, req *http.Request, clientID string, err error) {
+	slog.Warn("status API request rejected", "error", err, "client_id", clientID, "remote_addr", req.RemoteAddr)
+
+	if errors.Is(err, ErrMissingToken) || errors.Is(err, auth.ErrInvalidToken) {
+		pushRejectsTotal.Inc(rejectBadToken)
+		writer.Header().Set("WWW-Authenticate", "Bearer")
+		writeAPIError(writer, http.StatusUnauthorized, err.Error())
+
+		return
+	}
+
+	pushRejectsTotal.Inc(rejectClientID)
+	writeAPIError(writer, http.StatusForbidden, err.Error())
+}
+
+// writeStatus stores the config in the request body, or the stored config
+// with the body merged into it for PATCH, in a single store update.
+func writeStatus(writer http.ResponseWriter, req *http.Request, store Store, runtime *Runtime, clientID string) {
+	body, err := io.ReadAll(http.MaxBytesReader(writer, req.Body, maxStatusBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeAPIError(writer, http.StatusRequestEntityTooLarge, "request body too large")
+		} else {
+			writeAPIError(writer, http.StatusBadRequest, "failed to read request body")
+		}
+
+		return
+	}
+
+	var (
+		exists   bool
+		patchErr error
+		validErr error
+	)
+
+	config, err := store.Update(clientID, func(stored embed.SiteConfig, ok bool) (embed.SiteConfig, error) {
+		exists = ok
+
+		// A full config is a merge patch onto an empty one.
+		if req.Method != http.MethodPatch {
+			stored = embed.SiteConfig{}
+		}
+
+		config, err := stored.MergePatch(body)
+		if err != nil {
+			patchErr = err
+
+			return config, err
+		}
+
+		validErr = config.Validate()
+		if validErr != nil {
+			return config, validErr
+		}
+
+		return runtime.Overrides.Apply(clientID, config), nil
+	})
+
+	switch {
+	case patchErr != nil:
+		pushRejectsTotal.Inc(rejectInvalidConfig)
+		writeAPIError(writer, http.StatusBadRequest, patchErr.Error())
+
+		return
+	case validErr != nil:
+		pushRejectsTotal.Inc(rejectInvalidConfig)
+		writeAPIError(writer, http.StatusUnprocessableEntity, "invalid config: "+validErr.Error())
+
+		return
+	case err != nil:
+		slog.Error("failed to store config", "error", err, "client_id", clientID)
+		pushRejectsTotal.Inc(rejectStoreFailure)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to store config")
+
+		return
+	}
+
+	pushesTotal.Inc(clientID)
+	runtime.Presence.Seen(clientID, 0)
+	runtime.Slack.Sync(clientID, config)
+
+	code := http.StatusOK
+	if !exists {
+		code = http.StatusCreated
+	}
+
+	writeAPIResponse(writer, code, PublicStatus(runtime, clientID, config))
+}
+
+func deleteStatus(writer http.ResponseWriter, store Store, runtime *Runtime, clientID string) {
+	deleted, err := store.Delete(clientID)
+	if err != nil {
+		slog.Error("failed to delete config", "error", err, "client_id", clientID)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to delete config")
+
+		return
+	}
+
+	if !deleted {
+		writeAPIError(writer, http.StatusNotFound, "client not found")
+
+		return
+	}
+
+	runtime.Slack.Forget(clientID)
+	runtime.Overrides.Forget(clientID)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func writeAPIError(writer http.ResponseWriter, code int, message string) {
+	writeAPIResponse(writer, code, APIError{Error: message})
+}
+
+func writeAPIResponse(writer http.ResponseWriter, code int, body any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(code)
+
+	err := json.NewEncoder(writer).Encode(body)
+	if err != nil {
+		slog.Error("failed to encode API response", "error", err)
+	}
+}
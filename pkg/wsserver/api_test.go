@@ -0,0 +1,154 @@
+package wsserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+func newStatusAPI(t *testing.T, store wsserver.Store) http.Handler {
+	t.Helper()
+
+	registry := auth.NewRegistry()
+
+	err := registry.Register("alice-token", "alice")
+	if err != nil {
+		t.Fatalf("failed to register token: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/clients/{clientID}/status", wsserver.StatusAPIHandler(store, wsserver.NewRuntime(), registry))
+
+	return mux
+}
+
+func callStatusAPI(t *testing.T, handler http.Handler, method, clientID, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/api/v1/clients/"+clientID+"/status", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestStatusAPIPutAndPatch(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	api := newStatusAPI(t, store)
+
+	body := `{"name":"Alice","contributor":{"status":"green","focus":"reviews"},"slack":{"user_token":"xoxp-secret"}}`
+
+	rec := callStatusAPI(t, api, http.MethodPut, "alice", "alice-token", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for a new client, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if strings.Contains(rec.Body.String(), "xoxp-secret") {
+		t.Error("expected the response to leave out Slack settings")
+	}
+
+	rec = callStatusAPI(t, api, http.MethodPatch, "alice", "alice-token", `{"contributor":{"status":"red"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a patch, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var status wsserver.ClientStatus
+
+	err := json.Unmarshal(rec.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if status.Name != "Alice" || status.Contributor.Status != embed.StatusRed || status.Contributor.Focus != "reviews" {
+		t.Errorf("expected the patch to change only the status, got %+v", status)
+	}
+
+	if status.Presence.State != wsserver.PresenceOnline {
+		t.Errorf("expected a REST push to count as being seen, got %s", status.Presence.State)
+	}
+
+	stored, _ := store.Get("alice")
+	if stored.Slack.UserToken != "xoxp-secret" {
+		t.Error("expected the patch to keep the stored Slack settings")
+	}
+
+	rec = callStatusAPI(t, api, http.MethodPost, "alice", "alice-token", `{"name":"Alice"}`)
+	if stored, _ = store.Get("alice"); rec.Code != http.StatusOK || stored.Contributor.Focus != "" {
+		t.Errorf("expected POST to replace the whole config, got %d and %+v", rec.Code, stored)
+	}
+}
+
+func TestStatusAPIErrors(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	api := newStatusAPI(t, store)
+
+	tests := []struct {
+		name     string
+		method   string
+		clientID string
+		token    string
+		body     string
+		code     int
+	}{
+		{"missing token", http.MethodPut, "alice", "", `{}`, http.StatusUnauthorized},
+		{"unknown token", http.MethodPut, "alice", "wrong", `{}`, http.StatusUnauthorized},
+		{"other client", http.MethodPut, "bob", "alice-token", `{}`, http.StatusForbidden},
+		{"malformed JSON", http.MethodPut, "alice", "alice-token", `{"name":`, http.StatusBadRequest},
+		{"unknown field", http.MethodPatch, "alice", "alice-token", `{"nmae":"typo"}`, http.StatusBadRequest},
+		{"unknown status", http.MethodPut, "alice", "alice-token", `{"contributor":{"status":"blue"}}`, http.StatusUnprocessableEntity},
+		{"delete missing", http.MethodDelete, "alice", "alice-token", ``, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		rec := callStatusAPI(t, api, test.method, test.clientID, test.token, test.body)
+		if rec.Code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, rec.Code)
+		}
+
+		var apiErr wsserver.APIError
+		if json.Unmarshal(rec.Body.Bytes(), &apiErr) != nil || apiErr.Error == "" {
+			t.Errorf("%s: expected a JSON error body, got %q", test.name, rec.Body.String())
+		}
+	}
+
+	if len(store.GetAll()) != 0 {
+		t.Errorf("expected nothing to be stored, got %v", store.GetAll())
+	}
+}
+
+func TestStatusAPIDelete(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", embed.SiteConfig{Name: "Alice"})
+
+	api := newStatusAPI(t, store)
+
+	rec := callStatusAPI(t, api, http.MethodDelete, "alice", "alice-token", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if _, ok := store.Get("alice"); ok {
+		t.Error("expected alice to be removed from the board")
+	}
+
+	rec = callStatusAPI(t, api, http.MethodDelete, "alice", "alice-token", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected deleting again to give 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package wsserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/benwsapp/rlgl/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// maxCommandBodySize bounds a command API request body.
+const maxCommandBodySize = 4 << 10
+
+var ErrCommandNotAllowed = errors.New("command may not be sent from the API")
+
+// CommandRequest is the body of the command API.
+type CommandRequest struct {
+	Command protocol.Command `json:"command"`
+	Text    string           `json:"text,omitempty"`
+}
+
+// CommandResponse says how many of the client's connections a command
+// reached.
+type CommandResponse struct {
+	Delivered int `json:"delivered"`
+}
+
+// Send sends a command to every connection speaking for clientID that takes
+// commands and returns how many it reached.
+func (c *Connections) Send(clientID string, command protocol.Command, text string) int {
+	delivered := 0
+
+	for _, conn := range c.open() {
+		if conn.speaksFor(clientID) && conn.command(clientID, command, text) {
+			delivered++
+		}
+	}
+
+	slog.Info("sent command", "command", command, "client_id", clientID, "delivered", delivered)
+
+	return delivered
+}
+
+// CloseRevoked tells every connection whose token registry no longer holds
+// that it has been rotated or revoked, then closes it. Such a connection
+// would otherwise only find out on its next push.
+func (c *Connections) CloseRevoked(registry *auth.Registry) int {
+	closed := 0
+
+	for _, conn := range c.open() {
+		if conn.cred.token == "" || registry.Known(conn.cred.token) {
+			continue
+		}
+
+		const reason = "token rotated or revoked"
+
+		conn.command("", protocol.CommandTokenRotated, reason)
+		conn.close(websocket.ClosePolicyViolation, reason)
+
+		closed++
+	}
+
+	if closed > 0 {
+		slog.Info("closed connections with revoked tokens", "connections", closed)
+	}
+
+	return closed
+}
+
+// CommandHandler sends a command from the dashboard to the connections of
+// the ClientIDPathValue client: a nudge, or a request to push again. It
+// answers 404 when none of them takes commands.
+func (c *Connections) CommandHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		clientID := req.PathValue(ClientIDPathValue)
+
+		var body CommandRequest
+
+		err := json.NewDecoder(http.MaxBytesReader(writer, req.Body, maxCommandBodySize)).Decode(&body)
+		if err != nil {
+			writeAPIError(writer, http.StatusBadRequest, "invalid command: "+err.Error())
+
+			return
+		}
+
+		if body.Command != protocol.CommandNudge && body.Command != protocol.CommandResync {
+			writeAPIError(writer, http.StatusBadRequest, fmt.Errorf("%w: %q", ErrCommandNotAllowed, body.Command).Error())
+
+			return
+		}
+
+		delivered := c.Send(clientID, body.Command, body.Text)
+		if delivered == 0 {
+			writeAPIError(writer, http.StatusNotFound, "client is not connected or does not take commands")
+
+			return
+		}
+
+		writeAPIResponse(writer, http.StatusAccepted, CommandResponse{Delivered: delivered})
+	}
+}
@@ -0,0 +1,170 @@
+package wsserver_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/benwsapp/rlgl/pkg/protocol"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+	"github.com/gorilla/websocket"
+)
+
+// newCommandServer serves /ws and the command API for alice and bob.
+func newCommandServer(t *testing.T) (*wsserver.Connections, *auth.Registry, *httptest.Server) {
+	t.Helper()
+
+	registry := auth.NewRegistry()
+
+	for _, clientID := range []string{"alice", "bob"} {
+		err := registry.Register(clientID+"-token", clientID)
+		if err != nil {
+			t.Fatalf("failed to register token: %v", err)
+		}
+	}
+
+	conns := wsserver.NewConnections()
+
+	mux := http.NewServeMux()
+	mux.Handle("/ws", conns.Handler(wsserver.NewStore(), wsserver.NewRuntime(), registry))
+	mux.Handle("POST /api/v1/clients/{clientID}/commands", conns.CommandHandler())
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return conns, registry, server
+}
+
+// dialWithHello connects as clientID and completes the handshake, so the
+// connection takes commands.
+func dialWithHello(t *testing.T, server *httptest.Server, clientID string) *websocket.Conn {
+	t.Helper()
+
+	conn := dialWebSocket(t, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws", clientID+"-token")
+	t.Cleanup(func() { _ = conn.Close() })
+
+	if welcome := sendMessage(t, conn, protocol.Hello(clientID, "v1.0.0")); welcome.Type != protocol.TypeWelcome {
+		t.Fatalf("expected a welcome, got %+v", welcome)
+	}
+
+	return conn
+}
+
+func readCommand(t *testing.T, conn *websocket.Conn) wsserver.Message {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg wsserver.Message
+
+	err := conn.ReadJSON(&msg)
+	if err != nil {
+		t.Fatalf("failed to read command: %v", err)
+	}
+
+	if msg.Type != protocol.TypeCommand {
+		t.Fatalf("expected a command, got %+v", msg)
+	}
+
+	return msg
+}
+
+func postCommand(server *httptest.Server, clientID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/clients/"+clientID+"/commands", strings.NewReader(body))
+
+	rec := httptest.NewRecorder()
+	server.Config.Handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestCommandHandlerNudgesClient(t *testing.T) {
+	t.Parallel()
+
+	_, _, server := newCommandServer(t)
+
+	alice := dialWithHello(t, server, "alice")
+
+	// A client from before commands never agreed to them.
+	legacy := dialWebSocket(t, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws", "alice-token")
+	defer legacy.Close()
+
+	if response := pushAs(t, legacy, "alice"); response.Type != protocol.TypeAck {
+		t.Fatalf("expected ack, got %+v", response)
+	}
+
+	rec := postCommand(server, "alice", `{"command":"nudge","text":"standup in 5"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var body wsserver.CommandResponse
+
+	err := json.Unmarshal(rec.Body.Bytes(), &body)
+	if err != nil || body.Delivered != 1 {
+		t.Errorf("expected the command to reach one connection, got %+v (%v)", body, err)
+	}
+
+	msg := readCommand(t, alice)
+	if msg.Command != protocol.CommandNudge || msg.Text != "standup in 5" || msg.ClientID != "alice" {
+		t.Errorf("expected alice to be nudged, got %+v", msg)
+	}
+}
+
+func TestCommandHandlerErrors(t *testing.T) {
+	t.Parallel()
+
+	_, _, server := newCommandServer(t)
+	dialWithHello(t, server, "alice")
+
+	tests := []struct {
+		name     string
+		clientID string
+		body     string
+		code     int
+	}{
+		{"malformed JSON", "alice", `{"command":`, http.StatusBadRequest},
+		{"server-only command", "alice", `{"command":"shutdown"}`, http.StatusBadRequest},
+		{"unknown command", "alice", `{"command":"selfdestruct"}`, http.StatusBadRequest},
+		{"not connected", "bob", `{"command":"nudge"}`, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		rec := postCommand(server, test.clientID, test.body)
+		if rec.Code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, rec.Code)
+		}
+	}
+}
+
+func TestCloseRevokedTellsClient(t *testing.T) {
+	t.Parallel()
+
+	conns, registry, server := newCommandServer(t)
+	registry.OnRevoke(func() { conns.CloseRevoked(registry) })
+
+	alice := dialWithHello(t, server, "alice")
+	bob := dialWithHello(t, server, "bob")
+
+	registry.Revoke("alice-token")
+
+	if msg := readCommand(t, alice); msg.Command != protocol.CommandTokenRotated {
+		t.Errorf("expected a token_rotated command, got %+v", msg)
+	}
+
+	_, _, err := alice.ReadMessage()
+
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Errorf("expected a policy violation close frame, got %v", err)
+	}
+
+	if response := pushAs(t, bob, "bob"); response.Type != protocol.TypeAck {
+		t.Errorf("expected bob's connection to stay open, got %+v", response)
+	}
+}
@@ -0,0 +1,31 @@
+package wsserver
+
+import "time"
+
+// SetClock replaces the tracker's clock.
+func (t *PresenceTracker) SetClock(now func() time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.now = now
+}
+
+// WithAPIURL points the syncer at a fake Slack API.
+func (s *SlackSyncer) WithAPIURL(url string) *SlackSyncer {
+	s.apiURL = url
+
+	return s
+}
+
+// SetClock replaces the syncer's clock.
+func (s *SlackSyncer) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = now
+}
+
+// Wait blocks until every queued sync has finished.
+func (s *SlackSyncer) Wait() {
+	s.idle.Wait()
+}
@@ -0,0 +1,544 @@
+package wsserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+)
+
+const (
+	snapshotFileName = "snapshot.json"
+	walFileName      = "wal.jsonl"
+	historyFileName  = "history.jsonl"
+	storeDirPerm     = 0o700
+	storeFilePerm    = 0o600
+	compactThreshold = 1000
+	maxWALLineSize   = 1 << 20
+
+	walOpSet    = "set"
+	walOpDelete = "delete"
+)
+
+var (
+	ErrStorePathRequired = errors.New("file store path is required")
+	ErrStoreClosed       = errors.New("store is closed")
+)
+
+type walRecord struct {
+	Op       string            `json:"op"`
+	ClientID string            `json:"clientId"`
+	Config   *embed.SiteConfig `json:"config,omitempty"`
+	Time     time.Time         `json:"time"`
+}
+
+// historyRecord is one line of the history file.
+type historyRecord struct {
+	ClientID string `json:"clientId"`
+
+	Transition
+}
+
+// FileStore is a durable Store. Every write is appended to a write-ahead log
+// before it is applied in memory, and the log is periodically folded into an
+// atomically replaced JSON snapshot. Status transitions are appended to a
+// separate history file, which compaction rewrites without expired entries.
+type FileStore struct {
+	memory *MemoryStore
+	dir    string
+
+	mu         sync.Mutex
+	wal        *os.File
+	walRecords int
+}
+
+// OpenFileStore loads the snapshot and history in dir, replays the
+// write-ahead log on top of them and compacts everything before returning.
+// Status transitions are kept for historyRetention.
+func OpenFileStore(dir string, historyRetention time.Duration) (*FileStore, error) {
+	if dir == "" {
+		return nil, ErrStorePathRequired
+	}
+
+	cleanDir := filepath.Clean(dir)
+
+	err := os.MkdirAll(cleanDir, storeDirPerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	store := &FileStore{
+		memory: NewStore().WithHistoryRetention(historyRetention),
+		dir:    cleanDir,
+	}
+
+	err = store.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.loadHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	replayed, err := store.replayWAL()
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("opened file store", "dir", cleanDir, "clients", len(store.memory.snapshot()), "replayed", replayed)
+
+	return store, nil
+}
+
+func (s *FileStore) Set(clientID string, config embed.SiteConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set(clientID, config)
+}
+
+func (s *FileStore) Update(clientID string, change UpdateFunc) (embed.SiteConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return embed.SiteConfig{}, ErrStoreClosed
+	}
+
+	stored, exists := s.memory.Get(clientID)
+
+	config, err := change(stored, exists)
+	if err != nil {
+		return embed.SiteConfig{}, err
+	}
+
+	err = s.set(clientID, config)
+	if err != nil {
+		return embed.SiteConfig{}, err
+	}
+
+	return config, nil
+}
+
+// set logs and applies a write. s.mu must be held.
+func (s *FileStore) set(clientID string, config embed.SiteConfig) error {
+	if s.wal == nil {
+		return ErrStoreClosed
+	}
+
+	// An identical config keeps its UpdatedAt, so there is nothing to log.
+	if s.memory.unchanged(clientID, config) {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	err := s.appendWAL(walRecord{Op: walOpSet, ClientID: clientID, Config: &config, Time: now})
+	if err != nil {
+		return err
+	}
+
+	// The write is durable and visible from here on, so a history record
+	// that fails to append is only logged rather than failing the write.
+	transition, recorded := s.memory.apply(Entry{ClientID: clientID, Config: config, UpdatedAt: now})
+	if recorded {
+		err = s.appendHistory(historyRecord{ClientID: clientID, Transition: transition})
+		if err != nil {
+			slog.Error("failed to record status history", "error", err, "client_id", clientID)
+		}
+	}
+
+	s.compactIfDue()
+
+	return nil
+}
+
+func (s *FileStore) Delete(clientID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return false, ErrStoreClosed
+	}
+
+	_, ok := s.memory.Get(clientID)
+	if !ok {
+		return false, nil
+	}
+
+	err := s.appendWAL(walRecord{Op: walOpDelete, ClientID: clientID, Time: time.Now().UTC()})
+	if err != nil {
+		return false, err
+	}
+
+	_, _ = s.memory.Delete(clientID)
+	s.compactIfDue()
+
+	return true, nil
+}
+
+func (s *FileStore) Get(clientID string) (embed.SiteConfig, bool) {
+	return s.memory.Get(clientID)
+}
+
+func (s *FileStore) GetAll() map[string]embed.SiteConfig {
+	return s.memory.GetAll()
+}
+
+func (s *FileStore) Entries() []Entry {
+	return s.memory.Entries()
+}
+
+func (s *FileStore) History(clientID string, since time.Time) []Transition {
+	return s.memory.History(clientID, since)
+}
+
+func (s *FileStore) Subscribe() *Subscription {
+	return s.memory.Subscribe()
+}
+
+func (s *FileStore) Seq() uint64 {
+	return s.memory.Seq()
+}
+
+// Close writes a final snapshot and closes the write-ahead log.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+
+	err := s.compact()
+	if err != nil {
+		return err
+	}
+
+	err = s.wal.Close()
+	s.wal = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to close write-ahead log: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) appendWAL(record walRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal log record: %w", err)
+	}
+
+	_, err = s.wal.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to append to write-ahead log: %w", err)
+	}
+
+	err = s.wal.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+
+	s.walRecords++
+
+	return nil
+}
+
+// appendHistory adds a transition to the history file. Unlike the
+// write-ahead log it is not synced: losing the last few transitions in a
+// crash is acceptable.
+func (s *FileStore) appendHistory(record historyRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %w", err)
+	}
+
+	// #nosec G304 - Path is built from the operator-supplied store directory
+	file, err := os.OpenFile(filepath.Join(s.dir, historyFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, storeFilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+
+	_, err = file.Write(append(line, '\n'))
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to append to history file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) loadHistory() error {
+	file, err := os.Open(filepath.Join(s.dir, historyFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxWALLineSize)
+
+	for scanner.Scan() {
+		var record historyRecord
+
+		// A torn final line only loses that transition.
+		if json.Unmarshal(scanner.Bytes(), &record) == nil {
+			s.memory.history.add(record.ClientID, record.Transition)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var entries map[string]Entry
+
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	}
+
+	for clientID, value := range entries {
+		value.ClientID = clientID
+		s.memory.put(value)
+	}
+
+	return nil
+}
+
+func (s *FileStore) replayWAL() (int, error) {
+	file, err := os.Open(filepath.Join(s.dir, walFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxWALLineSize)
+
+	replayed := 0
+
+	for scanner.Scan() {
+		if !s.replayRecord(scanner.Bytes()) {
+			break
+		}
+
+		replayed++
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return replayed, fmt.Errorf("failed to read write-ahead log: %w", err)
+	}
+
+	return replayed, nil
+}
+
+// replayRecord applies a single log line. A line that cannot be decoded can
+// only be the result of a torn final write, so replay stops there.
+func (s *FileStore) replayRecord(line []byte) bool {
+	var record walRecord
+
+	err := json.Unmarshal(line, &record)
+
+	switch {
+	case err == nil && record.Op == walOpSet && record.Config != nil:
+		s.memory.put(Entry{ClientID: record.ClientID, Config: *record.Config, UpdatedAt: record.Time})
+	case err == nil && record.Op == walOpDelete:
+		s.memory.remove(record.ClientID)
+	default:
+		slog.Warn("stopping write-ahead log replay at unreadable record", "error", err, "op", record.Op)
+
+		return false
+	}
+
+	return true
+}
+
+// compactIfDue compacts once the log has grown long enough. A failure is
+// only logged, as the write that triggered it is already in the log; the log
+// keeps growing until a later compaction succeeds.
+func (s *FileStore) compactIfDue() {
+	if s.walRecords < compactThreshold {
+		return
+	}
+
+	err := s.compact()
+	if err != nil {
+		slog.Error("failed to compact file store", "error", err, "dir", s.dir)
+	}
+}
+
+// compact writes the in-memory state to a new snapshot and truncates the log.
+// Replaying a log on top of a snapshot that already contains it is harmless,
+// so a crash between the two steps loses nothing.
+func (s *FileStore) compact() error {
+	err := s.writeSnapshot()
+	if err != nil {
+		return err
+	}
+
+	err = s.writeHistory()
+	if err != nil {
+		return err
+	}
+
+	// An open log is truncated in place rather than reopened, so a failure
+	// leaves the store writing to the log it already has. Its handle
+	// appends, so the next record lands at the start.
+	if s.wal != nil {
+		err = s.wal.Truncate(0)
+		if err != nil {
+			return fmt.Errorf("failed to truncate write-ahead log: %w", err)
+		}
+
+		s.walRecords = 0
+
+		return nil
+	}
+
+	// #nosec G304 - Path is built from the operator-supplied store directory
+	wal, err := os.OpenFile(
+		filepath.Join(s.dir, walFileName),
+		os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND,
+		storeFilePerm,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+
+	s.wal = wal
+	s.walRecords = 0
+
+	return nil
+}
+
+func (s *FileStore) writeSnapshot() error {
+	data, err := json.Marshal(s.memory.snapshot())
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+
+	err = writeFileAtomic(s.dir, snapshotFileName, data)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// writeHistory replaces the history file with the unexpired transitions.
+func (s *FileStore) writeHistory() error {
+	var data []byte
+
+	for clientID, transitions := range s.memory.history.snapshot() {
+		for _, transition := range transitions {
+			line, err := json.Marshal(historyRecord{ClientID: clientID, Transition: transition})
+			if err != nil {
+				return fmt.Errorf("failed to marshal history record: %w", err)
+			}
+
+			data = append(append(data, line...), '\n')
+		}
+	}
+
+	err := writeFileAtomic(s.dir, historyFileName, data)
+	if err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+
+	return nil
+}
+
+// writeFileAtomic replaces dir/name with data so that readers see either the
+// old or the new contents, even after a crash.
+func writeFileAtomic(dir, name string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	tmpName := tmp.Name()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(tmpName)
+
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	err = os.Rename(tmpName, filepath.Join(dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to replace %s: %w", name, err)
+	}
+
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	handle, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open store directory: %w", err)
+	}
+	defer handle.Close()
+
+	err = handle.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync store directory: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,338 @@
+package wsserver_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+func openFileStore(t *testing.T, dir string) *wsserver.FileStore {
+	t.Helper()
+
+	store, err := wsserver.OpenFileStore(dir, wsserver.DefaultHistoryRetention)
+	if err != nil {
+		t.Fatalf("failed to open file store: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+
+	return store
+}
+
+func TestFileStoreSurvivesReopen(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	store := openFileStore(t, dir)
+	setConfig(t, store, "client1", embed.SiteConfig{Name: "Site 1", User: "user1"})
+	setConfig(t, store, "client2", embed.SiteConfig{Name: "Site 2", User: "user2"})
+
+	err := store.Close()
+	if err != nil {
+		t.Fatalf("failed to close store: %v", err)
+	}
+
+	reopened := openFileStore(t, dir)
+
+	all := reopened.GetAll()
+	if len(all) != 2 {
+		t.Fatalf("expected 2 configs after reopen, got %d", len(all))
+	}
+
+	if all["client2"].Name != "Site 2" {
+		t.Errorf("expected client2 name 'Site 2', got %s", all["client2"].Name)
+	}
+}
+
+func TestFileStoreReplaysLogWithoutClose(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	store := openFileStore(t, dir)
+	setConfig(t, store, "client1", embed.SiteConfig{Name: "First"})
+	setConfig(t, store, "client1", embed.SiteConfig{Name: "Second"})
+
+	reopened := openFileStore(t, dir)
+
+	config, ok := reopened.Get("client1")
+	if !ok {
+		t.Fatal("expected replayed config for client1")
+	}
+
+	if config.Name != "Second" {
+		t.Errorf("expected latest write 'Second', got %s", config.Name)
+	}
+}
+
+func TestFileStoreIgnoresTornLogTail(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	wal := `{"op":"set","clientId":"client1","config":{"name":"Kept"},"time":"2025-01-01T00:00:00Z"}
+{"op":"set","clientId":"client1","config":{"na`
+
+	err := os.WriteFile(filepath.Join(dir, "wal.jsonl"), []byte(wal), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	store := openFileStore(t, dir)
+
+	config, ok := store.Get("client1")
+	if !ok {
+		t.Fatal("expected config recovered from log")
+	}
+
+	if config.Name != "Kept" {
+		t.Errorf("expected name 'Kept', got %s", config.Name)
+	}
+}
+
+func TestFileStoreSetAfterClose(t *testing.T) {
+	t.Parallel()
+
+	store := openFileStore(t, t.TempDir())
+
+	err := store.Close()
+	if err != nil {
+		t.Fatalf("failed to close store: %v", err)
+	}
+
+	err = store.Set("client1", embed.SiteConfig{Name: "Late"})
+	if !errors.Is(err, wsserver.ErrStoreClosed) {
+		t.Errorf("expected ErrStoreClosed, got %v", err)
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	t.Parallel()
+
+	memory, err := wsserver.OpenStore("memory", wsserver.DefaultHistoryRetention)
+	if err != nil {
+		t.Fatalf("failed to open memory store: %v", err)
+	}
+
+	if _, ok := memory.(*wsserver.MemoryStore); !ok {
+		t.Errorf("expected *MemoryStore, got %T", memory)
+	}
+
+	file, err := wsserver.OpenStore("file:"+t.TempDir(), wsserver.DefaultHistoryRetention)
+	if err != nil {
+		t.Fatalf("failed to open file store: %v", err)
+	}
+	defer file.Close()
+
+	if _, ok := file.(*wsserver.FileStore); !ok {
+		t.Errorf("expected *FileStore, got %T", file)
+	}
+
+	_, err = wsserver.OpenStore("redis://localhost", wsserver.DefaultHistoryRetention)
+	if !errors.Is(err, wsserver.ErrUnknownStore) {
+		t.Errorf("expected ErrUnknownStore, got %v", err)
+	}
+
+	_, err = wsserver.OpenStore("file:", wsserver.DefaultHistoryRetention)
+	if !errors.Is(err, wsserver.ErrStorePathRequired) {
+		t.Errorf("expected ErrStorePathRequired, got %v", err)
+	}
+}
+
+func TestStoreUpdateKeepsConcurrentChanges(t *testing.T) {
+	t.Parallel()
+
+	stores := map[string]wsserver.Store{
+		"memory": wsserver.NewStore(),
+		"file":   openFileStore(t, t.TempDir()),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			const writers = 20
+
+			var wg sync.WaitGroup
+
+			for i := range writers {
+				wg.Go(func() {
+					_, err := store.Update("ci", func(config embed.SiteConfig, _ bool) (embed.SiteConfig, error) {
+						config.Contributor.Queue = append(slices.Clone(config.Contributor.Queue), "job-"+strconv.Itoa(i))
+
+						return config, nil
+					})
+					if err != nil {
+						t.Errorf("Update failed: %v", err)
+					}
+				})
+			}
+
+			wg.Wait()
+
+			config, _ := store.Get("ci")
+			if len(config.Contributor.Queue) != writers {
+				t.Errorf("expected %d queued jobs, got %v", writers, config.Contributor.Queue)
+			}
+		})
+	}
+}
+
+func TestStoreUpdateErrorStoresNothing(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	errRefused := errors.New("refused")
+
+	_, err := store.Update("ci", func(config embed.SiteConfig, exists bool) (embed.SiteConfig, error) {
+		if exists {
+			t.Error("expected no stored config")
+		}
+
+		return config, errRefused
+	})
+	if !errors.Is(err, errRefused) {
+		t.Errorf("expected the change's error, got %v", err)
+	}
+
+	if _, ok := store.Get("ci"); ok {
+		t.Error("expected nothing to be stored")
+	}
+}
+
+func TestFileStoreKeepsHistoryAcrossReopen(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	store := openFileStore(t, dir)
+	setConfig(t, store, "client1", embed.SiteConfig{Contributor: embed.Contributor{Status: embed.StatusRed}})
+	setConfig(t, store, "client1", embed.SiteConfig{Contributor: embed.Contributor{Status: embed.StatusGreen}})
+
+	// Reopen without closing, as after a crash, and again after a clean close.
+	for range 2 {
+		reopened := openFileStore(t, dir)
+
+		history := reopened.History("client1", time.Time{})
+		if len(history) != 2 || history[1].PreviousStatus != embed.StatusRed {
+			t.Fatalf("expected 2 transitions after reopen, got %+v", history)
+		}
+
+		err := reopened.Close()
+		if err != nil {
+			t.Fatalf("failed to close store: %v", err)
+		}
+	}
+}
+
+func TestFileStoreSetSucceedsWhenHistoryFails(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := openFileStore(t, dir)
+
+	// A directory in place of the history file makes every append fail.
+	history := filepath.Join(dir, "history.jsonl")
+
+	err := errors.Join(os.Remove(history), os.Mkdir(history, 0o700))
+	if err != nil {
+		t.Fatalf("failed to replace history file: %v", err)
+	}
+
+	err = store.Set("client1", embed.SiteConfig{Contributor: embed.Contributor{Status: embed.StatusRed}})
+	if err != nil {
+		t.Fatalf("expected a logged write to succeed without history, got %v", err)
+	}
+
+	if config, ok := store.Get("client1"); !ok || config.Contributor.Status != embed.StatusRed {
+		t.Errorf("expected the write to be stored, got %+v", config)
+	}
+}
+
+func TestFileStoreStaysWritableWhenCompactionFails(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := openFileStore(t, dir)
+
+	// A directory in place of the history file makes compaction fail.
+	history := filepath.Join(dir, "history.jsonl")
+
+	err := errors.Join(os.Remove(history), os.Mkdir(history, 0o700))
+	if err != nil {
+		t.Fatalf("failed to replace history file: %v", err)
+	}
+
+	set := func(focus string) {
+		t.Helper()
+
+		err := store.Set("client1", embed.SiteConfig{Contributor: embed.Contributor{Focus: focus}})
+		if err != nil {
+			t.Fatalf("expected writes to keep succeeding, got %v", err)
+		}
+	}
+
+	// Enough writes to trigger a compaction, and some after it.
+	for i := range 1010 {
+		set("task " + strconv.Itoa(i))
+	}
+
+	err = os.Remove(history)
+	if err != nil {
+		t.Fatalf("failed to remove history directory: %v", err)
+	}
+
+	// The next write compacts again, this time truncating the log in place.
+	set("last")
+
+	info, err := os.Stat(filepath.Join(dir, "wal.jsonl"))
+	if err != nil || info.Size() != 0 {
+		t.Errorf("expected a compacted log, got %v, %v", info, err)
+	}
+
+	if config, _ := openFileStore(t, dir).Get("client1"); config.Contributor.Focus != "last" {
+		t.Errorf("expected the last write to survive reopening, got %+v", config.Contributor)
+	}
+}
+
+func TestFileStoreDeleteSurvivesReopen(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	store := openFileStore(t, dir)
+	setConfig(t, store, "client1", embed.SiteConfig{Name: "First"})
+	setConfig(t, store, "client2", embed.SiteConfig{Name: "Second"})
+
+	deleted, err := store.Delete("client1")
+	if err != nil || !deleted {
+		t.Fatalf("expected client1 to be deleted, got %v, %v", deleted, err)
+	}
+
+	deleted, err = store.Delete("client1")
+	if err != nil || deleted {
+		t.Errorf("expected deleting a missing client to report false, got %v, %v", deleted, err)
+	}
+
+	// Reopen without closing, so the delete is replayed from the log.
+	reopened := openFileStore(t, dir)
+
+	if _, ok := reopened.Get("client1"); ok {
+		t.Error("expected client1 to stay deleted after replay")
+	}
+
+	if _, ok := reopened.Get("client2"); !ok {
+		t.Error("expected client2 to survive")
+	}
+}
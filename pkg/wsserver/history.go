@@ -0,0 +1,174 @@
+package wsserver
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+)
+
+// DefaultHistoryRetention is how long transitions are kept unless configured.
+const DefaultHistoryRetention = 7 * 24 * time.Hour
+
+// Transition is one recorded change to a client's light, focus or queue.
+// Previous values are only set for the parts that changed; Initial marks a
+// client's first push, which has nothing to compare against.
+type Transition struct {
+	Time           time.Time    `json:"time"`
+	Initial        bool         `json:"initial,omitempty"`
+	Status         embed.Status `json:"status"`
+	PreviousStatus embed.Status `json:"previousStatus,omitempty"`
+	Focus          string       `json:"focus"`
+	PreviousFocus  *string      `json:"previousFocus,omitempty"`
+	QueueAdded     []string     `json:"queueAdded,omitempty"`
+	QueueRemoved   []string     `json:"queueRemoved,omitempty"`
+}
+
+// History keeps each client's transitions for a retention period. A
+// retention of zero or less turns recording off.
+type History struct {
+	mu          sync.Mutex
+	retention   time.Duration
+	transitions map[string][]Transition
+}
+
+func NewHistory(retention time.Duration) *History {
+	return &History{
+		retention:   retention,
+		transitions: make(map[string][]Transition),
+	}
+}
+
+// Record adds the transition from previous to config, if the light, focus or
+// queue changed. A nil previous is the client's first push.
+func (h *History) Record(clientID string, previous *embed.SiteConfig, config embed.SiteConfig, at time.Time) (Transition, bool) {
+	if !h.enabled() {
+		return Transition{}, false
+	}
+
+	transition, changed := diff(previous, config.Contributor, at)
+	if !changed {
+		return Transition{}, false
+	}
+
+	h.add(clientID, transition)
+
+	return transition, true
+}
+
+// SetRetention changes how long transitions are kept.
+func (h *History) SetRetention(retention time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.retention = retention
+}
+
+// Since returns the transitions for clientID at or after since, oldest first.
+func (h *History) Since(clientID string, since time.Time) []Transition {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	transitions := h.transitions[clientID]
+
+	start, _ := slices.BinarySearchFunc(transitions, since, func(transition Transition, since time.Time) int {
+		return transition.Time.Compare(since)
+	})
+
+	return slices.Clone(transitions[start:])
+}
+
+func (h *History) enabled() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.retention > 0
+}
+
+// add appends a transition and drops the client's expired ones.
+func (h *History) add(clientID string, transition Transition) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.transitions[clientID] = append(h.transitions[clientID], transition)
+	h.pruneClient(clientID, time.Now())
+}
+
+// snapshot returns every client's unexpired transitions.
+func (h *History) snapshot() map[string][]Transition {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+
+	for clientID := range h.transitions {
+		h.pruneClient(clientID, now)
+	}
+
+	result := make(map[string][]Transition, len(h.transitions))
+	for clientID, transitions := range h.transitions {
+		result[clientID] = slices.Clone(transitions)
+	}
+
+	return result
+}
+
+func (h *History) pruneClient(clientID string, now time.Time) {
+	cutoff := now.Add(-h.retention)
+	transitions := h.transitions[clientID]
+
+	expired := 0
+	for expired < len(transitions) && transitions[expired].Time.Before(cutoff) {
+		expired++
+	}
+
+	switch {
+	case expired == len(transitions):
+		delete(h.transitions, clientID)
+	case expired > 0:
+		h.transitions[clientID] = slices.Clone(transitions[expired:])
+	}
+}
+
+func diff(previous *embed.SiteConfig, next embed.Contributor, at time.Time) (Transition, bool) {
+	transition := Transition{Time: at, Status: next.State(), Focus: next.Focus}
+
+	if previous == nil {
+		transition.Initial = true
+		transition.QueueAdded = slices.Clone(next.Queue)
+
+		return transition, true
+	}
+
+	before := previous.Contributor
+
+	if before.State() != transition.Status {
+		transition.PreviousStatus = before.State()
+	}
+
+	if before.Focus != next.Focus {
+		transition.PreviousFocus = &before.Focus
+	}
+
+	transition.QueueAdded = missingFrom(next.Queue, before.Queue)
+	transition.QueueRemoved = missingFrom(before.Queue, next.Queue)
+
+	changed := transition.PreviousStatus != "" || transition.PreviousFocus != nil ||
+		len(transition.QueueAdded) > 0 || len(transition.QueueRemoved) > 0
+
+	return transition, changed
+}
+
+// missingFrom returns the items of items that are not in other.
+func missingFrom(items, other []string) []string {
+	var missing []string
+
+	for _, item := range items {
+		if !slices.Contains(other, item) {
+			missing = append(missing, item)
+		}
+	}
+
+	return missing
+}
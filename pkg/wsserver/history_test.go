@@ -0,0 +1,76 @@
+package wsserver_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+func contributorConfig(status embed.Status, focus string, queue ...string) embed.SiteConfig {
+	return embed.SiteConfig{Name: "Site", Contributor: embed.Contributor{Status: status, Focus: focus, Queue: queue}}
+}
+
+func TestStoreRecordsTransitions(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", contributorConfig(embed.StatusRed, "Reviews", "a", "b"))
+	setConfig(t, store, "alice", contributorConfig(embed.StatusGreen, "Reviews", "a", "b"))
+	setConfig(t, store, "alice", contributorConfig(embed.StatusGreen, "Deploys", "b", "c"))
+
+	// Changes outside the light, focus and queue are not transitions.
+	renamed := contributorConfig(embed.StatusGreen, "Deploys", "b", "c")
+	renamed.Name = "Renamed"
+	setConfig(t, store, "alice", renamed)
+
+	history := store.History("alice", time.Time{})
+	if len(history) != 3 {
+		t.Fatalf("expected 3 transitions, got %d: %+v", len(history), history)
+	}
+
+	if !history[0].Initial || !slices.Equal(history[0].QueueAdded, []string{"a", "b"}) {
+		t.Errorf("unexpected first transition: %+v", history[0])
+	}
+
+	if history[1].PreviousStatus != embed.StatusRed || history[1].Status != embed.StatusGreen || history[1].PreviousFocus != nil {
+		t.Errorf("unexpected status transition: %+v", history[1])
+	}
+
+	third := history[2]
+	if third.PreviousStatus != "" || third.PreviousFocus == nil || *third.PreviousFocus != "Reviews" || third.Focus != "Deploys" {
+		t.Errorf("unexpected focus transition: %+v", third)
+	}
+
+	if !slices.Equal(third.QueueAdded, []string{"c"}) || !slices.Equal(third.QueueRemoved, []string{"a"}) {
+		t.Errorf("unexpected queue diff: %+v", third)
+	}
+
+	if got := store.History("alice", third.Time); len(got) != 1 {
+		t.Errorf("expected since to filter older transitions, got %d", len(got))
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	t.Parallel()
+
+	history := wsserver.NewHistory(time.Hour)
+	config := contributorConfig(embed.StatusGreen, "")
+
+	history.Record("alice", nil, config, time.Now().Add(-2*time.Hour))
+	history.Record("alice", &config, contributorConfig(embed.StatusRed, ""), time.Now())
+
+	transitions := history.Since("alice", time.Time{})
+	if len(transitions) != 1 || transitions[0].Status != embed.StatusRed {
+		t.Errorf("expected only the recent transition to be kept, got %+v", transitions)
+	}
+
+	disabled := wsserver.NewStore().WithHistoryRetention(0)
+	setConfig(t, disabled, "alice", config)
+
+	if got := disabled.History("alice", time.Time{}); len(got) != 0 {
+		t.Errorf("expected no history with zero retention, got %+v", got)
+	}
+}
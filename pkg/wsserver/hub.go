@@ -0,0 +1,78 @@
+package wsserver
+
+import (
+	"sync"
+	"time"
+)
+
+// Hub fans store change notifications out to subscribers. Each change gets a
+// new sequence number; subscribers only ever see the latest one, so a slow
+// reader is never blocked on and never falls behind by more than one change.
+type Hub struct {
+	mu          sync.Mutex
+	seq         uint64
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription delivers the sequence number of the latest change on C.
+type Subscription struct {
+	C <-chan uint64
+
+	ch  chan uint64
+	hub *Hub
+}
+
+// NewHub returns a hub whose sequence starts at the current time, so event
+// IDs keep increasing across server restarts.
+func NewHub() *Hub {
+	return &Hub{
+		seq:         uint64(time.Now().UnixNano()), // #nosec G115 - wall clock is positive
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+func (h *Hub) Subscribe() *Subscription {
+	ch := make(chan uint64, 1)
+	sub := &Subscription{C: ch, ch: ch, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.subscribers[sub] = struct{}{}
+
+	return sub
+}
+
+// Publish records a change and notifies every subscriber without blocking.
+func (h *Hub) Publish() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+
+	for sub := range h.subscribers {
+		select {
+		case <-sub.ch:
+		default:
+		}
+
+		sub.ch <- h.seq
+	}
+
+	return h.seq
+}
+
+// Seq returns the sequence number of the latest change.
+func (h *Hub) Seq() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.seq
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	delete(s.hub.subscribers, s)
+}
@@ -0,0 +1,86 @@
+package wsserver_test
+
+import (
+	"testing"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+func TestHubPublishCoalesces(t *testing.T) {
+	t.Parallel()
+
+	hub := wsserver.NewHub()
+
+	sub := hub.Subscribe()
+	defer sub.Close()
+
+	hub.Publish()
+	hub.Publish()
+	latest := hub.Publish()
+
+	if got := <-sub.C; got != latest {
+		t.Errorf("expected latest seq %d, got %d", latest, got)
+	}
+
+	select {
+	case seq := <-sub.C:
+		t.Errorf("expected a single pending notification, got another: %d", seq)
+	default:
+	}
+}
+
+func TestHubClosedSubscriptionIsNotNotified(t *testing.T) {
+	t.Parallel()
+
+	hub := wsserver.NewHub()
+
+	sub := hub.Subscribe()
+	sub.Close()
+
+	hub.Publish()
+
+	select {
+	case <-sub.C:
+		t.Error("expected no notification after Close")
+	default:
+	}
+}
+
+func TestStoreSetPublishesOnlyChanges(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+
+	sub := store.Subscribe()
+	defer sub.Close()
+
+	config := embed.SiteConfig{Name: "Site", Contributor: embed.Contributor{Focus: "one"}}
+	setConfig(t, store, "client1", config)
+
+	first := <-sub.C
+	if first != store.Seq() {
+		t.Errorf("expected notification for seq %d, got %d", store.Seq(), first)
+	}
+
+	before := store.Entries()[0].UpdatedAt
+
+	setConfig(t, store, "client1", config)
+
+	select {
+	case seq := <-sub.C:
+		t.Errorf("expected no notification for identical config, got %d", seq)
+	default:
+	}
+
+	if after := store.Entries()[0].UpdatedAt; !after.Equal(before) {
+		t.Errorf("expected UpdatedAt to stay %v for identical config, got %v", before, after)
+	}
+
+	config.Contributor.Focus = "two"
+	setConfig(t, store, "client1", config)
+
+	if second := <-sub.C; second <= first {
+		t.Errorf("expected increasing seq, got %d after %d", second, first)
+	}
+}
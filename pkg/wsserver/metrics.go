@@ -0,0 +1,63 @@
+package wsserver
+
+import (
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/metrics"
+)
+
+// Reasons a push or connection is rejected, as counted by
+// rlgl_push_rejects_total.
+const (
+	rejectBadToken      = "bad_token"
+	rejectClientID      = "client_id_not_allowed"
+	rejectUnknownType   = "unknown_type"
+	rejectInvalidConfig = "invalid_config"
+	rejectStoreFailure  = "store_failure"
+	rejectIncompatible  = "incompatible_protocol"
+)
+
+const clientIDLabel = "client_id"
+
+var (
+	websocketConnections = metrics.NewGaugeVec("rlgl_websocket_connections", "Open WebSocket connections.")
+	pushesTotal          = metrics.NewCounterVec("rlgl_pushes_total", "Configs stored from client pushes.", clientIDLabel)
+	pushRejectsTotal     = metrics.NewCounterVec("rlgl_push_rejects_total", "Pushes and connections rejected, by reason.", "reason")
+	slackSyncsTotal      = metrics.NewCounterVec("rlgl_slack_syncs_total", "Slack status updates, by result.", "result")
+	slackSyncSeconds     = metrics.NewHistogram(
+		"rlgl_slack_sync_duration_seconds",
+		"How long Slack status updates took.",
+		metrics.DefaultBuckets,
+	)
+)
+
+// LastUpdateCollector reports how long ago each client in store was last
+// heard from. A stored config only changes when the client's status does, so
+// a client pushing the same config is timed from its last push or heartbeat,
+// which runtime's presence tracker has, where that is later.
+func LastUpdateCollector(store Store, runtime *Runtime) *metrics.GaugeFunc {
+	const (
+		name = "rlgl_client_seconds_since_update"
+		help = "Seconds since each client last pushed or sent a heartbeat."
+	)
+
+	return metrics.NewGaugeFunc(name, help, []string{clientIDLabel}, func() []metrics.Sample {
+		entries := store.Entries()
+		now := time.Now()
+
+		samples := make([]metrics.Sample, 0, len(entries))
+		for _, entry := range entries {
+			updated := entry.UpdatedAt
+			if seen, ok := runtime.Presence.LastSeen(entry.ClientID); ok && seen.After(updated) {
+				updated = seen
+			}
+
+			samples = append(samples, metrics.Sample{
+				LabelValues: []string{entry.ClientID},
+				Value:       now.Sub(updated).Seconds(),
+			})
+		}
+
+		return samples
+	})
+}
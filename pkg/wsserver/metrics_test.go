@@ -0,0 +1,70 @@
+package wsserver_test
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+// agedStore reports every entry as last changed an hour ago.
+type agedStore struct {
+	wsserver.Store
+}
+
+func (s agedStore) Entries() []wsserver.Entry {
+	entries := s.Store.Entries()
+	for i := range entries {
+		entries[i].UpdatedAt = time.Now().Add(-time.Hour)
+	}
+
+	return entries
+}
+
+func TestLastUpdateCollectorCountsUnchangedPushes(t *testing.T) {
+	t.Parallel()
+
+	store := wsserver.NewStore()
+	setConfig(t, store, "alice", slackConfig("reviews"))
+
+	runtime := wsserver.NewRuntime()
+	collector := wsserver.LastUpdateCollector(agedStore{store}, runtime)
+
+	age := func() float64 {
+		t.Helper()
+
+		var buf bytes.Buffer
+		collector.Write(&buf)
+
+		for line := range strings.Lines(buf.String()) {
+			value, ok := strings.CutPrefix(strings.TrimSpace(line), `rlgl_client_seconds_since_update{client_id="alice"} `)
+			if !ok {
+				continue
+			}
+
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %v", line, err)
+			}
+
+			return seconds
+		}
+
+		t.Fatalf("expected a sample for alice, got %s", buf.String())
+
+		return 0
+	}
+
+	if got := age(); got < 3500 {
+		t.Errorf("expected a client not heard from to age with its config, got %v", got)
+	}
+
+	runtime.Presence.Seen("alice", 0)
+
+	if got := age(); got > 60 {
+		t.Errorf("expected a push of the same config to count as an update, got %v", got)
+	}
+}
@@ -0,0 +1,99 @@
+package wsserver
+
+import (
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+)
+
+// override is a change made to a client's config from outside the client,
+// the config the client had written when it was made, and when it stops
+// applying. base is nil when the client has not written since the server
+// started; the client's next write then becomes it.
+type override struct {
+	change func(config *embed.SiteConfig)
+	base   *embed.SiteConfig
+	until  time.Time
+}
+
+// Overrides holds changes made to client configs from outside the clients,
+// such as a Slack command, that the clients' own writes must not undo. They
+// are replayed, in the order they were made, on top of every config a client
+// pushes, patches or sends to the status API, for as long as the client keeps
+// writing the config it had when the change was made. A client that writes
+// something else, such as an edited config file, has changed its mind since,
+// so its config wins; so does every config once the change expires. As a
+// patched config already carries them, changes must give the same result
+// when replayed.
+type Overrides struct {
+	mu      sync.Mutex
+	clients map[string][]override
+	written map[string]embed.SiteConfig
+}
+
+func NewOverrides() *Overrides {
+	return &Overrides{clients: make(map[string][]override), written: make(map[string]embed.SiteConfig)}
+}
+
+// Add keeps change applied to clientID's config for ttl, or until the client
+// writes a config other than its last one.
+func (o *Overrides) Add(clientID string, change func(config *embed.SiteConfig), ttl time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	override := override{change: change, until: time.Now().Add(ttl)}
+
+	if written, ok := o.written[clientID]; ok {
+		override.base = &written
+	}
+
+	o.clients[clientID] = append(o.clients[clientID], override)
+}
+
+// Forget drops clientID's overrides, for a client taken off the board.
+func (o *Overrides) Forget(clientID string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.clients, clientID)
+	delete(o.written, clientID)
+}
+
+// Apply returns config, as written by clientID, with the client's overrides
+// that still hold replayed on it, forgetting the rest.
+func (o *Overrides) Apply(clientID string, config embed.SiteConfig) embed.SiteConfig {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.written[clientID] = config
+	now := time.Now()
+
+	active := slices.DeleteFunc(o.clients[clientID], func(override override) bool {
+		return !now.Before(override.until) || override.base != nil && !reflect.DeepEqual(*override.base, config)
+	})
+	if len(active) == 0 {
+		delete(o.clients, clientID)
+
+		return config
+	}
+
+	o.clients[clientID] = active
+	written := config
+
+	// Changes such as adding to the queue must not write into the caller's
+	// slices.
+	config.Contributor.Queue = slices.Clone(config.Contributor.Queue)
+
+	for i := range active {
+		if active[i].base == nil {
+			active[i].base = &written
+		}
+
+		active[i].change(&config)
+	}
+
+	return config
+}
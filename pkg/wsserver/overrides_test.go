@@ -0,0 +1,83 @@
+package wsserver_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+func TestOverridesReplayUntilExpiry(t *testing.T) {
+	t.Parallel()
+
+	overrides := wsserver.NewOverrides()
+
+	overrides.Add("alice", func(config *embed.SiteConfig) {
+		config.Contributor = config.Contributor.WithStatus(embed.StatusRed)
+	}, time.Hour)
+	overrides.Add("alice", func(config *embed.SiteConfig) {
+		config.Contributor.Queue = append(config.Contributor.Queue, "postmortem")
+	}, time.Hour)
+	overrides.Add("alice", func(config *embed.SiteConfig) {
+		config.Contributor.Focus = "expired"
+	}, -time.Second)
+
+	queue := make([]string, 1, 2)
+	queue[0] = "deploy"
+	pushed := embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Status: embed.StatusGreen, Queue: queue}}
+
+	config := overrides.Apply("alice", pushed)
+	if config.Contributor.State() != embed.StatusRed || config.Contributor.Focus != "" {
+		t.Errorf("expected only the unexpired overrides to apply, got %+v", config.Contributor)
+	}
+
+	if want := []string{"deploy", "postmortem"}; !slices.Equal(config.Contributor.Queue, want) {
+		t.Errorf("expected queue %v, got %v", want, config.Contributor.Queue)
+	}
+
+	if slices.Contains(queue[:cap(queue)], "postmortem") {
+		t.Error("expected the pushed queue to be left alone")
+	}
+
+	if config = overrides.Apply("bob", pushed); config.Contributor.State() != embed.StatusGreen {
+		t.Errorf("expected another client's push to be left alone, got %+v", config.Contributor)
+	}
+
+	overrides.Forget("alice")
+
+	if config = overrides.Apply("alice", pushed); config.Contributor.State() != embed.StatusGreen {
+		t.Errorf("expected forgotten overrides not to apply, got %+v", config.Contributor)
+	}
+}
+
+func TestOverridesGiveWayToChangedConfig(t *testing.T) {
+	t.Parallel()
+
+	overrides := wsserver.NewOverrides()
+
+	pushed := embed.SiteConfig{User: "alice", Contributor: embed.Contributor{Status: embed.StatusGreen, Queue: []string{"deploy"}}}
+	overrides.Apply("alice", pushed)
+
+	overrides.Add("alice", func(config *embed.SiteConfig) {
+		config.Contributor.Queue = nil
+	}, time.Hour)
+
+	for range 2 {
+		if config := overrides.Apply("alice", pushed); len(config.Contributor.Queue) != 0 {
+			t.Fatalf("expected the same push to keep the queue cleared, got %v", config.Contributor.Queue)
+		}
+	}
+
+	edited := pushed
+	edited.Contributor.Queue = []string{"deploy", "postmortem"}
+
+	if config := overrides.Apply("alice", edited); len(config.Contributor.Queue) != 2 {
+		t.Errorf("expected an edited config to win, got %v", config.Contributor.Queue)
+	}
+
+	if config := overrides.Apply("alice", pushed); len(config.Contributor.Queue) != 1 {
+		t.Errorf("expected the override to be gone once it gave way, got %v", config.Contributor.Queue)
+	}
+}
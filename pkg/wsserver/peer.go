@@ -0,0 +1,139 @@
+package wsserver
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// writeTimeout bounds a write to a client, so a stalled client cannot hold
+// up whoever is sending to it.
+const writeTimeout = 10 * time.Second
+
+// peerConn is a client's WebSocket connection. Replies are written by the
+// connection's own goroutine and commands by whoever sends them, so writes
+// are serialized.
+type peerConn struct {
+	conn *websocket.Conn
+	cred credential
+
+	writeMu sync.Mutex
+
+	mu           sync.Mutex
+	clientIDs    map[string]bool
+	capabilities []protocol.Capability
+}
+
+func newPeerConn(conn *websocket.Conn, cred credential) *peerConn {
+	return &peerConn{conn: conn, cred: cred, clientIDs: make(map[string]bool)}
+}
+
+func (p *peerConn) WriteJSON(v any) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	return p.writeJSON(v)
+}
+
+func (p *peerConn) writeJSON(v any) error {
+	_ = p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	return p.conn.WriteJSON(v) //nolint:wrapcheck
+}
+
+// welcome records the capabilities agreed to in the handshake and sends the
+// welcome. Both happen under the write lock, so no command can reach the
+// client ahead of its welcome, and none is missed once it has it.
+func (p *peerConn) welcome(welcome protocol.Message) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	p.setCapabilities(welcome.Capabilities)
+
+	return p.writeJSON(welcome)
+}
+
+// addClientID records that the connection speaks for clientID and reports
+// whether it had not before.
+func (p *peerConn) addClientID(clientID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.clientIDs[clientID] {
+		return false
+	}
+
+	p.clientIDs[clientID] = true
+
+	return true
+}
+
+func (p *peerConn) speaksFor(clientID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.clientIDs[clientID]
+}
+
+func (p *peerConn) clientIDList() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	clientIDs := make([]string, 0, len(p.clientIDs))
+	for clientID := range p.clientIDs {
+		clientIDs = append(clientIDs, clientID)
+	}
+
+	return clientIDs
+}
+
+// setCapabilities records what the client agreed to in the handshake.
+func (p *peerConn) setCapabilities(capabilities []protocol.Capability) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.capabilities = capabilities
+}
+
+func (p *peerConn) supports(capability protocol.Capability) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Contains(p.capabilities, capability)
+}
+
+// command sends a command, if the client agreed to receive them, and reports
+// whether it was sent.
+func (p *peerConn) command(clientID string, command protocol.Command, text string) bool {
+	if !p.supports(protocol.CapabilityCommands) {
+		return false
+	}
+
+	err := p.WriteJSON(protocol.NewCommand(clientID, command, text))
+	if err != nil {
+		slog.Debug("failed to send command", "error", err, "command", command, "client_id", clientID)
+
+		return false
+	}
+
+	return true
+}
+
+// close sends a close frame and gives the client closeTimeout to answer
+// before the connection's read loop gives up.
+func (p *peerConn) close(code int, reason string) {
+	deadline := time.Now().Add(closeTimeout)
+
+	err := p.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+	if err != nil {
+		slog.Debug("failed to send close frame", "error", err)
+	}
+
+	// Unlike the websocket.Conn, the net.Conn is safe to use from here while
+	// the handler is reading.
+	_ = p.conn.UnderlyingConn().SetReadDeadline(deadline)
+}
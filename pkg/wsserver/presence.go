@@ -0,0 +1,231 @@
+package wsserver
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// PresenceState says whether a client is still checking in.
+type PresenceState string
+
+const (
+	// PresenceOnline means the client was heard from recently.
+	PresenceOnline PresenceState = "online"
+	// PresenceStale means the client's connection is still open but it has
+	// gone quiet, as a sleeping laptop does.
+	PresenceStale PresenceState = "stale"
+	// PresenceOffline means the client has disconnected and gone quiet.
+	PresenceOffline PresenceState = "offline"
+)
+
+const (
+	// DefaultStaleFactor is how many heartbeats a client may miss before it
+	// stops counting as online.
+	DefaultStaleFactor = 3
+	// DefaultHeartbeat is assumed for clients that do not report one, such
+	// as one-off pushes.
+	DefaultHeartbeat = 30 * time.Second
+	// DefaultPresenceCheck is how often presence is re-evaluated for clients
+	// that have simply gone quiet.
+	DefaultPresenceCheck = 5 * time.Second
+)
+
+// Presence is a client's connection state as shown to viewers. LastSeen is
+// only set once the client is no longer online, so that routine pings do not
+// change what viewers are sent. Grey asks viewers to grey out the light.
+type Presence struct {
+	State    PresenceState `json:"state"`
+	LastSeen time.Time     `json:"lastSeen,omitzero"`
+	Grey     bool          `json:"grey,omitempty"`
+}
+
+// PresencePolicy decides when a client stops counting as online.
+type PresencePolicy struct {
+	// StaleFactor is how many of its heartbeats a client may miss.
+	StaleFactor int
+	// GreyStale greys out the light of clients that are not online.
+	GreyStale bool
+}
+
+func DefaultPresencePolicy() PresencePolicy {
+	return PresencePolicy{StaleFactor: DefaultStaleFactor}
+}
+
+type clientPresence struct {
+	lastSeen    time.Time
+	heartbeat   time.Duration
+	connections int
+}
+
+// PresenceTracker follows each client ID through the /ws handler: which
+// connections it has open and when it last sent a message. Changes of state
+// are announced on hub, so event streams pick them up.
+type PresenceTracker struct {
+	mu       sync.Mutex
+	policy   PresencePolicy
+	clients  map[string]*clientPresence
+	reported map[string]PresenceState
+	hub      *Hub
+	now      func() time.Time
+}
+
+func NewPresenceTracker(hub *Hub) *PresenceTracker {
+	return &PresenceTracker{
+		policy:   DefaultPresencePolicy(),
+		clients:  make(map[string]*clientPresence),
+		reported: make(map[string]PresenceState),
+		hub:      hub,
+		now:      time.Now,
+	}
+}
+
+// SetPolicy changes when clients stop counting as online.
+func (t *PresenceTracker) SetPolicy(policy PresencePolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if policy.StaleFactor <= 0 {
+		policy.StaleFactor = DefaultStaleFactor
+	}
+
+	t.policy = policy
+}
+
+// Connected records that a connection has started speaking for clientID.
+func (t *PresenceTracker) Connected(clientID string) {
+	t.update(clientID, func(client *clientPresence) {
+		client.connections++
+	})
+}
+
+// Disconnected records that one of clientID's connections has closed.
+func (t *PresenceTracker) Disconnected(clientID string) {
+	t.update(clientID, func(client *clientPresence) {
+		client.connections = max(client.connections-1, 0)
+	})
+}
+
+// Seen records a message from clientID, which promises to send another
+// within heartbeat. Zero means the client did not say.
+func (t *PresenceTracker) Seen(clientID string, heartbeat time.Duration) {
+	t.update(clientID, func(client *clientPresence) {
+		client.lastSeen = t.now()
+		if heartbeat > 0 {
+			client.heartbeat = heartbeat
+		}
+	})
+}
+
+// LastSeen returns when clientID last sent a message, and false if it has
+// not been heard from since the server started.
+func (t *PresenceTracker) LastSeen(clientID string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	client, ok := t.clients[clientID]
+	if !ok || client.lastSeen.IsZero() {
+		return time.Time{}, false
+	}
+
+	return client.lastSeen, true
+}
+
+// Get returns clientID's presence. A client that has never been heard from
+// since the server started is offline.
+func (t *PresenceTracker) Get(clientID string) Presence {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.presence(clientID, t.now())
+}
+
+// Refresh re-evaluates every client and announces any that have changed
+// state just by going quiet.
+func (t *PresenceTracker) Refresh() {
+	t.mu.Lock()
+
+	changed := false
+	now := t.now()
+
+	for clientID := range t.clients {
+		changed = t.record(clientID, now) || changed
+	}
+
+	t.mu.Unlock()
+
+	if changed {
+		t.hub.Publish()
+	}
+}
+
+// Watch calls Refresh every interval until ctx is done.
+func (t *PresenceTracker) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.Refresh()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *PresenceTracker) update(clientID string, change func(client *clientPresence)) {
+	t.mu.Lock()
+
+	client, ok := t.clients[clientID]
+	if !ok {
+		client = &clientPresence{}
+		t.clients[clientID] = client
+	}
+
+	change(client)
+	changed := t.record(clientID, t.now())
+
+	t.mu.Unlock()
+
+	if changed {
+		t.hub.Publish()
+	}
+}
+
+// record stores clientID's current state and reports whether it changed.
+func (t *PresenceTracker) record(clientID string, now time.Time) bool {
+	state := t.presence(clientID, now).State
+	if t.reported[clientID] == state {
+		return false
+	}
+
+	slog.Info("client presence changed", "client_id", clientID, "from", t.reported[clientID], "to", state)
+	t.reported[clientID] = state
+
+	return true
+}
+
+func (t *PresenceTracker) presence(clientID string, now time.Time) Presence {
+	client, ok := t.clients[clientID]
+	if !ok {
+		return Presence{State: PresenceOffline, Grey: t.policy.GreyStale}
+	}
+
+	heartbeat := client.heartbeat
+	if heartbeat == 0 {
+		heartbeat = DefaultHeartbeat
+	}
+
+	if !client.lastSeen.IsZero() && now.Sub(client.lastSeen) <= time.Duration(t.policy.StaleFactor)*heartbeat {
+		return Presence{State: PresenceOnline}
+	}
+
+	state := PresenceOffline
+	if client.connections > 0 {
+		state = PresenceStale
+	}
+
+	return Presence{State: state, LastSeen: client.lastSeen, Grey: t.policy.GreyStale}
+}
@@ -0,0 +1,76 @@
+package wsserver_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+)
+
+func TestPresenceGoesStaleThenOffline(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	tracker := wsserver.NewPresenceTracker(wsserver.NewHub())
+	tracker.SetClock(func() time.Time { return now })
+
+	if got := tracker.Get("alice"); got.State != wsserver.PresenceOffline {
+		t.Errorf("expected an unseen client to be offline, got %+v", got)
+	}
+
+	tracker.Connected("alice")
+	tracker.Seen("alice", 10*time.Second)
+	seen := now
+
+	now = now.Add(30 * time.Second)
+	if got := tracker.Get("alice"); got.State != wsserver.PresenceOnline || !got.LastSeen.IsZero() {
+		t.Errorf("expected alice to be online within three heartbeats, got %+v", got)
+	}
+
+	now = now.Add(time.Second)
+	if got := tracker.Get("alice"); got.State != wsserver.PresenceStale || !got.LastSeen.Equal(seen) {
+		t.Errorf("expected a quiet open connection to be stale, got %+v", got)
+	}
+
+	tracker.Disconnected("alice")
+	if got := tracker.Get("alice"); got.State != wsserver.PresenceOffline || got.Grey {
+		t.Errorf("expected alice to be offline after disconnecting, got %+v", got)
+	}
+
+	tracker.SetPolicy(wsserver.PresencePolicy{StaleFactor: 5, GreyStale: true})
+	if got := tracker.Get("alice"); got.State != wsserver.PresenceOnline {
+		t.Errorf("expected a larger stale factor to bring alice back online, got %+v", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := tracker.Get("alice"); !got.Grey {
+		t.Errorf("expected an offline client to be greyed out, got %+v", got)
+	}
+}
+
+func TestPresencePublishesChanges(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	hub := wsserver.NewHub()
+	tracker := wsserver.NewPresenceTracker(hub)
+	tracker.SetClock(func() time.Time { return now })
+
+	tracker.Connected("alice")
+	tracker.Seen("alice", 0)
+	seq := hub.Seq()
+
+	tracker.Seen("alice", 0)
+	tracker.Refresh()
+
+	if hub.Seq() != seq {
+		t.Errorf("expected routine pings not to publish, seq went from %d to %d", seq, hub.Seq())
+	}
+
+	now = now.Add(wsserver.DefaultStaleFactor*wsserver.DefaultHeartbeat + time.Second)
+	tracker.Refresh()
+
+	if hub.Seq() != seq+1 {
+		t.Errorf("expected going stale to publish once, seq went from %d to %d", seq, hub.Seq())
+	}
+}
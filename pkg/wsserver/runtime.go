@@ -0,0 +1,35 @@
+package wsserver
+
+// Runtime is what the server follows about clients beside their stored
+// configs: whether each is still checking in, what has been synced to Slack
+// for it, and which changes made from outside it must outlast its pushes.
+// None of it is persisted, so it is kept out of the Store and wired up by
+// whoever runs the server. Presence changes are announced on its own hub.
+type Runtime struct {
+	Presence  *PresenceTracker
+	Slack     *SlackSyncer
+	Overrides *Overrides
+
+	hub *Hub
+}
+
+func NewRuntime() *Runtime {
+	// Counted from zero rather than the clock, so event IDs, which add this
+	// to the store's sequence, stay the store's own until something changes.
+	hub := &Hub{subscribers: make(map[*Subscription]struct{})}
+
+	return &Runtime{
+		Presence:  NewPresenceTracker(hub),
+		Slack:     NewSlackSyncer(),
+		Overrides: NewOverrides(),
+		hub:       hub,
+	}
+}
+
+func (r *Runtime) Subscribe() *Subscription {
+	return r.hub.Subscribe()
+}
+
+func (r *Runtime) Seq() uint64 {
+	return r.hub.Seq()
+}
@@ -0,0 +1,175 @@
+package wsserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/benwsapp/rlgl/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// ShutdownTimeout bounds how long a shutdown waits for requests and
+	// connections to finish.
+	ShutdownTimeout = 10 * time.Second
+
+	// closeTimeout is how long a client has to answer the close frame sent
+	// on shutdown before its connection is dropped.
+	closeTimeout = 2 * time.Second
+)
+
+var ErrShutdownTimeout = errors.New("timed out waiting for websocket connections to close")
+
+// Connections keeps track of open WebSocket connections, so commands can be
+// sent to them and shutdown can wait for them. http.Server.Shutdown neither
+// closes nor waits for them, since they are hijacked from the server.
+type Connections struct {
+	wg sync.WaitGroup
+
+	mu    sync.Mutex
+	peers map[*peerConn]struct{}
+}
+
+func NewConnections() *Connections {
+	return &Connections{peers: make(map[*peerConn]struct{})}
+}
+
+// Handler is HandlerWithRegistry with every connection tracked. When the
+// request context is cancelled, as it is on shutdown, the client is sent a
+// close frame.
+func (c *Connections) Handler(store Store, runtime *Runtime, registry *auth.Registry) http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		// Counted before the upgrade, while Shutdown still waits for this
+		// request, so Wait cannot miss it.
+		c.wg.Add(1)
+		defer c.wg.Done()
+
+		cred, ok := authenticate(writer, req, registry)
+		if !ok {
+			return
+		}
+
+		wsConn, err := upgrader.Upgrade(writer, req, nil)
+		if err != nil {
+			slog.Error("failed to upgrade connection", "error", err)
+
+			return
+		}
+		defer wsConn.Close()
+
+		websocketConnections.Inc()
+		defer websocketConnections.Dec()
+
+		conn := newPeerConn(wsConn, cred)
+
+		c.add(conn)
+		defer c.remove(conn)
+
+		done := make(chan struct{})
+		defer close(done)
+
+		go closeOnShutdown(req.Context(), conn, done)
+
+		slog.Info("websocket connection established", "remote_addr", req.RemoteAddr)
+
+		handleConnection(conn, store, runtime)
+	}
+}
+
+func (c *Connections) add(conn *peerConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.peers[conn] = struct{}{}
+}
+
+func (c *Connections) remove(conn *peerConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.peers, conn)
+}
+
+// open returns every open connection.
+func (c *Connections) open() []*peerConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return slices.Collect(maps.Keys(c.peers))
+}
+
+// Wait blocks until every connection has closed or ctx is done.
+func (c *Connections) Wait(ctx context.Context) error {
+	closed := make(chan struct{})
+
+	go func() {
+		c.wg.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return ErrShutdownTimeout
+	}
+}
+
+// closeOnShutdown warns the client once ctx is done, with a shutdown command
+// if it takes commands and a going-away close frame.
+func closeOnShutdown(ctx context.Context, conn *peerConn, done <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+	case <-done:
+		return
+	}
+
+	const reason = "server shutting down"
+
+	conn.command("", protocol.CommandShutdown, reason)
+	conn.close(websocket.CloseGoingAway, reason)
+}
+
+// ListenAndServe runs server until ctx is done, then shuts it down: it stops
+// accepting connections, ends event streams and WebSockets (whose request
+// contexts derive from ctx) and waits up to ShutdownTimeout for them.
+func ListenAndServe(ctx context.Context, server *http.Server, conns *Connections) error {
+	server.BaseContext = func(net.Listener) context.Context { return ctx }
+
+	failed := make(chan error, 1)
+
+	go func() {
+		if server.TLSConfig != nil {
+			failed <- server.ListenAndServeTLS("", "")
+		} else {
+			failed <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down server")
+
+	drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ShutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(drainCtx)
+	if err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+
+	return conns.Wait(drainCtx)
+}
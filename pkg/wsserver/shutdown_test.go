@@ -0,0 +1,82 @@
+package wsserver_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/benwsapp/rlgl/pkg/protocol"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+	"github.com/gorilla/websocket"
+)
+
+func TestConnectionsCloseOnShutdown(t *testing.T) {
+	t.Parallel()
+
+	registry := auth.NewRegistry()
+	_ = registry.Register("test-token", auth.AnyClientID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conns := wsserver.NewConnections()
+	server := httptest.NewUnstartedServer(conns.Handler(wsserver.NewStore(), wsserver.NewRuntime(), registry))
+	server.Config.BaseContext = func(net.Listener) context.Context { return ctx }
+	server.Start()
+	t.Cleanup(server.Close)
+
+	conn := dialWebSocket(t, "ws"+strings.TrimPrefix(server.URL, "http"), "test-token")
+	defer conn.Close()
+
+	if welcome := sendMessage(t, conn, protocol.Hello("test", "v1.0.0")); welcome.Type != protocol.TypeWelcome {
+		t.Fatalf("expected a welcome, got %+v", welcome)
+	}
+
+	cancel()
+
+	if msg := readCommand(t, conn); msg.Command != protocol.CommandShutdown {
+		t.Errorf("expected a shutdown command ahead of the close frame, got %+v", msg)
+	}
+
+	_, _, err := conn.ReadMessage()
+
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Fatalf("expected a going-away close frame, got %v", err)
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+
+	err = conns.Wait(waitCtx)
+	if err != nil {
+		t.Errorf("expected every connection to be closed, got %v", err)
+	}
+}
+
+func TestConnectionsWaitTimesOut(t *testing.T) {
+	t.Parallel()
+
+	registry := auth.NewRegistry()
+	_ = registry.Register("test-token", auth.AnyClientID)
+
+	conns := wsserver.NewConnections()
+	server := httptest.NewServer(conns.Handler(wsserver.NewStore(), wsserver.NewRuntime(), registry))
+	t.Cleanup(server.Close)
+
+	conn := dialWebSocket(t, "ws"+strings.TrimPrefix(server.URL, "http"), "test-token")
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := conns.Wait(ctx)
+	if !errors.Is(err, wsserver.ErrShutdownTimeout) {
+		t.Errorf("expected ErrShutdownTimeout with a connection still open, got %v", err)
+	}
+}
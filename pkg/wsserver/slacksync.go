@@ -0,0 +1,413 @@
+package wsserver
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/schedule"
+	"github.com/benwsapp/rlgl/pkg/slack"
+)
+
+const (
+	// defaultSlackTTL is how long a Slack status lasts when the config sets
+	// no ttl_seconds.
+	defaultSlackTTL = time.Hour
+
+	// slackRefreshMargin is how long before a synced status expires that the
+	// next push sets it again, even though nothing changed. Statuses with a
+	// short TTL are refreshed once half of it is left instead.
+	slackRefreshMargin = 5 * time.Minute
+
+	// defaultSlackWorkers bounds how many Slack requests run at once.
+	defaultSlackWorkers = 4
+)
+
+// slackDND is what a sync does with the user's Do Not Disturb.
+type slackDND string
+
+const (
+	dndKeep   slackDND = ""
+	dndSnooze slackDND = "snooze"
+	dndEnd    slackDND = "end"
+)
+
+// slackStatus is what a client's Slack status is set to. An empty presence
+// leaves the user's presence alone.
+type slackStatus struct {
+	token       string
+	state       embed.Status
+	text        string
+	emoji       string
+	presence    slack.Presence
+	dnd         slackDND
+	snoozeUntil time.Time
+}
+
+// slackSync is a status that was set, and when Slack will clear it.
+type slackSync struct {
+	status    slackStatus
+	expiresAt time.Time
+	ttl       time.Duration
+}
+
+// fresh reports whether the synced status is still status and is not about
+// to expire at now.
+func (s slackSync) fresh(status slackStatus, now time.Time) bool {
+	margin := min(slackRefreshMargin, s.ttl/2)
+
+	return s.status == status && now.Before(s.expiresAt.Add(-margin))
+}
+
+// SlackProblem is why Slack sync is off for a client. Sync stays off until
+// the client pushes a different token.
+type SlackProblem struct {
+	Error string    `json:"error"`
+	Since time.Time `json:"since"`
+}
+
+// slackDisabled is a client whose token Slack refused for good.
+type slackDisabled struct {
+	token   string
+	problem SlackProblem
+}
+
+// SlackSyncer mirrors client statuses to Slack. It remembers the last status
+// it set for each client and only calls Slack again when the text, emoji or
+// state differs or the status is close to expiring, so clients pushing the
+// same config every interval do not run into Slack's rate limits. When the
+// config asks for it, presence and Do Not Disturb are set along with the
+// status.
+//
+// Syncs run on at most a fixed number of workers. A client with a sync
+// already waiting has it replaced by the newer config, and syncs for one
+// client never run at the same time, so the last push wins.
+//
+// A token Slack reports as revoked or invalid turns sync off for that client
+// instead of being retried on every push; Problem says why. A token Slack
+// rate limits is not synced again until its Retry-After has passed.
+type SlackSyncer struct {
+	apiURL  string
+	workers int
+	now     func() time.Time
+
+	mu       sync.Mutex
+	synced   map[string]slackSync
+	disabled map[string]slackDisabled
+	limited  map[string]time.Time
+	pending  map[string]embed.SiteConfig
+	queue    []string
+	inFlight map[string]bool
+	running  int
+	idle     sync.WaitGroup
+}
+
+func NewSlackSyncer() *SlackSyncer {
+	return &SlackSyncer{
+		workers:  defaultSlackWorkers,
+		now:      time.Now,
+		synced:   make(map[string]slackSync),
+		disabled: make(map[string]slackDisabled),
+		limited:  make(map[string]time.Time),
+		pending:  make(map[string]embed.SiteConfig),
+		inFlight: make(map[string]bool),
+	}
+}
+
+// WithWorkers sets how many Slack requests may run at once.
+func (s *SlackSyncer) WithWorkers(workers int) *SlackSyncer {
+	s.workers = max(workers, 1)
+
+	return s
+}
+
+// Sync sets clientID's Slack status from config in the background, unless
+// Slack already has it. Configs without Slack enabled are ignored.
+func (s *SlackSyncer) Sync(clientID string, config embed.SiteConfig) {
+	if !config.Slack.Enabled || config.Slack.UserToken == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.skip(clientID, config) {
+		return
+	}
+
+	_, queued := s.pending[clientID]
+	s.pending[clientID] = config
+
+	if queued {
+		return
+	}
+
+	s.queue = append(s.queue, clientID)
+
+	if s.running < s.workers {
+		s.running++
+		s.idle.Add(1)
+
+		go s.work()
+	}
+}
+
+// skip reports whether config needs no sync: Slack already has its status,
+// sync is off for its token, or Slack asked for the token to wait. s.mu must
+// be held.
+func (s *SlackSyncer) skip(clientID string, config embed.SiteConfig) bool {
+	if disabled, ok := s.disabled[clientID]; ok {
+		if disabled.token == config.Slack.UserToken {
+			slackSyncsTotal.Inc("disabled")
+
+			return true
+		}
+
+		slog.Info("re-enabled Slack sync for a new token", "client_id", clientID)
+		delete(s.disabled, clientID)
+	}
+
+	now := s.now()
+
+	if notBefore, ok := s.limited[config.Slack.UserToken]; ok {
+		if now.Before(notBefore) {
+			slackSyncsTotal.Inc("rate_limited")
+
+			return true
+		}
+
+		delete(s.limited, config.Slack.UserToken)
+	}
+
+	if last, ok := s.synced[clientID]; ok && last.fresh(desiredSlackStatus(config, now), now) {
+		slackSyncsTotal.Inc("skipped")
+
+		return true
+	}
+
+	return false
+}
+
+// Problem returns why Slack sync is off for clientID, or nil if it is not.
+func (s *SlackSyncer) Problem(clientID string) *SlackProblem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	disabled, ok := s.disabled[clientID]
+	if !ok {
+		return nil
+	}
+
+	return &disabled.problem
+}
+
+// Forget drops what is known about clientID's Slack status, so its next
+// push is synced whatever it says.
+func (s *SlackSyncer) Forget(clientID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.synced, clientID)
+}
+
+// work syncs queued clients until there are none left it may take.
+func (s *SlackSyncer) work() {
+	defer s.idle.Done()
+
+	for {
+		clientID, config, ok := s.next()
+		if !ok {
+			return
+		}
+
+		s.sync(clientID, config)
+	}
+}
+
+// next takes the first queued client that is not already being synced. When
+// there is none the worker stops; a client skipped because it is in flight
+// is picked up by the worker syncing it once that finishes.
+func (s *SlackSyncer) next() (string, embed.SiteConfig, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		index := slices.IndexFunc(s.queue, func(clientID string) bool { return !s.inFlight[clientID] })
+		if index < 0 {
+			s.running--
+
+			return "", embed.SiteConfig{}, false
+		}
+
+		clientID := s.queue[index]
+		s.queue = slices.Delete(s.queue, index, index+1)
+
+		config := s.pending[clientID]
+		delete(s.pending, clientID)
+
+		// The sync in flight when this was queued may have settled it.
+		if s.skip(clientID, config) {
+			continue
+		}
+
+		s.inFlight[clientID] = true
+
+		return clientID, config, true
+	}
+}
+
+func (s *SlackSyncer) sync(clientID string, config embed.SiteConfig) {
+	ttl := time.Duration(config.Slack.TTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultSlackTTL
+	}
+
+	s.mu.Lock()
+	now := s.now()
+	s.mu.Unlock()
+
+	status := desiredSlackStatus(config, now)
+	expiresAt := now.Add(ttl)
+
+	client := slack.NewClient(status.token)
+	if s.apiURL != "" {
+		client = client.WithBaseURL(s.apiURL)
+	}
+
+	start := time.Now()
+	err := client.SetStatus(status.text, status.emoji, int(expiresAt.Unix()))
+
+	if err == nil {
+		syncPresence(client, config, status, snoozeLength(config.Slack, status, ttl, now))
+	}
+
+	slackSyncSeconds.Observe(time.Since(start).Seconds())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inFlight, clientID)
+
+	if err != nil {
+		// Forgotten, so the next push tries again.
+		delete(s.synced, clientID)
+		slackSyncsTotal.Inc("failure")
+		slog.Error("failed to sync status to Slack", "error", err, "user", config.User)
+
+		var rateLimit *slack.RateLimitError
+		if errors.As(err, &rateLimit) && rateLimit.RetryAfter > 0 {
+			slog.Warn("paused Slack sync as Slack asked", "client_id", clientID, "retry_after", rateLimit.RetryAfter)
+			s.limited[status.token] = s.now().Add(rateLimit.RetryAfter)
+		}
+
+		if errors.Is(err, slack.ErrTokenRevoked) || errors.Is(err, slack.ErrInvalidAuth) {
+			slog.Warn("disabled Slack sync until the token changes", "client_id", clientID, "user", config.User)
+			s.disabled[clientID] = slackDisabled{
+				token:   status.token,
+				problem: SlackProblem{Error: err.Error(), Since: s.now().UTC()},
+			}
+		}
+
+		return
+	}
+
+	s.synced[clientID] = slackSync{status: status, expiresAt: expiresAt, ttl: ttl}
+	slackSyncsTotal.Inc("success")
+	slog.Info("synced status to Slack", "user", config.User, "status", status.text, "emoji", status.emoji)
+}
+
+// syncPresence sets the user's presence and Do Not Disturb to match status.
+// Failures are only logged: the status itself was set, and a token without
+// the users:write or dnd:write scope should not stop it from being synced.
+func syncPresence(client *slack.Client, config embed.SiteConfig, status slackStatus, snooze time.Duration) {
+	if status.presence != "" {
+		err := client.SetPresence(status.presence)
+		if err != nil {
+			slog.Warn("failed to set Slack presence", "error", err, "user", config.User)
+		}
+	}
+
+	var err error
+
+	switch status.dnd {
+	case dndSnooze:
+		err = client.SetSnooze(snooze)
+	case dndEnd:
+		err = client.EndSnooze()
+	case dndKeep:
+	}
+
+	if err != nil {
+		slog.Warn("failed to update Slack Do Not Disturb", "error", err, "user", config.User)
+	}
+}
+
+// snoozeLength is how long a red light snoozes notifications: until the
+// focus block or override behind it ends, or else for snooze_minutes, or else
+// for as long as the status lasts.
+func snoozeLength(config embed.SlackConfig, status slackStatus, ttl time.Duration, now time.Time) time.Duration {
+	if status.snoozeUntil.After(now) {
+		return status.snoozeUntil.Sub(now)
+	}
+
+	if config.SnoozeMinutes > 0 {
+		return time.Duration(config.SnoozeMinutes) * time.Minute
+	}
+
+	return ttl
+}
+
+func desiredSlackStatus(config embed.SiteConfig, now time.Time) slackStatus {
+	state := config.Contributor.State()
+
+	status := slackStatus{
+		token:    config.Slack.UserToken,
+		state:    state,
+		text:     slackText(config, state),
+		emoji:    slackEmoji(config.Slack, state),
+		presence: slackPresence(config.Slack, state),
+	}
+
+	switch {
+	case state == embed.StatusRed && config.Slack.SnoozeOnRed:
+		status.dnd = dndSnooze
+		status.snoozeUntil = scheduledEnd(config, now)
+	case state == embed.StatusGreen && config.Slack.EndSnoozeOnGreen:
+		status.dnd = dndEnd
+	}
+
+	return status
+}
+
+func slackPresence(config embed.SlackConfig, state embed.Status) slack.Presence {
+	switch {
+	case !config.SetPresence:
+		return ""
+	case state == embed.StatusRed || state == embed.StatusAway:
+		return slack.PresenceAway
+	default:
+		return slack.PresenceAuto
+	}
+}
+
+// scheduledEnd returns when the override or schedule window that gave config
+// its status ends, or zero if the status did not come from one.
+func scheduledEnd(config embed.SiteConfig, now time.Time) time.Time {
+	scheduler := schedule.New(fixedClock(now))
+
+	if status, _ := scheduler.Status(config); status != config.Contributor.State() {
+		return time.Time{}
+	}
+
+	return scheduler.Until(config)
+}
+
+// fixedClock is a schedule.Clock stopped at one time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
@@ -0,0 +1,414 @@
+package wsserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/auth"
+	"github.com/benwsapp/rlgl/pkg/embed"
+	"github.com/benwsapp/rlgl/pkg/slack"
+	"github.com/benwsapp/rlgl/pkg/wsserver"
+	"github.com/gorilla/websocket"
+)
+
+// fakeSlack counts users.profile.set calls and answers ok, or with the error
+// code set by failWith. Other calls are only recorded, as their method and
+// form.
+type fakeSlack struct {
+	calls atomic.Int32
+
+	mu     sync.Mutex
+	code   string
+	others []string
+}
+
+func (f *fakeSlack) failWith(code string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.code = code
+}
+
+func (f *fakeSlack) response() slack.ProfileResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return slack.ProfileResponse{Ok: f.code == "", Error: f.code}
+}
+
+func (f *fakeSlack) record(req *http.Request) {
+	_ = req.ParseForm()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.others = append(f.others, req.URL.Path+"?"+req.PostForm.Encode())
+}
+
+// takeOthers returns the calls other than users.profile.set since it was
+// last called.
+func (f *fakeSlack) takeOthers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	others := f.others
+	f.others = nil
+
+	return others
+}
+
+func newFakeSlack(t *testing.T, handle func()) (*fakeSlack, string) {
+	t.Helper()
+
+	fake := &fakeSlack{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/users.profile.set" {
+			fake.record(req)
+			_ = json.NewEncoder(writer).Encode(slack.ProfileResponse{Ok: true})
+
+			return
+		}
+
+		fake.calls.Add(1)
+
+		if handle != nil {
+			handle()
+		}
+
+		_ = json.NewEncoder(writer).Encode(fake.response())
+	}))
+	t.Cleanup(server.Close)
+
+	return fake, server.URL
+}
+
+func slackConfig(focus string) embed.SiteConfig {
+	return embed.SiteConfig{
+		User:        "alice",
+		Contributor: embed.Contributor{Status: embed.StatusGreen, Focus: focus},
+		Slack:       embed.SlackConfig{Enabled: true, UserToken: "xoxp-test", TTLSeconds: 3600},
+	}
+}
+
+func TestSlackSyncerSkipsUnchangedStatus(t *testing.T) {
+	t.Parallel()
+
+	fake, apiURL := newFakeSlack(t, nil)
+
+	now := time.Now()
+	syncer := wsserver.NewSlackSyncer().WithAPIURL(apiURL)
+	syncer.SetClock(func() time.Time { return now })
+
+	push := func(config embed.SiteConfig) int32 {
+		syncer.Sync("alice", config)
+		syncer.Wait()
+
+		return fake.calls.Load()
+	}
+
+	for range 3 {
+		if calls := push(slackConfig("reviews")); calls != 1 {
+			t.Fatalf("expected one Slack call for an unchanged status, got %d", calls)
+		}
+	}
+
+	if calls := push(slackConfig("deploys")); calls != 2 {
+		t.Errorf("expected a new focus to be synced, got %d calls", calls)
+	}
+
+	now = now.Add(50 * time.Minute)
+
+	if calls := push(slackConfig("deploys")); calls != 2 {
+		t.Errorf("expected a status with time left not to be refreshed, got %d calls", calls)
+	}
+
+	now = now.Add(6 * time.Minute)
+
+	if calls := push(slackConfig("deploys")); calls != 3 {
+		t.Errorf("expected a status about to expire to be refreshed, got %d calls", calls)
+	}
+
+	syncer.Forget("alice")
+
+	if calls := push(slackConfig("deploys")); calls != 4 {
+		t.Errorf("expected a forgotten status to be synced again, got %d calls", calls)
+	}
+}
+
+func TestSlackSyncerRetriesFailedSync(t *testing.T) {
+	t.Parallel()
+
+	fake, apiURL := newFakeSlack(t, nil)
+	fake.failWith("invalid_profile")
+
+	syncer := wsserver.NewSlackSyncer().WithAPIURL(apiURL)
+
+	syncer.Sync("alice", slackConfig("reviews"))
+	syncer.Wait()
+
+	fake.failWith("")
+
+	syncer.Sync("alice", slackConfig("reviews"))
+	syncer.Wait()
+
+	if calls := fake.calls.Load(); calls != 2 {
+		t.Errorf("expected the push after a failure to try again, got %d calls", calls)
+	}
+}
+
+func TestSlackSyncerBoundsWorkers(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		running int
+		peak    int
+	)
+
+	fake, apiURL := newFakeSlack(t, func() {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	syncer := wsserver.NewSlackSyncer().WithAPIURL(apiURL).WithWorkers(2)
+
+	for i := range 10 {
+		syncer.Sync("client-"+strconv.Itoa(i), slackConfig("reviews"))
+	}
+
+	// Pushes waiting for a worker are folded into the latest one.
+	syncer.Sync("client-9", slackConfig("deploys"))
+	syncer.Sync("client-9", slackConfig("incidents"))
+
+	syncer.Wait()
+
+	if calls := fake.calls.Load(); calls < 10 || calls > 11 {
+		t.Errorf("expected each client to be synced once or twice at most, got %d calls", calls)
+	}
+
+	if peak > 2 {
+		t.Errorf("expected at most 2 Slack calls at once, got %d", peak)
+	}
+}
+
+func TestSlackSyncerDisablesRevokedToken(t *testing.T) {
+	t.Parallel()
+
+	fake, apiURL := newFakeSlack(t, nil)
+	fake.failWith("token_revoked")
+
+	runtime := wsserver.NewRuntime()
+	runtime.Slack.WithAPIURL(apiURL)
+
+	config := slackConfig("reviews")
+
+	for _, focus := range []string{"reviews", "deploys", "incidents"} {
+		config = slackConfig(focus)
+		runtime.Slack.Sync("alice", config)
+		runtime.Slack.Wait()
+	}
+
+	if calls := fake.calls.Load(); calls != 1 {
+		t.Errorf("expected a revoked token to be tried once, got %d calls", calls)
+	}
+
+	status := wsserver.PublicStatus(runtime, "alice", config)
+	if status.Slack == nil || !strings.Contains(status.Slack.Error, "token revoked") {
+		t.Fatalf("expected the status to say Slack sync is off, got %+v", status.Slack)
+	}
+
+	fake.failWith("")
+
+	config.Slack.UserToken = "xoxp-new"
+	runtime.Slack.Sync("alice", config)
+	runtime.Slack.Wait()
+
+	if calls := fake.calls.Load(); calls != 2 {
+		t.Errorf("expected a new token to be synced, got %d calls", calls)
+	}
+
+	if problem := runtime.Slack.Problem("alice"); problem != nil {
+		t.Errorf("expected sync to be back on, got %+v", problem)
+	}
+}
+
+func TestSlackSyncerHonorsLongRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	limited := atomic.Bool{}
+	limited.Store(true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+
+		if limited.Load() {
+			writer.Header().Set("Retry-After", "120")
+			writer.WriteHeader(http.StatusTooManyRequests)
+
+			return
+		}
+
+		_ = json.NewEncoder(writer).Encode(slack.ProfileResponse{Ok: true})
+	}))
+	t.Cleanup(server.Close)
+
+	now := time.Now()
+	syncer := wsserver.NewSlackSyncer().WithAPIURL(server.URL)
+	syncer.SetClock(func() time.Time { return now })
+
+	push := func(focus string) int32 {
+		syncer.Sync("alice", slackConfig(focus))
+		syncer.Wait()
+
+		return calls.Load()
+	}
+
+	if got := push("reviews"); got != 1 {
+		t.Fatalf("expected a long Retry-After not to be waited out, got %d calls", got)
+	}
+
+	limited.Store(false)
+	now = now.Add(time.Minute)
+
+	if got := push("deploys"); got != 1 {
+		t.Errorf("expected no call before Retry-After has passed, got %d calls", got)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+
+	if got := push("incidents"); got != 2 {
+		t.Errorf("expected a sync once Retry-After has passed, got %d calls", got)
+	}
+}
+
+func TestSlackSyncerSetsPresenceAndSnooze(t *testing.T) {
+	t.Parallel()
+
+	fake, apiURL := newFakeSlack(t, nil)
+
+	now := time.Date(2026, time.March, 2, 10, 0, 0, 0, time.UTC)
+	syncer := wsserver.NewSlackSyncer().WithAPIURL(apiURL)
+	syncer.SetClock(func() time.Time { return now })
+
+	config := slackConfig("reviews")
+	config.Slack.SetPresence = true
+	config.Slack.SnoozeOnRed = true
+	config.Slack.SnoozeMinutes = 30
+	config.Slack.EndSnoozeOnGreen = true
+
+	push := func(status embed.Status, override *embed.Override) []string {
+		config.Contributor.Status = status
+		config.Override = override
+
+		syncer.Sync("alice", config)
+		syncer.Wait()
+
+		return fake.takeOthers()
+	}
+
+	tests := []struct {
+		name     string
+		status   embed.Status
+		override *embed.Override
+		want     []string
+	}{
+		{
+			"red override", embed.StatusRed, &embed.Override{Status: embed.StatusRed, Until: now.Add(90 * time.Minute)},
+			[]string{"/users.setPresence?presence=away", "/dnd.setSnooze?num_minutes=90"},
+		},
+		{
+			"manual red", embed.StatusRed, nil,
+			[]string{"/users.setPresence?presence=away", "/dnd.setSnooze?num_minutes=30"},
+		},
+		{"unchanged", embed.StatusRed, nil, nil},
+		{
+			"green", embed.StatusGreen, nil,
+			[]string{"/users.setPresence?presence=auto", "/dnd.endSnooze?"},
+		},
+		{"yellow", embed.StatusYellow, nil, []string{"/users.setPresence?presence=auto"}},
+	}
+
+	for _, test := range tests {
+		if got := push(test.status, test.override); !slices.Equal(got, test.want) {
+			t.Errorf("%s: expected calls %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestSlackSyncerKeepsStatusAcrossReconnects(t *testing.T) {
+	t.Parallel()
+
+	fake, apiURL := newFakeSlack(t, nil)
+
+	runtime := wsserver.NewRuntime()
+	runtime.Slack.WithAPIURL(apiURL)
+
+	registry := auth.NewRegistry()
+
+	err := registry.Register("alice-token", "alice")
+	if err != nil {
+		t.Fatalf("failed to register token: %v", err)
+	}
+
+	connections := wsserver.NewConnections()
+
+	server := httptest.NewServer(connections.Handler(wsserver.NewStore(), runtime, registry))
+	t.Cleanup(server.Close)
+
+	// session pushes once, waits for the sync and hangs up with code,
+	// returning the Slack calls made so far once the server is done with the
+	// connection.
+	session := func(code int) int32 {
+		t.Helper()
+
+		conn := dialWebSocket(t, "ws"+strings.TrimPrefix(server.URL, "http"), "alice-token")
+		config := slackConfig("reviews")
+
+		if response := sendMessage(t, conn, wsserver.Message{Type: "push", ClientID: "alice", Config: &config}); response.Type != "ack" {
+			t.Fatalf("expected ack, got %+v", response)
+		}
+
+		runtime.Slack.Wait()
+
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+		_ = conn.Close()
+
+		err := connections.Wait(t.Context())
+		if err != nil {
+			t.Fatalf("failed waiting for the connection to close: %v", err)
+		}
+
+		return fake.calls.Load()
+	}
+
+	if calls := session(websocket.CloseNormalClosure); calls != 1 {
+		t.Fatalf("expected the first push to be synced, got %d calls", calls)
+	}
+
+	if calls := session(websocket.CloseGoingAway); calls != 1 {
+		t.Errorf("expected a reconnect with the same status not to be synced, got %d calls", calls)
+	}
+
+	if calls := session(websocket.CloseNormalClosure); calls != 2 {
+		t.Errorf("expected a push after the client stopped to be synced, got %d calls", calls)
+	}
+}
@@ -0,0 +1,252 @@
+package wsserver
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benwsapp/rlgl/pkg/embed"
+)
+
+const fileStorePrefix = "file:"
+
+var ErrUnknownStore = errors.New("unknown store type")
+
+// Store holds the most recent config pushed by each client. Writes that
+// change a config are announced to subscribers. Update reads, changes and
+// stores a client's config as one step, so concurrent patches never lose
+// each other's changes.
+type Store interface {
+	Set(clientID string, config embed.SiteConfig) error
+	Update(clientID string, change UpdateFunc) (embed.SiteConfig, error)
+	Delete(clientID string) (bool, error)
+	Get(clientID string) (embed.SiteConfig, bool)
+	GetAll() map[string]embed.SiteConfig
+	Entries() []Entry
+	History(clientID string, since time.Time) []Transition
+	Subscribe() *Subscription
+	Seq() uint64
+	Close() error
+}
+
+// UpdateFunc returns what a client's config should become, given the stored
+// config and whether there is one. An error stores nothing and is returned
+// from Update as is.
+type UpdateFunc func(stored embed.SiteConfig, exists bool) (embed.SiteConfig, error)
+
+// Entry is a stored client config along with when it last changed.
+type Entry struct {
+	ClientID  string           `json:"clientId"`
+	Config    embed.SiteConfig `json:"config"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+// MemoryStore keeps client configs in memory only; everything is lost on restart.
+type MemoryStore struct {
+	// writeMu serializes writes, so nothing lands between the read and the
+	// write of an Update.
+	writeMu sync.Mutex
+
+	mu      sync.RWMutex
+	entries map[string]Entry
+	hub     *Hub
+	history *History
+}
+
+func NewStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]Entry),
+		hub:     NewHub(),
+		history: NewHistory(DefaultHistoryRetention),
+	}
+}
+
+// WithHistoryRetention sets how long status transitions are kept; zero or
+// less stops recording them.
+func (s *MemoryStore) WithHistoryRetention(retention time.Duration) *MemoryStore {
+	s.history.SetRetention(retention)
+
+	return s
+}
+
+func (s *MemoryStore) Set(clientID string, config embed.SiteConfig) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.apply(Entry{ClientID: clientID, Config: config, UpdatedAt: time.Now().UTC()})
+
+	return nil
+}
+
+func (s *MemoryStore) Update(clientID string, change UpdateFunc) (embed.SiteConfig, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	stored, exists := s.Get(clientID)
+
+	config, err := change(stored, exists)
+	if err != nil {
+		return embed.SiteConfig{}, err
+	}
+
+	s.apply(Entry{ClientID: clientID, Config: config, UpdatedAt: time.Now().UTC()})
+
+	return config, nil
+}
+
+// apply stores an entry and, when the config actually changed, records the
+// change in the history and notifies subscribers. It returns the recorded
+// transition.
+func (s *MemoryStore) apply(value Entry) (Transition, bool) {
+	var (
+		transition Transition
+		recorded   bool
+	)
+
+	previous, changed := s.put(value)
+	if changed {
+		transition, recorded = s.history.Record(value.ClientID, previous, value.Config, value.UpdatedAt)
+
+		seq := s.hub.Publish()
+		slog.Info("stored config", "client_id", value.ClientID, "name", value.Config.Name, "seq", seq)
+	}
+
+	return transition, recorded
+}
+
+// put stores an entry without any side effects and reports
+// whether the config changed, along with the config it replaced, if any. An
+// identical config keeps its original UpdatedAt, so it records when the
+// status last changed, not the last push.
+func (s *MemoryStore) put(value Entry) (*embed.SiteConfig, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.entries[value.ClientID]
+	if ok && reflect.DeepEqual(existing.Config, value.Config) {
+		return nil, false
+	}
+
+	s.entries[value.ClientID] = value
+
+	if !ok {
+		return nil, true
+	}
+
+	return &existing.Config, true
+}
+
+// Delete removes clientID from the board and reports whether it was there.
+// Its history is kept until it expires.
+func (s *MemoryStore) Delete(clientID string) (bool, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if !s.remove(clientID) {
+		return false, nil
+	}
+
+	seq := s.hub.Publish()
+	slog.Info("deleted config", "client_id", clientID, "seq", seq)
+
+	return true, nil
+}
+
+// remove deletes an entry without notifying subscribers and reports whether
+// there was one.
+func (s *MemoryStore) remove(clientID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.entries[clientID]
+	delete(s.entries, clientID)
+
+	return ok
+}
+
+// unchanged reports whether config is identical to what is stored for clientID.
+func (s *MemoryStore) unchanged(clientID string, config embed.SiteConfig) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	existing, ok := s.entries[clientID]
+
+	return ok && reflect.DeepEqual(existing.Config, config)
+}
+
+func (s *MemoryStore) Get(clientID string) (embed.SiteConfig, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.entries[clientID]
+
+	return value.Config, ok
+}
+
+func (s *MemoryStore) GetAll() map[string]embed.SiteConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]embed.SiteConfig, len(s.entries))
+	for clientID, value := range s.entries {
+		result[clientID] = value.Config
+	}
+
+	return result
+}
+
+// Entries returns every stored entry in no particular order.
+func (s *MemoryStore) Entries() []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Collect(maps.Values(s.entries))
+}
+
+// History returns the client's status transitions since the given time.
+func (s *MemoryStore) History(clientID string, since time.Time) []Transition {
+	return s.history.Since(clientID, since)
+}
+
+func (s *MemoryStore) Subscribe() *Subscription {
+	return s.hub.Subscribe()
+}
+
+func (s *MemoryStore) Seq() uint64 {
+	return s.hub.Seq()
+}
+
+func (s *MemoryStore) snapshot() map[string]Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return maps.Clone(s.entries)
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func GetStore() *MemoryStore {
+	return NewStore()
+}
+
+// OpenStore returns the store described by spec: "memory" (the default) or
+// "file:<dir>" for a durable store kept in dir. Status transitions are kept
+// for historyRetention.
+func OpenStore(spec string, historyRetention time.Duration) (Store, error) {
+	switch {
+	case spec == "" || spec == "memory":
+		return NewStore().WithHistoryRetention(historyRetention), nil
+	case strings.HasPrefix(spec, fileStorePrefix):
+		return OpenFileStore(strings.TrimPrefix(spec, fileStorePrefix), historyRetention)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStore, spec)
+	}
+}
@@ -1,16 +1,18 @@
 package wsserver
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"maps"
 	"net/http"
-	"sync"
+	"strings"
 	"time"
 
+	"github.com/benwsapp/rlgl/pkg/auth"
 	"github.com/benwsapp/rlgl/pkg/embed"
-	"github.com/benwsapp/rlgl/pkg/slack"
+	"github.com/benwsapp/rlgl/pkg/protocol"
 	"github.com/gorilla/websocket"
 )
 
@@ -19,6 +21,14 @@ const (
 	writeBufferSize = 1024
 )
 
+// ErrCertificateClientID rejects a push from a certificate-authenticated
+// connection for a client other than the certificate's common name.
+var ErrCertificateClientID = errors.New("client id does not match certificate")
+
+// ErrMissingToken rejects a request with neither a bearer token nor a client
+// certificate.
+var ErrMissingToken = errors.New("missing or invalid authorization header")
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  readBufferSize,
 	WriteBufferSize: writeBufferSize,
@@ -27,136 +37,141 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-type Store struct {
-	mu      sync.RWMutex
-	configs map[string]embed.SiteConfig
+// defaultSlackEmojis are the Slack emoji used when a config sets none.
+var defaultSlackEmojis = map[embed.Status]string{
+	embed.StatusGreen:  ":large_green_circle:",
+	embed.StatusYellow: ":large_yellow_circle:",
+	embed.StatusRed:    ":red_circle:",
+	embed.StatusAway:   ":white_circle:",
 }
 
-func NewStore() *Store {
-	return &Store{
-		configs: make(map[string]embed.SiteConfig),
+// slackEmoji picks the emoji for status: the per-status setting first, then
+// the older active/inactive settings, then the default.
+func slackEmoji(slackConfig embed.SlackConfig, status embed.Status) string {
+	if emoji := slackConfig.StatusEmojis[status]; emoji != "" {
+		return emoji
 	}
-}
-
-func (s *Store) Set(clientID string, config embed.SiteConfig) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.configs[clientID] = config
-	slog.Info("stored config", "client_id", clientID, "name", config.Name)
 
-	if config.Slack.Enabled && config.Slack.UserToken != "" {
-		go syncToSlack(config)
+	switch {
+	case status == embed.StatusGreen && slackConfig.StatusEmojiActive != "":
+		return slackConfig.StatusEmojiActive
+	case status == embed.StatusRed && slackConfig.StatusEmojiInactive != "":
+		return slackConfig.StatusEmojiInactive
+	default:
+		return defaultSlackEmojis[status]
 	}
 }
 
-func syncToSlack(config embed.SiteConfig) {
-	client := slack.NewClient(config.Slack.UserToken)
-
-	var statusText string
+// slackText is the status text: the current focus, or the status label when
+// a busy or away contributor has none.
+func slackText(config embed.SiteConfig, status embed.Status) string {
+	if config.Contributor.Focus != "" || status == embed.StatusGreen || status == embed.StatusYellow {
+		return config.Contributor.Focus
+	}
 
-	var statusEmoji string
+	if status == embed.StatusRed {
+		return "Busy"
+	}
 
-	if config.Contributor.Active {
-		statusEmoji = config.Slack.StatusEmojiActive
-		if statusEmoji == "" {
-			statusEmoji = ":large_green_circle:"
-		}
+	return config.StatusStyles()[status].Label
+}
 
-		statusText = config.Contributor.Focus
-	} else {
-		statusEmoji = config.Slack.StatusEmojiInactive
-		if statusEmoji == "" {
-			statusEmoji = ":red_circle:"
-		}
+// Message is a message on the /ws WebSocket.
+type Message = protocol.Message
 
-		statusText = config.Contributor.Focus
-		if statusText == "" {
-			statusText = "Busy"
-		}
-	}
+// Handler accepts connections bearing authToken, which may push as any client.
+func Handler(store Store, authToken string) http.HandlerFunc {
+	registry := auth.NewRegistry()
+	_ = registry.Register(authToken, auth.AnyClientID)
 
-	ttl := config.Slack.TTLSeconds
-	if ttl == 0 {
-		ttl = 3600
-	}
+	return HandlerWithRegistry(store, registry)
+}
 
-	expirationSeconds := int(time.Now().Add(time.Duration(ttl) * time.Second).Unix())
+// HandlerWithRegistry accepts connections bearing any token in registry. Every
+// push is checked against the token's current client IDs, so revoking a token
+// also cuts off connections that are already open.
+func HandlerWithRegistry(store Store, registry *auth.Registry) http.HandlerFunc {
+	return NewConnections().Handler(store, NewRuntime(), registry)
+}
 
-	err := client.SetStatus(statusText, statusEmoji, expirationSeconds)
-	if err != nil {
-		slog.Error("failed to sync status to Slack", "error", err, "user", config.User)
-	} else {
-		slog.Info("synced status to Slack", "user", config.User, "status", statusText, "emoji", statusEmoji)
-	}
+// credential is what a connection authenticated with: a token, or a verified
+// TLS client certificate whose common name is the one client ID it may push as.
+type credential struct {
+	registry   *auth.Registry
+	token      string
+	commonName string
 }
 
-func (s *Store) Get(clientID string) (embed.SiteConfig, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (c credential) authorize(clientID string) error {
+	if c.token == "" {
+		if clientID != c.commonName {
+			return fmt.Errorf("%w: %s", ErrCertificateClientID, clientID)
+		}
 
-	config, ok := s.configs[clientID]
+		return nil
+	}
 
-	return config, ok
+	return c.registry.Authorize(c.token, clientID) //nolint:wrapcheck
 }
 
-func (s *Store) GetAll() map[string]embed.SiteConfig {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	result := make(map[string]embed.SiteConfig, len(s.configs))
-	maps.Copy(result, s.configs)
+// authenticate accepts a bearer token from registry or, failing that, a
+// verified client certificate.
+func authenticate(writer http.ResponseWriter, req *http.Request, registry *auth.Registry) (credential, bool) {
+	cred, err := identify(req, registry)
+	if err != nil {
+		slog.Warn("websocket connection rejected", "error", err, "remote_addr", req.RemoteAddr)
+		pushRejectsTotal.Inc(rejectBadToken)
+		http.Error(writer, "Unauthorized", http.StatusUnauthorized)
 
-	return result
-}
+		return credential{}, false
+	}
 
-type Message struct {
-	Type     string            `json:"type"`
-	ClientID string            `json:"clientId"`
-	Config   *embed.SiteConfig `json:"config,omitempty"`
-	Error    string            `json:"error,omitempty"`
+	return cred, true
 }
 
-func Handler(store *Store, authToken string) http.HandlerFunc {
-	return func(writer http.ResponseWriter, req *http.Request) {
-		if !validateToken(writer, req, authToken) {
-			return
+// identify returns the credential a request carries: its bearer token if
+// registry knows it or, with no token at all, a verified client certificate.
+func identify(req *http.Request, registry *auth.Registry) (credential, error) {
+	if getAuthToken(req) == "" {
+		commonName := certificateCommonName(req)
+		if commonName != "" {
+			return credential{commonName: commonName}, nil
 		}
+	}
 
-		conn, err := upgrader.Upgrade(writer, req, nil)
-		if err != nil {
-			slog.Error("failed to upgrade connection", "error", err)
-
-			return
-		}
-		defer conn.Close()
+	token, err := bearerToken(req, registry)
+	if err != nil {
+		return credential{}, err
+	}
 
-		slog.Info("websocket connection established", "remote_addr", req.RemoteAddr)
+	return credential{registry: registry, token: token}, nil
+}
 
-		handleConnection(conn, store)
+// certificateCommonName returns the common name of the request's client
+// certificate, if it was verified against the server's client CAs.
+func certificateCommonName(req *http.Request) string {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return ""
 	}
+
+	return req.TLS.VerifiedChains[0][0].Subject.CommonName
 }
 
-func validateToken(writer http.ResponseWriter, req *http.Request, authToken string) bool {
+// bearerToken returns the request's bearer token once registry knows it.
+func bearerToken(req *http.Request, registry *auth.Registry) (string, error) {
 	providedToken := getAuthToken(req)
 
 	const bearerPrefix = "Bearer "
-	if len(providedToken) < len(bearerPrefix) || providedToken[:len(bearerPrefix)] != bearerPrefix {
-		slog.Warn("websocket connection rejected: missing or invalid authorization header", "remote_addr", req.RemoteAddr)
-		http.Error(writer, "Unauthorized", http.StatusUnauthorized)
-
-		return false
+	if !strings.HasPrefix(providedToken, bearerPrefix) || len(providedToken) == len(bearerPrefix) {
+		return "", ErrMissingToken
 	}
 
 	token := providedToken[len(bearerPrefix):]
-	if token != authToken {
-		slog.Warn("websocket connection rejected: invalid token", "remote_addr", req.RemoteAddr)
-		http.Error(writer, "Unauthorized", http.StatusUnauthorized)
-
-		return false
+	if !registry.Authenticate(token) {
+		return "", auth.ErrInvalidToken
 	}
 
-	return true
+	return token, nil
 }
 
 func getAuthToken(req *http.Request) string {
@@ -171,48 +186,79 @@ func getAuthToken(req *http.Request) string {
 	return providedToken
 }
 
-func handleConnection(conn *websocket.Conn, store *Store) {
+func handleConnection(conn *peerConn, store Store, runtime *Runtime) {
+	presence := runtime.Presence
+
+	// stopped is set when the client says it is going away for good rather
+	// than dropping the connection to reconnect.
+	stopped := false
+
+	defer func() {
+		for _, clientID := range conn.clientIDList() {
+			presence.Disconnected(clientID)
+
+			// A client may clear its Slack status as it stops, so what was
+			// synced for it can no longer be trusted. Other disconnects
+			// keep it, so reconnecting does not cost Slack calls.
+			if stopped {
+				runtime.Slack.Forget(clientID)
+			}
+		}
+	}()
+
 	for {
 		var msg Message
 
-		err := conn.ReadJSON(&msg)
+		err := conn.conn.ReadJSON(&msg)
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				slog.Error("websocket read error", "error", err)
 			}
 
+			stopped = websocket.IsCloseError(err, websocket.CloseGoingAway)
+
 			break
 		}
 
 		slog.Info("received message", "type", msg.Type, "client_id", msg.ClientID)
 
-		handleErr := handleMessage(conn, store, msg)
+		trackPresence(presence, conn, msg)
+
+		handleErr := handleMessage(conn, store, runtime, conn.cred, msg)
 		if handleErr != nil {
 			return
 		}
 	}
 }
 
-func handleMessage(conn *websocket.Conn, store *Store, msg Message) error {
-	switch msg.Type {
-	case "push":
-		store.Set(msg.ClientID, *msg.Config)
+// trackPresence notes that a client this connection may speak for has been
+// heard from, and that commands for it should be sent here.
+func trackPresence(presence *PresenceTracker, conn *peerConn, msg Message) {
+	if msg.ClientID == "" || conn.cred.authorize(msg.ClientID) != nil {
+		return
+	}
 
-		response := Message{
-			Type:     "ack",
-			ClientID: msg.ClientID,
-		}
+	if conn.addClientID(msg.ClientID) {
+		presence.Connected(msg.ClientID)
+	}
 
-		writeErr := conn.WriteJSON(response)
-		if writeErr != nil {
-			slog.Error("failed to send ack", "error", writeErr)
+	presence.Seen(msg.ClientID, time.Duration(msg.Interval)*time.Second)
+}
 
-			return fmt.Errorf("failed to send ack: %w", writeErr)
-		}
+func handleMessage(conn *peerConn, store Store, runtime *Runtime, cred credential, msg Message) error {
+	switch msg.Type {
+	case protocol.TypeHello:
+		return handleHello(conn, msg)
 
-	case "ping":
+	case protocol.TypePush:
+		return handlePush(conn, store, runtime, cred, msg)
+
+	case protocol.TypePatch:
+		return handlePatch(conn, store, runtime, cred, msg)
+
+	case protocol.TypePing:
 		response := Message{
-			Type:     "pong",
+			Type:     protocol.TypePong,
 			ClientID: msg.ClientID,
 		}
 
@@ -224,26 +270,214 @@ func handleMessage(conn *websocket.Conn, store *Store, msg Message) error {
 		}
 
 	default:
-		response := Message{
-			Type:     "error",
-			ClientID: msg.ClientID,
-			Error:    "unknown message type",
+		pushRejectsTotal.Inc(rejectUnknownType)
+
+		return sendError(conn, msg.ClientID, protocol.UnknownTypeError)
+	}
+
+	return nil
+}
+
+// handleHello answers a client's handshake. A client too old to understand
+// the server is sent the reason and disconnected.
+func handleHello(conn *peerConn, hello Message) error {
+	welcome, err := protocol.Welcome(hello)
+	if err != nil {
+		slog.Warn("refused incompatible client", "error", err, "client_id", hello.ClientID, "client_version", hello.ClientVersion)
+		pushRejectsTotal.Inc(rejectIncompatible)
+
+		sendErr := sendError(conn, hello.ClientID, err.Error())
+		if sendErr != nil {
+			return sendErr
 		}
 
-		writeErr := conn.WriteJSON(response)
-		if writeErr != nil {
-			slog.Error("failed to send error", "error", writeErr)
+		return err //nolint:wrapcheck
+	}
+
+	slog.Info("client handshake",
+		"client_id", hello.ClientID,
+		"client_version", hello.ClientVersion,
+		"protocol_version", welcome.ProtocolVersion,
+		"capabilities", welcome.Capabilities,
+	)
+
+	writeErr := conn.welcome(welcome)
+	if writeErr != nil {
+		slog.Error("failed to send welcome", "error", writeErr)
+
+		return fmt.Errorf("failed to send welcome: %w", writeErr)
+	}
+
+	return nil
+}
+
+// handlePush stores a pushed config and acknowledges it.
+func handlePush(conn *peerConn, store Store, runtime *Runtime, cred credential, msg Message) error {
+	authErr := cred.authorize(msg.ClientID)
+	if authErr != nil {
+		slog.Warn("push rejected", "error", authErr, "client_id", msg.ClientID)
+
+		return rejectPush(conn, msg.ClientID, authErr)
+	}
+
+	if msg.Config == nil {
+		slog.Warn("push rejected: no config", "client_id", msg.ClientID)
+		pushRejectsTotal.Inc(rejectInvalidConfig)
+
+		return sendError(conn, msg.ClientID, "invalid config: push has no config")
+	}
+
+	pushed := *msg.Config
+
+	return storeConfig(conn, store, runtime, msg.ClientID, func(embed.SiteConfig) (embed.SiteConfig, error) {
+		return pushed, nil
+	})
+}
 
-			return fmt.Errorf("failed to send error: %w", writeErr)
+// handlePatch applies a merge patch to the client's stored config, or to an
+// empty one if it has none yet, and acknowledges it.
+func handlePatch(conn *peerConn, store Store, runtime *Runtime, cred credential, msg Message) error {
+	authErr := cred.authorize(msg.ClientID)
+	if authErr != nil {
+		slog.Warn("patch rejected", "error", authErr, "client_id", msg.ClientID)
+
+		return rejectPush(conn, msg.ClientID, authErr)
+	}
+
+	return storeConfig(conn, store, runtime, msg.ClientID, func(stored embed.SiteConfig) (embed.SiteConfig, error) {
+		return stored.MergePatch(msg.Patch)
+	})
+}
+
+// storeConfig stores what change makes of the client's config, with the
+// client's overrides replayed on it, once it is valid, then syncs it to Slack
+// and acknowledges it. The read and the write are one store update, so
+// concurrent patches never lose each other's changes.
+func storeConfig(
+	conn *peerConn,
+	store Store,
+	runtime *Runtime,
+	clientID string,
+	change func(stored embed.SiteConfig) (embed.SiteConfig, error),
+) error {
+	var rejectErr error
+
+	config, setErr := store.Update(clientID, func(stored embed.SiteConfig, _ bool) (embed.SiteConfig, error) {
+		config, err := change(stored)
+		if err != nil {
+			rejectErr = err
+
+			return config, err
+		}
+
+		err = config.Validate()
+		if err != nil {
+			rejectErr = fmt.Errorf("invalid config: %w", err)
+
+			return config, rejectErr
 		}
+
+		return runtime.Overrides.Apply(clientID, config), nil
+	})
+
+	if rejectErr != nil {
+		slog.Warn("push rejected", "error", rejectErr, "client_id", clientID)
+		pushRejectsTotal.Inc(rejectInvalidConfig)
+
+		return sendError(conn, clientID, rejectErr.Error())
+	}
+
+	if setErr != nil {
+		slog.Error("failed to store config", "error", setErr, "client_id", clientID)
+		pushRejectsTotal.Inc(rejectStoreFailure)
+
+		return sendError(conn, clientID, "failed to store config")
+	}
+
+	pushesTotal.Inc(clientID)
+	runtime.Slack.Sync(clientID, config)
+
+	response := Message{
+		Type:     protocol.TypeAck,
+		ClientID: clientID,
+	}
+
+	writeErr := conn.WriteJSON(response)
+	if writeErr != nil {
+		slog.Error("failed to send ack", "error", writeErr)
+
+		return fmt.Errorf("failed to send ack: %w", writeErr)
 	}
 
 	return nil
 }
 
-func StatusHandler(store *Store) http.HandlerFunc {
+// rejectPush reports an unauthorized push. A revoked token also ends the
+// connection; a token pushing as someone else may carry on as itself.
+func rejectPush(conn *peerConn, clientID string, authErr error) error {
+	if errors.Is(authErr, auth.ErrInvalidToken) {
+		pushRejectsTotal.Inc(rejectBadToken)
+	} else {
+		pushRejectsTotal.Inc(rejectClientID)
+	}
+
+	sendErr := sendError(conn, clientID, authErr.Error())
+	if sendErr != nil {
+		return sendErr
+	}
+
+	if errors.Is(authErr, auth.ErrInvalidToken) {
+		return authErr //nolint:wrapcheck
+	}
+
+	return nil
+}
+
+func sendError(conn *peerConn, clientID, reason string) error {
+	response := Message{
+		Type:     protocol.TypeError,
+		ClientID: clientID,
+		Error:    reason,
+	}
+
+	writeErr := conn.WriteJSON(response)
+	if writeErr != nil {
+		slog.Error("failed to send error", "error", writeErr)
+
+		return fmt.Errorf("failed to send error: %w", writeErr)
+	}
+
+	return nil
+}
+
+// ClientStatus is what viewers are shown of a client: the public part of its
+// config, whether it is still checking in and, if Slack sync has been turned
+// off for it, why.
+type ClientStatus struct {
+	embed.PublicSiteConfig
+
+	Presence Presence      `json:"presence"`
+	Slack    *SlackProblem `json:"slack,omitempty"`
+}
+
+// PublicStatus returns the viewer-facing status of a stored config.
+func PublicStatus(runtime *Runtime, clientID string, config embed.SiteConfig) ClientStatus {
+	return ClientStatus{
+		PublicSiteConfig: config.Public(),
+		Presence:         runtime.Presence.Get(clientID),
+		Slack:            runtime.Slack.Problem(clientID),
+	}
+}
+
+// StatusHandler returns every client's public config keyed by client ID.
+func StatusHandler(store Store, runtime *Runtime) http.HandlerFunc {
 	return func(writer http.ResponseWriter, _ *http.Request) {
-		configs := store.GetAll()
+		all := store.GetAll()
+
+		configs := make(map[string]ClientStatus, len(all))
+		for clientID, config := range all {
+			configs[clientID] = PublicStatus(runtime, clientID, config)
+		}
 
 		writer.Header().Set("Content-Type", "application/json")
 
@@ -255,14 +489,17 @@ func StatusHandler(store *Store) http.HandlerFunc {
 	}
 }
 
-func GetStore() *Store {
-	return NewStore()
-}
+// Run serves the WebSocket and status endpoints until ctx is done.
+func Run(ctx context.Context, addr string, store Store, _ []string, authToken string) error {
+	registry := auth.NewRegistry()
+	_ = registry.Register(authToken, auth.AnyClientID)
+
+	conns := NewConnections()
+	runtime := NewRuntime()
 
-func Run(addr string, store *Store, _ []string, authToken string) error {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/ws", Handler(store, authToken))
-	mux.HandleFunc("/status", StatusHandler(store))
+	mux.HandleFunc("/ws", conns.Handler(store, runtime, registry))
+	mux.HandleFunc("/status", StatusHandler(store, runtime))
 
 	const (
 		readHeaderTimeout = 5 * time.Second
@@ -282,10 +519,5 @@ func Run(addr string, store *Store, _ []string, authToken string) error {
 
 	slog.Info("websocket server listening", "addr", addr)
 
-	err := server.ListenAndServe()
-	if err != nil {
-		return fmt.Errorf("server failed: %w", err)
-	}
-
-	return nil
+	return ListenAndServe(ctx, server, conns)
 }